@@ -0,0 +1,89 @@
+// Package class implements named client classes. Classes are defined using
+// the class directive and evaluated once per request. The names of all
+// classes a client is a member of are stored on the request context so
+// plugins can restrict parts of their configuration to members of a class
+package class
+
+import (
+	"context"
+
+	"github.com/caddyserver/caddy"
+)
+
+// Key is a key used to associate the classes of a client with
+// a context.Context
+type Key struct{}
+
+// WithClasses returns a new context that has the given class names
+// assigned
+func WithClasses(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, Key{}, names)
+}
+
+// FromContext returns the names of all classes assigned to ctx
+func FromContext(ctx context.Context) []string {
+	val := ctx.Value(Key{})
+	if val == nil {
+		return nil
+	}
+
+	return val.([]string)
+}
+
+// Has returns true if name is one of the classes assigned to ctx
+func Has(ctx context.Context, name string) bool {
+	for _, n := range FromContext(ctx) {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Set is a set of class names a configuration is restricted to. A client
+// matches the set if it's a member of at least one of the classes. An
+// empty set matches any client
+type Set []string
+
+// Match returns true if the client of ctx matches the set
+func (s Set) Match(ctx context.Context) bool {
+	if len(s) == 0 {
+		return true
+	}
+
+	for _, name := range s {
+		if Has(ctx, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseSet parses the remaining arguments of the current dispenser line
+// as class names. All classes must be part of defined
+func ParseSet(c *caddy.Controller, defined []string) (Set, error) {
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return nil, c.ArgErr()
+	}
+
+	for _, name := range args {
+		if !contains(defined, name) {
+			return nil, c.Errf("unknown class %q", name)
+		}
+	}
+
+	return Set(args), nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package class
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/caddyserver/caddy"
+	"github.com/caddyserver/caddy/caddyfile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, FromContext(ctx))
+	assert.False(t, Has(ctx, "voip"))
+
+	ctx = WithClasses(ctx, []string{"voip", "guests"})
+	assert.Equal(t, []string{"voip", "guests"}, FromContext(ctx))
+	assert.True(t, Has(ctx, "guests"))
+	assert.False(t, Has(ctx, "iot"))
+}
+
+func TestSet(t *testing.T) {
+	ctx := WithClasses(context.Background(), []string{"voip"})
+
+	assert.True(t, Set(nil).Match(ctx))
+	assert.True(t, Set{"iot", "voip"}.Match(ctx))
+	assert.False(t, Set{"iot"}.Match(ctx))
+	assert.False(t, Set{"voip"}.Match(context.Background()))
+}
+
+func TestParseSet(t *testing.T) {
+	defined := []string{"voip", "iot"}
+
+	cases := []struct {
+		I string
+		R Set
+		E bool
+	}{
+		{"class voip", Set{"voip"}, false},
+		{"class voip iot", Set{"voip", "iot"}, false},
+		{"class", nil, true},
+		{"class guests", nil, true},
+	}
+
+	for i, c := range cases {
+		disp := caddyfile.NewDispenser("test", bytes.NewBufferString(c.I))
+		disp.Next()
+
+		s, err := ParseSet(&caddy.Controller{Dispenser: disp}, defined)
+		if c.E {
+			assert.Error(t, err, "case %d: %s", i, c.I)
+		} else {
+			assert.NoError(t, err, "case %d: %s", i, c.I)
+			assert.Equal(t, c.R, s, "case %d: %s", i, c.I)
+		}
+	}
+}
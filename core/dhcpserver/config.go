@@ -10,6 +10,7 @@ import (
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/iprange"
 	dhcpLog "github.com/nextdhcp/nextdhcp/core/log"
 	"github.com/nextdhcp/nextdhcp/plugin"
 )
@@ -29,7 +30,8 @@ type Config struct {
 	// multiple subnets
 	Interface net.Interface
 
-	// Database is the lease database that is queried for new leases and reservations
+	// Database is the lease database that is queried for new leases and reservations.
+	// It may be nil until the servers are made, use LeaseDatabase to access it
 	Database lease.Database
 
 	// Options holds a map of DHCP options that should be set
@@ -38,6 +40,17 @@ type Config struct {
 	// LeaseTime is the default lease time to use for new IP address leases
 	LeaseTime time.Duration
 
+	// Ranges holds the IP ranges configured for dynamic IP address
+	// assignment
+	Ranges iprange.IPRanges
+
+	// Excluded holds the addresses excluded from the configured ranges
+	Excluded iprange.IPRanges
+
+	// Classes holds the names of all client classes defined for
+	// the server block
+	Classes []string
+
 	// plugins is a list of middleware setup functions
 	plugins []plugin.Plugin
 
@@ -46,6 +59,31 @@ type Config struct {
 
 	// logger holds the logger instance for this subnet
 	logger log.Interface
+
+	// parent is the configuration of the server block if this is the
+	// configuration of a nested block
+	parent *Config
+}
+
+// LeaseDatabase returns the lease database of the subnet. The default
+// database is only opened once the servers are made so plugins must not
+// keep the result of this method during setup. Nested blocks use the
+// database of their server block unless they configure their own
+func (cfg *Config) LeaseDatabase() lease.Database {
+	if cfg.Database == nil && cfg.parent != nil {
+		return cfg.parent.LeaseDatabase()
+	}
+
+	return cfg.Database
+}
+
+// AddRanges adds dynamic ranges and the addresses excluded from them
+// to the configuration
+func (cfg *Config) AddRanges(ranges, excluded iprange.IPRanges) {
+	// Merge sorts its argument so the current ranges must not be
+	// passed directly
+	cfg.Ranges = iprange.Merge(append(append(iprange.IPRanges{}, cfg.Ranges...), ranges...))
+	cfg.Excluded = iprange.Merge(append(append(iprange.IPRanges{}, cfg.Excluded...), excluded...))
 }
 
 // AddPlugin adds a new plugin to the middleware chain
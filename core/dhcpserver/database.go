@@ -2,6 +2,13 @@ package dhcpserver
 
 import "github.com/nextdhcp/nextdhcp/core/lease/storage"
 
+// backgroundDatabase is implemented by lease databases that need to
+// run background tasks like scanning for expired leases
+type backgroundDatabase interface {
+	Start()
+	Stop()
+}
+
 func ensureDatabase(c *Config) error {
 	// If the database is already opened we can bail out
 	if c.Database != nil {
@@ -19,3 +26,22 @@ func ensureDatabase(c *Config) error {
 
 	return nil
 }
+
+// startDatabase starts background tasks of the lease database of c
+// once the instance has started and stops them on shutdown
+func (ctx *dhcpContext) startDatabase(c *Config) {
+	db, ok := c.Database.(backgroundDatabase)
+	if !ok || ctx.instance == nil {
+		return
+	}
+
+	ctx.instance.OnStartup = append(ctx.instance.OnStartup, func() error {
+		db.Start()
+		return nil
+	})
+
+	ctx.instance.OnShutdown = append(ctx.instance.OnShutdown, func() error {
+		db.Stop()
+		return nil
+	})
+}
@@ -5,13 +5,28 @@ var Directives = []string{
 	"log",
 	"database",
 	"interface",
+	"class",
+	"hostname",
+	"fqdn",
 	"gotify",
 	"mqtt",
+	"exec",
+	"webhook",
+	"ddns",
 	"option",
 	"servername",
+	"tftp",
+	"http-boot",
+	"dns",
 	"next-server",
 	"bootfile",
+	"provision",
+	"match",
 	"lease",
 	"static",
 	"range",
+
+	// hostsfile is set up last so static assignments are already
+	// reserved when the file is written on startup
+	"hostsfile",
 }
@@ -0,0 +1,92 @@
+package dhcpserver
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+const (
+	// headerLen is the length of the fixed BOOTP header including
+	// the DHCP magic cookie
+	headerLen = 240
+
+	// bootpMinLen is the minimum length of a BOOTP message as
+	// defined in RFC 951
+	bootpMinLen = 300
+)
+
+// marshalResponse serializes res. Unlike dhcpv4.DHCPv4.ToBytes, which
+// always sorts options by code, options requested by req are encoded in
+// the order of the parameter request list since some client firmware
+// depends on that. The message type is always sent first and the relay
+// agent information last
+func marshalResponse(req, res *dhcpv4.DHCPv4) []byte {
+	raw := res.ToBytes()
+	buf := bytes.NewBuffer(append([]byte(nil), raw[:headerLen]...))
+
+	written := make(map[uint8]bool)
+	write := func(code uint8) {
+		data, ok := res.Options[code]
+		if !ok || written[code] {
+			return
+		}
+		written[code] = true
+		writeOption(buf, code, data)
+	}
+
+	write(dhcpv4.OptionDHCPMessageType.Code())
+
+	for _, code := range req.ParameterRequestList() {
+		if code.Code() != dhcpv4.OptionRelayAgentInformation.Code() {
+			write(code.Code())
+		}
+	}
+
+	var remaining []int
+	for code := range res.Options {
+		remaining = append(remaining, int(code))
+	}
+	sort.Ints(remaining)
+
+	for _, code := range remaining {
+		switch uint8(code) {
+		case dhcpv4.OptionRelayAgentInformation.Code(), dhcpv4.OptionPad.Code(), dhcpv4.OptionEnd.Code():
+		default:
+			write(uint8(code))
+		}
+	}
+
+	// RFC 3046 requires the relay agent information to be the last option
+	write(dhcpv4.OptionRelayAgentInformation.Code())
+
+	buf.WriteByte(dhcpv4.OptionEnd.Code())
+	if buf.Len() < bootpMinLen {
+		buf.Write(make([]byte, bootpMinLen-buf.Len()))
+	}
+
+	return buf.Bytes()
+}
+
+// writeOption writes a single option to buf. Values longer than 255 bytes
+// are split into multiple options as defined in RFC 3396
+func writeOption(buf *bytes.Buffer, code uint8, data []byte) {
+	if len(data) == 0 {
+		buf.WriteByte(code)
+		buf.WriteByte(0)
+		return
+	}
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > 255 {
+			n = 255
+		}
+
+		buf.WriteByte(code)
+		buf.WriteByte(uint8(n))
+		buf.Write(data[:n])
+		data = data[n:]
+	}
+}
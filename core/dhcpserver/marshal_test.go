@@ -0,0 +1,59 @@
+package dhcpserver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// optionCodes returns the option codes of a serialized message in the
+// order they appear
+func optionCodes(b []byte) []uint8 {
+	var codes []uint8
+	for i := headerLen; i < len(b); {
+		code := b[i]
+		if code == dhcpv4.OptionPad.Code() {
+			i++
+			continue
+		}
+		if code == dhcpv4.OptionEnd.Code() {
+			break
+		}
+		codes = append(codes, code)
+		i += 2 + int(b[i+1])
+	}
+	return codes
+}
+
+func TestMarshalResponse(t *testing.T) {
+	req, err := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	require.NoError(t, err)
+	req.UpdateOption(dhcpv4.OptParameterRequestList(
+		dhcpv4.OptionTFTPServerName,
+		dhcpv4.OptionRouter,
+		dhcpv4.OptionSubnetMask,
+	))
+
+	res, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+	res.UpdateOption(dhcpv4.OptSubnetMask(net.IPv4Mask(255, 255, 255, 0)))
+	res.UpdateOption(dhcpv4.OptRouter(net.IP{10, 0, 0, 1}))
+	res.UpdateOption(dhcpv4.OptTFTPServerName("tftp.example.com"))
+	res.UpdateOption(dhcpv4.OptServerIdentifier(net.IP{10, 0, 0, 1}))
+	res.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionRelayAgentInformation, []byte{1, 1, 0}))
+	res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	res.UpdateOption(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(224), make([]byte, 300)))
+
+	b := marshalResponse(req, res)
+	assert.Equal(t, []uint8{53, 66, 3, 1, 54, 224, 224, 82}, optionCodes(b))
+
+	// the message must still be parsable and carry the same options
+	parsed, err := dhcpv4.FromBytes(b)
+	require.NoError(t, err)
+	assert.Equal(t, res.Options, parsed.Options)
+	assert.Equal(t, res.ClientHWAddr, parsed.ClientHWAddr)
+	assert.True(t, len(b) >= bootpMinLen)
+}
@@ -0,0 +1,68 @@
+package dhcpserver
+
+import (
+	"github.com/caddyserver/caddy"
+	"github.com/caddyserver/caddy/caddyfile"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+// SetupNested executes the directives of a nested configuration block
+// inside the server block of c. tokens holds the tokens of each directive
+// like caddyfile.ServerBlock.Tokens. Directives are executed in the order
+// of Directives using a child configuration that inherits all settings of
+// the server block but has its own list of plugins. Settings changed by
+// the nested directives are not copied back to the server block except
+// for the dynamic ranges, which are added to the ranges of the server
+// block once all directives have been executed. Nested plugins use the lease database of the server block, see
+// Config.LeaseDatabase. The returned plugin.Plugin builds the middleware
+// chain of the nested block in front of the handler passed to it
+func SetupNested(c *caddy.Controller, tokens map[string][]caddyfile.Token) (plugin.Plugin, error) {
+	ctx := c.Context().(*dhcpContext)
+	key := keyForConfig(c.ServerBlockIndex)
+
+	parent := ctx.keyToConfig[key]
+	child := new(Config)
+	*child = *parent
+	child.plugins = nil
+	child.chain = nil
+	child.parent = parent
+
+	// plugins get their configuration using GetConfig so the child
+	// replaces the configuration of the server block while the
+	// nested directives are executed
+	ctx.keyToConfig[key] = child
+	defer func() {
+		ctx.keyToConfig[key] = parent
+	}()
+
+	for _, dir := range Directives {
+		toks, ok := tokens[dir]
+		if !ok {
+			continue
+		}
+
+		setup, err := caddy.DirectiveAction(serverType, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		nested := *c
+		nested.Dispenser = caddyfile.NewDispenserTokens(c.File(), toks)
+
+		if err := setup(&nested); err != nil {
+			return nil, err
+		}
+	}
+
+	// plugins like static need to know about all dynamic ranges of
+	// the subnet
+	parent.AddRanges(child.Ranges, child.Excluded)
+
+	return func(next plugin.Handler) plugin.Handler {
+		chain := next
+		for i := len(child.plugins) - 1; i >= 0; i-- {
+			chain = child.plugins[i](chain)
+		}
+		return chain
+	}, nil
+}
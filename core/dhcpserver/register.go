@@ -28,11 +28,13 @@ func init() {
 
 func newContext(i *caddy.Instance) caddy.Context {
 	return &dhcpContext{
+		instance:    i,
 		keyToConfig: make(map[string]*Config),
 	}
 }
 
 type dhcpContext struct {
+	instance    *caddy.Instance
 	configs     []*Config
 	keyToConfig map[string]*Config
 }
@@ -109,6 +111,7 @@ func (c *dhcpContext) InspectServerBlocks(sourceFile string, serverBlocks []cadd
 }
 
 func (c *dhcpContext) MakeServers() ([]caddy.Server, error) {
+	ctx := c
 	for _, c := range c.configs {
 		if !findInterface(c) {
 			return nil, fmt.Errorf("failed to find interface for subnet %s", c.Network.String())
@@ -117,6 +120,7 @@ func (c *dhcpContext) MakeServers() ([]caddy.Server, error) {
 		if err := ensureDatabase(c); err != nil {
 			return nil, fmt.Errorf("failed to open database for subnet %s: %s", c.Network.String(), err.Error())
 		}
+		ctx.startDatabase(c)
 
 		if err := buildMiddlewareChain(c); err != nil {
 			return nil, fmt.Errorf("failed to build middleware chain for subnet %s: %s", c.Network.String(), err.Error())
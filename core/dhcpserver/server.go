@@ -176,7 +176,7 @@ func (s *Server) serveDHCPv4(c net.PacketConn, payload []byte, addr net.Addr) er
 
 	cfg.logger.Debugf("<- %s to %s (%s)", resp.MessageType(), addr, msg.HostName())
 
-	response := resp.ToBytes()
+	response := marshalResponse(msg, resp)
 	_, err = c.WriteTo(response, addr)
 	return err
 }
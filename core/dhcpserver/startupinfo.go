@@ -7,6 +7,14 @@ func getStartupInfo(cfg []*Config) string {
 
 	for _, c := range cfg {
 		s += fmt.Sprintf("\t%s on %s (%s)\n", c.Network.String(), c.IP, c.Interface.Name)
+
+		for _, r := range c.Ranges {
+			s += fmt.Sprintf("\t\trange %s\n", r)
+		}
+
+		for _, r := range c.Excluded {
+			s += fmt.Sprintf("\t\texcluded %s\n", r)
+		}
 	}
 
 	if s != "" {
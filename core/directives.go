@@ -3,15 +3,27 @@ package core
 import (
 	// Include all built-in directives
 	_ "github.com/nextdhcp/nextdhcp/plugin/bootfile"
+	_ "github.com/nextdhcp/nextdhcp/plugin/classes"
+	_ "github.com/nextdhcp/nextdhcp/plugin/clientfqdn"
 	_ "github.com/nextdhcp/nextdhcp/plugin/database"
+	_ "github.com/nextdhcp/nextdhcp/plugin/ddns"
+	_ "github.com/nextdhcp/nextdhcp/plugin/dnsserver"
+	_ "github.com/nextdhcp/nextdhcp/plugin/exec"
 	_ "github.com/nextdhcp/nextdhcp/plugin/gotify"
+	_ "github.com/nextdhcp/nextdhcp/plugin/hostname"
+	_ "github.com/nextdhcp/nextdhcp/plugin/hostsfile"
+	_ "github.com/nextdhcp/nextdhcp/plugin/httpboot"
 	_ "github.com/nextdhcp/nextdhcp/plugin/ifname"
 	_ "github.com/nextdhcp/nextdhcp/plugin/lease"
 	_ "github.com/nextdhcp/nextdhcp/plugin/log"
+	_ "github.com/nextdhcp/nextdhcp/plugin/match"
 	_ "github.com/nextdhcp/nextdhcp/plugin/mqtt"
 	_ "github.com/nextdhcp/nextdhcp/plugin/nextserver"
 	_ "github.com/nextdhcp/nextdhcp/plugin/option"
+	_ "github.com/nextdhcp/nextdhcp/plugin/provision"
 	_ "github.com/nextdhcp/nextdhcp/plugin/ranges"
 	_ "github.com/nextdhcp/nextdhcp/plugin/servername"
 	_ "github.com/nextdhcp/nextdhcp/plugin/static"
+	_ "github.com/nextdhcp/nextdhcp/plugin/tftp"
+	_ "github.com/nextdhcp/nextdhcp/plugin/webhook"
 )
@@ -0,0 +1,68 @@
+// Package dnsname converts and validates the hostnames of clients
+// as DNS labels
+package dnsname
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLabelLength is the maximum length of a RFC 1123 label
+const MaxLabelLength = 63
+
+// labelRegexp matches valid RFC 1123 labels
+var labelRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Sanitize converts name to a valid RFC 1123 label. Only the first label
+// of name is used, letters are converted to lower case and accents are
+// removed. Spaces, underscores and other separators are replaced with
+// dashes while all other characters are dropped. An empty string is
+// returned if nothing remains
+func Sanitize(name string) string {
+	if idx := strings.Index(name, "."); idx >= 0 {
+		name = name[:idx]
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(name) {
+		r = unicode.ToLower(r)
+
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		case r == '-', r == '_', unicode.IsSpace(r), unicode.IsPunct(r) && r != '\'':
+			dash = true
+		}
+	}
+
+	label := b.String()
+	if len(label) > MaxLabelLength {
+		label = strings.TrimRight(label[:MaxLabelLength], "-")
+	}
+
+	return label
+}
+
+// Label returns the first label of name in lower case. Unlike Sanitize
+// the label is not converted and an empty string is returned if it is
+// not a valid RFC 1123 label
+func Label(name string) string {
+	name = strings.ToLower(name)
+	if idx := strings.Index(name, "."); idx >= 0 {
+		name = name[:idx]
+	}
+
+	if !labelRegexp.MatchString(name) {
+		return ""
+	}
+
+	return name
+}
@@ -0,0 +1,49 @@
+package dnsname
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		I string
+		O string
+	}{
+		{"lab", "lab"},
+		{"Lab-PC", "lab-pc"},
+		{"Jürgen's PC", "jurgens-pc"},
+		{"my_laptop", "my-laptop"},
+		{"  --office  printer-- ", "office-printer"},
+		{"lab.example.com", "lab"},
+		{"ΩΩΩ", ""},
+		{"", ""},
+		{strings.Repeat("a", 70), strings.Repeat("a", 63)},
+		{strings.Repeat("a", 62) + "_b", strings.Repeat("a", 62)},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.O, Sanitize(c.I), c.I)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	cases := []struct {
+		I string
+		O string
+	}{
+		{"lab", "lab"},
+		{"Lab-PC.example.com", "lab-pc"},
+		{"my_laptop", ""},
+		{"-lab", ""},
+		{"", ""},
+		{strings.Repeat("a", 63), strings.Repeat("a", 63)},
+		{strings.Repeat("a", 64), ""},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.O, Label(c.I), c.I)
+	}
+}
@@ -1,11 +1,16 @@
 package events
 
 import (
+	"context"
 	"log"
 	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
 )
 
 const (
@@ -15,16 +20,65 @@ const (
 	// EventLeaseCreated is emitted when an address has been bound
 	// to a client
 	EventLeaseCreated = "lease-created"
+
+	// EventLeaseRenewed is emitted when a client extended an
+	// existing lease
+	EventLeaseRenewed = "lease-renewed"
+
+	// EventLeaseReleased is emitted when a client released its
+	// address lease
+	EventLeaseReleased = "lease-released"
+
+	// EventLeaseDeclined is emitted when a client declined an
+	// address that has been offered or leased to it
+	EventLeaseDeclined = "lease-declined"
+
+	// EventReservationExpired is emitted when an address reservation
+	// expired before the client leased the address
+	EventReservationExpired = "reservation-expired"
+
+	// EventAddressConflict is emitted when a client declines an
+	// address because it is already used by a different host
+	EventAddressConflict = "address-conflict"
 )
 
+// EventRequest is not emitted as a caddy event. It is used by plugins like
+// exec or webhook to select DHCP requests next to lease events
+const EventRequest caddy.EventName = "request"
+
+// Keys holds all replacer keys that are available for lease events
+// and DHCP requests
+var Keys = []string{
+	"event",
+	"msgtype",
+	"yourip",
+	"clientip",
+	"hwaddr",
+	"oui",
+	"requestedip",
+	"hostname",
+	"gwip",
+	"state",
+	"classes",
+	"fqdn",
+	"domain",
+	"clientid",
+	"expires",
+}
+
 type (
 	// LeaseEventHook is the function type that can receive lease-based events
 	LeaseEventHook func(event caddy.EventName, l *lease.Lease) error
 )
 
 var validLeaseEvents = map[caddy.EventName]struct{}{
-	EventLeaseCreated: {},
-	EventLeaseExpired: {},
+	EventLeaseCreated:       {},
+	EventLeaseRenewed:       {},
+	EventLeaseReleased:      {},
+	EventLeaseDeclined:      {},
+	EventLeaseExpired:       {},
+	EventReservationExpired: {},
+	EventAddressConflict:    {},
 }
 
 // EmitLeaseEvent emits a lease-based event
@@ -38,6 +92,180 @@ func EmitLeaseEvent(event caddy.EventName, l *lease.Lease) {
 	caddy.EmitEvent(event, l)
 }
 
+type deferredKey struct{}
+
+type deferredEvent struct {
+	event caddy.EventName
+	lease *lease.Lease
+}
+
+// Deferred holds lease events that have been emitted for a context
+// returned by WithDeferred. They are emitted once Flush is called
+type Deferred struct {
+	parent context.Context
+
+	l      sync.Mutex
+	events []deferredEvent
+}
+
+// WithDeferred returns a new context that defers all lease events emitted
+// using EmitLeaseEventContext until Flush is called on the returned
+// Deferred. It allows plugins to revoke changes of the lease database
+// without emitting events for them
+func WithDeferred(ctx context.Context) (context.Context, *Deferred) {
+	d := &Deferred{parent: ctx}
+	return context.WithValue(ctx, deferredKey{}, d), d
+}
+
+// EmitLeaseEventContext emits a lease-based event. If ctx has been
+// returned by WithDeferred the event is deferred
+func EmitLeaseEventContext(ctx context.Context, event caddy.EventName, l *lease.Lease) {
+	if d, ok := ctx.Value(deferredKey{}).(*Deferred); ok {
+		d.l.Lock()
+		d.events = append(d.events, deferredEvent{event, l})
+		d.l.Unlock()
+		return
+	}
+
+	EmitLeaseEvent(event, l)
+}
+
+// Has returns true if event has been deferred
+func (d *Deferred) Has(event caddy.EventName) bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	for _, e := range d.events {
+		if e.event == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Flush emits all deferred events in order. If the parent context
+// defers events as well they are passed on
+func (d *Deferred) Flush() {
+	d.l.Lock()
+	list := d.events
+	d.events = nil
+	d.l.Unlock()
+
+	for _, e := range list {
+		EmitLeaseEventContext(d.parent, e.event, e.lease)
+	}
+}
+
+// Discard drops all deferred events
+func (d *Deferred) Discard() {
+	d.l.Lock()
+	d.events = nil
+	d.l.Unlock()
+}
+
+var (
+	subscribersLock sync.RWMutex
+	subscribers     = make(map[int]LeaseEventHook)
+	nextSubscriber  int
+)
+
+func init() {
+	caddy.RegisterEventHook("nextdhcp-lease-subscribers", func(e caddy.EventName, value interface{}) error {
+		if _, ok := validLeaseEvents[e]; !ok {
+			return nil
+		}
+
+		l, ok := value.(*lease.Lease)
+		if !ok {
+			return nil
+		}
+
+		subscribersLock.RLock()
+		hooks := make([]LeaseEventHook, 0, len(subscribers))
+		for _, hook := range subscribers {
+			hooks = append(hooks, hook)
+		}
+		subscribersLock.RUnlock()
+
+		for _, hook := range hooks {
+			if err := hook(e, l); err != nil {
+				log.Printf("lease event hook failed for %s: %s", e, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Subscribe registers hook for all lease events and returns a function
+// that removes the subscription. Unlike RegisterLeaseEventHook it may be
+// used by plugins that are set up again whenever the server restarts
+func Subscribe(hook LeaseEventHook) func() {
+	subscribersLock.Lock()
+	defer subscribersLock.Unlock()
+
+	id := nextSubscriber
+	nextSubscriber++
+	subscribers[id] = hook
+
+	return func() {
+		subscribersLock.Lock()
+		defer subscribersLock.Unlock()
+
+		delete(subscribers, id)
+	}
+}
+
+// IsLeaseEvent returns true if event is a valid lease event
+func IsLeaseEvent(event caddy.EventName) bool {
+	_, ok := validLeaseEvents[event]
+	return ok
+}
+
+// NewReplacer returns a replacer for lease events. Besides the hardware
+// address and the leased address (yourip) the keys event, clientid and
+// expires are available
+func NewReplacer(event caddy.EventName, l *lease.Lease) replacer.Replacer {
+	msg := &dhcpv4.DHCPv4{
+		ClientHWAddr: l.HwAddr,
+		YourIPAddr:   l.Address,
+		Options:      make(dhcpv4.Options),
+	}
+
+	rep := replacer.NewReplacer(context.Background(), msg)
+	rep.Set("msgtype", replacer.StringValue(""))
+	rep.Set("state", replacer.StringValue(""))
+	rep.Set("event", replacer.StringValue(event))
+	rep.Set("clientid", replacer.StringValue(l.ID))
+	rep.Set("expires", replacer.StringValue(l.Expires.Format(time.RFC3339)))
+
+	return rep
+}
+
+// NewRequestReplacer returns a replacer for req that uses the address and
+// lease time of the response res. Like for lease events the keys event,
+// clientid and expires are available
+func NewRequestReplacer(ctx context.Context, req, res *dhcpv4.DHCPv4) replacer.Replacer {
+	rep := replacer.NewReplacer(ctx, req)
+	rep.Set("event", replacer.StringValue(EventRequest))
+	rep.Set("clientid", replacer.StringValue(req.ClientHWAddr.String()))
+
+	yourIP := ""
+	if res.YourIPAddr != nil && !res.YourIPAddr.IsUnspecified() {
+		yourIP = res.YourIPAddr.String()
+	}
+	rep.Set("yourip", replacer.StringValue(yourIP))
+
+	expires := ""
+	if d := res.IPAddressLeaseTime(0); d > 0 && yourIP != "" {
+		expires = time.Now().Add(d).Format(time.RFC3339)
+	}
+	rep.Set("expires", replacer.StringValue(expires))
+
+	return rep
+}
+
 // RegisterLeaseEventHook registers a new lease event hook
 func RegisterLeaseEventHook(name string, event caddy.EventName, hook LeaseEventHook) {
 	if _, ok := validLeaseEvents[event]; !ok {
@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"net"
 	"sync"
 	"testing"
@@ -99,3 +100,79 @@ func TestRegisterLeaseEventHook_panic(t *testing.T) {
 		RegisterLeaseEventHook("should-panic-hook", "invalid-event-type", nil)
 	})
 }
+
+func TestSubscribe(t *testing.T) {
+	var received []caddy.EventName
+	unsubscribe := Subscribe(func(e caddy.EventName, l *lease.Lease) error {
+		if l.ID == "subscribe-test" {
+			received = append(received, e)
+		}
+		return nil
+	})
+
+	l := &lease.Lease{Client: lease.Client{ID: "subscribe-test"}}
+	EmitLeaseEvent(EventLeaseCreated, l)
+	EmitLeaseEvent(EventLeaseReleased, l)
+	assert.Equal(t, []caddy.EventName{EventLeaseCreated, EventLeaseReleased}, received)
+
+	unsubscribe()
+	EmitLeaseEvent(EventLeaseCreated, l)
+	assert.Len(t, received, 2)
+}
+
+func TestDeferred(t *testing.T) {
+	var received []caddy.EventName
+	unsubscribe := Subscribe(func(e caddy.EventName, l *lease.Lease) error {
+		if l.ID == "deferred-test" {
+			received = append(received, e)
+		}
+		return nil
+	})
+	defer unsubscribe()
+
+	l := &lease.Lease{Client: lease.Client{ID: "deferred-test"}}
+
+	outer, d1 := WithDeferred(context.Background())
+	inner, d2 := WithDeferred(outer)
+
+	EmitLeaseEventContext(inner, EventLeaseCreated, l)
+	assert.True(t, d2.Has(EventLeaseCreated))
+	assert.False(t, d2.Has(EventLeaseReleased))
+	assert.Empty(t, received)
+
+	// flushed events are passed to the outer context
+	d2.Flush()
+	assert.Empty(t, received)
+	assert.True(t, d1.Has(EventLeaseCreated))
+
+	d1.Flush()
+	assert.Equal(t, []caddy.EventName{EventLeaseCreated}, received)
+
+	// discarded events are never emitted
+	EmitLeaseEventContext(outer, EventLeaseReleased, l)
+	d1.Discard()
+	d1.Flush()
+	assert.Len(t, received, 1)
+
+	EmitLeaseEventContext(context.Background(), EventLeaseReleased, l)
+	assert.Len(t, received, 2)
+}
+
+func TestNewReplacer(t *testing.T) {
+	expires := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	rep := NewReplacer(EventLeaseExpired, &lease.Lease{
+		Client: lease.Client{
+			ID:     "de:ad:be:ef:00:01",
+			HwAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01},
+		},
+		Address: net.IP{10, 0, 0, 1},
+		Expires: expires,
+	})
+
+	assert.Equal(t, "lease-expired 10.0.0.1 de:ad:be:ef:00:01 de:ad:be 2020-01-02T03:04:05Z",
+		rep.Replace("{event} {yourip} {hwaddr} {oui} {expires}"))
+	assert.Equal(t, "", rep.Get("msgtype"))
+	assert.Equal(t, "de:ad:be:ef:00:01", rep.Get("clientid"))
+	assert.True(t, IsLeaseEvent(EventLeaseRenewed))
+	assert.False(t, IsLeaseEvent("request"))
+}
@@ -0,0 +1,168 @@
+// Package fqdn implements the DHCP client FQDN option (option 81)
+// as defined in RFC 4702
+package fqdn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+const (
+	// FlagS indicates that the server should perform the A record
+	// update
+	FlagS byte = 1 << iota
+
+	// FlagO is set by the server if it overrides the S flag of the
+	// client
+	FlagO
+
+	// FlagE indicates that the name is encoded in canonical wire
+	// format
+	FlagE
+
+	// FlagN indicates that the server should not perform any DNS
+	// updates
+	FlagN
+)
+
+// ErrInvalidOption is returned if the option cannot be parsed
+var ErrInvalidOption = errors.New("invalid client FQDN option")
+
+// Option is the client FQDN option. It implements dhcpv4.OptionValue
+type Option struct {
+	// Flags holds the S, O, E and N flags
+	Flags byte
+
+	// RCode1 and RCode2 are deprecated and always set to 255 by
+	// servers
+	RCode1 byte
+	RCode2 byte
+
+	// Name is the domain name of the client. Fully qualified names
+	// end with a dot
+	Name string
+}
+
+// Has returns true if flag is set
+func (o *Option) Has(flag byte) bool {
+	return o.Flags&flag != 0
+}
+
+// FullyQualified returns true if Name is a fully qualified domain name
+func (o *Option) FullyQualified() bool {
+	return strings.HasSuffix(o.Name, ".")
+}
+
+// Host returns the left-most label of the name in lower case
+func (o *Option) Host() string {
+	host := strings.TrimSuffix(o.Name, ".")
+	if idx := strings.Index(host, "."); idx >= 0 {
+		host = host[:idx]
+	}
+
+	return strings.ToLower(host)
+}
+
+// ToBytes returns the option data and implements dhcpv4.OptionValue
+func (o *Option) ToBytes() []byte {
+	data := []byte{o.Flags, o.RCode1, o.RCode2}
+	if !o.Has(FlagE) {
+		return append(data, o.Name...)
+	}
+
+	name := strings.TrimSuffix(o.Name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			data = append(data, byte(len(label)))
+			data = append(data, label...)
+		}
+	}
+
+	if o.FullyQualified() {
+		data = append(data, 0)
+	}
+
+	return data
+}
+
+// String implements fmt.Stringer and dhcpv4.OptionValue
+func (o *Option) String() string {
+	var flags []string
+	for _, f := range []struct {
+		flag byte
+		name string
+	}{
+		{FlagS, "S"},
+		{FlagO, "O"},
+		{FlagE, "E"},
+		{FlagN, "N"},
+	} {
+		if o.Has(f.flag) {
+			flags = append(flags, f.name)
+		}
+	}
+
+	return fmt.Sprintf("%s (flags=%s)", o.Name, strings.Join(flags, ","))
+}
+
+// Parse parses the data of a client FQDN option
+func Parse(data []byte) (*Option, error) {
+	if len(data) < 3 {
+		return nil, ErrInvalidOption
+	}
+
+	o := &Option{
+		Flags:  data[0],
+		RCode1: data[1],
+		RCode2: data[2],
+	}
+	data = data[3:]
+
+	if !o.Has(FlagE) {
+		o.Name = string(data)
+		return o, nil
+	}
+
+	var labels []string
+	for len(data) > 0 {
+		l := int(data[0])
+		if l == 0 {
+			// a terminating zero-length label marks a fully
+			// qualified name
+			if len(data) != 1 {
+				return nil, ErrInvalidOption
+			}
+			o.Name = strings.Join(labels, ".") + "."
+			return o, nil
+		}
+
+		if l > 63 || len(data) < l+1 {
+			return nil, ErrInvalidOption
+		}
+
+		labels = append(labels, string(data[1:l+1]))
+		data = data[l+1:]
+	}
+
+	o.Name = strings.Join(labels, ".")
+	return o, nil
+}
+
+// FromRequest returns the client FQDN option of req or nil if the
+// option is not set or invalid
+func FromRequest(req *dhcpv4.DHCPv4) *Option {
+	data := req.Options.Get(dhcpv4.OptionFQDN)
+	if data == nil {
+		return nil
+	}
+
+	o, err := Parse(data)
+	if err != nil {
+		return nil
+	}
+
+	return o
+}
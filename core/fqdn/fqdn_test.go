@@ -0,0 +1,108 @@
+package fqdn
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		I []byte
+		O *Option
+	}{
+		{
+			I: []byte{0x01, 0, 0, 'l', 'a', 'b'},
+			O: &Option{Flags: FlagS, Name: "lab"},
+		},
+		{
+			I: []byte{0x05, 0, 0, 3, 'l', 'a', 'b', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0},
+			O: &Option{Flags: FlagS | FlagE, Name: "lab.example."},
+		},
+		{
+			I: []byte{0x0c, 255, 255, 3, 'l', 'a', 'b'},
+			O: &Option{Flags: FlagE | FlagN, RCode1: 255, RCode2: 255, Name: "lab"},
+		},
+		{
+			I: []byte{0x04, 0, 0},
+			O: &Option{Flags: FlagE},
+		},
+	}
+
+	for _, c := range cases {
+		o, err := Parse(c.I)
+		require.NoError(t, err, c.I)
+		assert.Equal(t, c.O, o)
+		assert.Equal(t, c.I, o.ToBytes())
+	}
+
+	for _, input := range [][]byte{
+		nil,
+		{0x01, 0},
+		{0x04, 0, 0, 4, 'l', 'a', 'b'},
+		{0x04, 0, 0, 3, 'l', 'a', 'b', 0, 1},
+	} {
+		_, err := Parse(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestOption(t *testing.T) {
+	o := &Option{Flags: FlagS | FlagE, Name: "Lab.Example.com."}
+	assert.True(t, o.Has(FlagS))
+	assert.False(t, o.Has(FlagN))
+	assert.True(t, o.FullyQualified())
+	assert.Equal(t, "lab", o.Host())
+	assert.Equal(t, "Lab.Example.com. (flags=S,E)", o.String())
+
+	req, err := dhcpv4.New(dhcpv4.WithHwAddr(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}))
+	require.NoError(t, err)
+	assert.Nil(t, FromRequest(req))
+
+	req.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionFQDN, Value: o})
+	assert.Equal(t, o, FromRequest(req))
+}
+
+func TestPolicyReply(t *testing.T) {
+	cases := []struct {
+		P      Policy
+		Client *Option
+		Flags  byte
+	}{
+		{PolicyServerUpdates, &Option{Flags: FlagS}, FlagS},
+		{PolicyServerUpdates, &Option{Flags: FlagE}, FlagS | FlagO | FlagE},
+		{PolicyServerUpdates, &Option{Flags: FlagN}, FlagS | FlagO},
+		{PolicyServerUpdates, nil, FlagS},
+		{PolicyClientUpdates, &Option{Flags: FlagS}, FlagO},
+		{PolicyClientUpdates, &Option{}, 0},
+		{PolicyClientUpdates, &Option{Flags: FlagN | FlagE}, FlagN | FlagE},
+		{PolicyClientUpdates, nil, FlagS},
+		{PolicyNoUpdates, &Option{Flags: FlagS}, FlagN | FlagO},
+		{PolicyNoUpdates, &Option{}, FlagN},
+	}
+
+	for i, c := range cases {
+		reply := c.P.Reply(c.Client, "lab.example.com.")
+		assert.Equal(t, c.Flags, reply.Flags, "case #%d", i)
+		assert.Equal(t, "lab.example.com.", reply.Name)
+		assert.Equal(t, byte(255), reply.RCode1)
+		assert.Equal(t, byte(255), reply.RCode2)
+	}
+
+	for _, p := range []Policy{PolicyServerUpdates, PolicyClientUpdates, PolicyNoUpdates} {
+		parsed, err := ParsePolicy(p.String())
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+	_, err := ParsePolicy("everyone")
+	assert.Error(t, err)
+}
+
+func TestDomain(t *testing.T) {
+	assert.Equal(t, "example.com", Domain("lab.example.com."))
+	assert.Equal(t, "example.com", Domain("lab.example.com"))
+	assert.Equal(t, "", Domain("lab"))
+}
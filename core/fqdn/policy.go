@@ -0,0 +1,113 @@
+package fqdn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Policy decides who is responsible for DNS updates
+type Policy int
+
+const (
+	// PolicyServerUpdates lets the server update the A and PTR
+	// records of all clients
+	PolicyServerUpdates Policy = iota
+
+	// PolicyClientUpdates lets clients update their A record while
+	// the server updates the PTR record
+	PolicyClientUpdates
+
+	// PolicyNoUpdates disables all DNS updates
+	PolicyNoUpdates
+)
+
+var policyNames = map[Policy]string{
+	PolicyServerUpdates: "server-updates",
+	PolicyClientUpdates: "client-updates",
+	PolicyNoUpdates:     "no-updates",
+}
+
+// String implements fmt.Stringer
+func (p Policy) String() string {
+	return policyNames[p]
+}
+
+// ParsePolicy parses the name of a policy
+func ParsePolicy(s string) (Policy, error) {
+	for p, name := range policyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown policy %q", s)
+}
+
+// Reply returns the client FQDN option the server should reply with
+// for the option o sent by the client and the domain name of the client.
+// Clients that did not send the option are handled like clients that
+// do not update their records themselves
+func (p Policy) Reply(o *Option, name string) *Option {
+	reply := &Option{
+		RCode1: 255,
+		RCode2: 255,
+		Name:   name,
+	}
+
+	var client byte
+	if o != nil {
+		client = o.Flags
+		reply.Flags = o.Flags & FlagE
+	} else {
+		client = FlagS
+	}
+
+	switch {
+	case p == PolicyNoUpdates:
+		reply.Flags |= FlagN
+	case p == PolicyClientUpdates && client&FlagN != 0:
+		reply.Flags |= FlagN
+		return reply
+	case p == PolicyServerUpdates, o == nil:
+		reply.Flags |= FlagS
+	}
+
+	// tell the client that we did not do what it asked for
+	if reply.Flags&FlagS != client&FlagS {
+		reply.Flags |= FlagO
+	}
+
+	return reply
+}
+
+// Key is used to associate the server's decision about DNS updates
+// with a context.Context
+type Key struct{}
+
+// WithReply returns a new context that holds the reply decided for
+// the client
+func WithReply(ctx context.Context, reply *Option) context.Context {
+	return context.WithValue(ctx, Key{}, reply)
+}
+
+// FromContext returns the reply decided for the client or nil
+func FromContext(ctx context.Context) *Option {
+	val := ctx.Value(Key{})
+	if val == nil {
+		return nil
+	}
+
+	return val.(*Option)
+}
+
+// Domain returns the domain of name which is everything after the
+// first label
+func Domain(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	if idx := strings.Index(name, "."); idx >= 0 {
+		return name[idx+1:]
+	}
+
+	return ""
+}
@@ -19,18 +19,24 @@ var (
 
 	// ErrInvalidAddress indicates that the IP address is invalid
 	ErrInvalidAddress = errors.New("invalid IP address")
+
+	// ErrAddressStatic indicates that the requested IP address is statically
+	// assigned to a different client
+	ErrAddressStatic = errors.New("IP is statically assigned to a different client")
 )
 
 // Database describes a lease database interface
 type Database interface {
 	// Leases returns all registered and not-yet-released IP address
-	// leases. IP leases that are already expired are returned as well
+	// leases. IP leases that are already expired are returned as well.
+	// Static reservations are returned as leases that expire at Never
 	Leases(context.Context) ([]Lease, error)
 
 	// ReservedAddresses returns a slice of currently reserved IP
 	// addresses. These addresses will not be used when search for
 	// available addresses. Reservations that already expired are
-	// returned as well
+	// returned as well. Static reservations don't have an expiration
+	// time
 	ReservedAddresses(context.Context) (ReservedAddressList, error)
 
 	// Reserve tries to reserve the IP address for a client
@@ -56,8 +62,32 @@ type Database interface {
 	// checked and any reservation for the client is removed
 	Release(context.Context, net.IP) error
 
+	// Decline removes the lease or reservation of the IP address for
+	// a client that declined it. The address is held back for the
+	// given duration so it is not handed out to other clients
+	Decline(context.Context, net.IP, Client, time.Duration) error
+
 	// DeleteReservation deletes a IP address reservation
 	DeleteReservation(context.Context, net.IP, *Client) error
+
+	// FindByClient returns the IP address that is leased or reserved
+	// for the client, if the address is leased and when the lease or
+	// reservation expires. If there's no entry for the client a nil IP
+	// address is returned
+	FindByClient(context.Context, Client) (net.IP, bool, time.Time, error)
+
+	// FindByIP returns the lease of the IP address. Like with Leases,
+	// expired leases are returned as well and static reservations are
+	// returned as leases that expire at Never. Other reservations are
+	// ignored. If there's no lease for the IP address nil is returned
+	FindByIP(context.Context, net.IP) (*Lease, error)
+
+	// ReserveStatic stores a non-expiring reservation of the IP address
+	// for a client with a static IP address assignment. Any other lease
+	// or reservation of the IP address or the client is replaced. Static
+	// reservations cannot be reserved or leased by other clients and are
+	// not released. They are only removed using DeleteReservation
+	ReserveStatic(context.Context, net.IP, Client) error
 }
 
 // Key is a key used to associate a Database with
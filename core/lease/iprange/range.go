@@ -226,49 +226,27 @@ func DeleteFrom(delete *IPRange, ranges []*IPRange) []*IPRange {
 		currStart, _ := IP2Int(ranges[i].Start)
 		currEnd, _ := IP2Int(ranges[i].End)
 
-		// skip ranges that cannot contain the range to delete
-		if deleteStart > currEnd {
-			continue
-		}
-
-		// do an early exit if no more matching range
-		// can exist
-		if deleteEnd < currStart {
-			break
-		}
-
-		startInRange := deleteStart >= currStart && deleteStart <= currEnd
-		endInRange := deleteEnd >= currStart && deleteEnd <= currEnd
-
-		// not in range: append and continue
-		if !startInRange && !endInRange {
+		// keep ranges that cannot contain the range to delete
+		if deleteStart > currEnd || deleteEnd < currStart {
 			stack = append(stack, ranges[i])
 			continue
 		}
 
-		// if true, cut down the end IP of the current range
-		if startInRange {
-			r := &IPRange{
+		// keep the part before the range to delete
+		if deleteStart > currStart {
+			stack = append(stack, &IPRange{
 				Start: ranges[i].Start,
 				End:   prevIP(delete.Start), // - 1
-			}
-
-			if r.Len() > 0 {
-				stack = append(stack, r)
-			}
+			})
 		}
 
-		if endInRange {
-			r := &IPRange{
+		// keep the part after the range to delete
+		if deleteEnd < currEnd {
+			stack = append(stack, &IPRange{
 				Start: nextIP(delete.End), // + 1
 				End:   ranges[i].End,
-			}
-
-			if r.Len() > 0 {
-				stack = append(stack, r)
-			}
+			})
 		}
-
 	}
 
 	return stack
@@ -307,6 +307,26 @@ func Test_deleteRange(t *testing.T) {
 				},
 			},
 		},
+
+		// #5 ranges that are not affected are retained and ranges
+		// that are covered entirely are removed
+		{
+			I: []*IPRange{
+				{Start: net.IP{10, 8, 0, 1}, End: net.IP{10, 8, 0, 9}},
+				{Start: net.IP{10, 8, 0, 12}, End: net.IP{10, 8, 0, 12}},
+				{Start: net.IP{10, 8, 0, 21}, End: net.IP{10, 8, 0, 100}},
+				{Start: net.IP{10, 8, 0, 200}, End: net.IP{10, 8, 0, 210}},
+			},
+			D: &IPRange{
+				Start: net.IP{10, 8, 0, 11},
+				End:   net.IP{10, 8, 0, 30},
+			},
+			E: []*IPRange{
+				{Start: net.IP{10, 8, 0, 1}, End: net.IP{10, 8, 0, 9}},
+				{Start: net.IP{10, 8, 0, 31}, End: net.IP{10, 8, 0, 100}},
+				{Start: net.IP{10, 8, 0, 200}, End: net.IP{10, 8, 0, 210}},
+			},
+		},
 	}
 
 	for i, c := range cases {
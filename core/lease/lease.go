@@ -5,6 +5,10 @@ import (
 	"time"
 )
 
+// Never is the expiration time of static reservations. Static reservations
+// never expire and are only removed when the static assignment is removed
+var Never = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+
 // Lease describes an IPv4 address that has been leased to a client
 type Lease struct {
 	// Client is the client that received the lease
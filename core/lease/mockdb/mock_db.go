@@ -49,5 +49,39 @@ func (m *MockDatabase) DeleteReservation(_ context.Context, ip net.IP, cli *leas
 	return m.Called(ip, cli).Error(0)
 }
 
+// FindByClient implements the lease.Database interface
+func (m *MockDatabase) FindByClient(_ context.Context, cli lease.Client) (net.IP, bool, time.Time, error) {
+	args := m.Called(cli)
+
+	var ip net.IP
+	if v := args.Get(0); v != nil {
+		ip = v.(net.IP)
+	}
+
+	return ip, args.Bool(1), args.Get(2).(time.Time), args.Error(3)
+}
+
+// FindByIP implements the lease.Database interface
+func (m *MockDatabase) FindByIP(_ context.Context, ip net.IP) (*lease.Lease, error) {
+	args := m.Called(ip)
+
+	var l *lease.Lease
+	if v := args.Get(0); v != nil {
+		l = v.(*lease.Lease)
+	}
+
+	return l, args.Error(1)
+}
+
+// Decline implements the lease.Database interface
+func (m *MockDatabase) Decline(_ context.Context, ip net.IP, cli lease.Client, hold time.Duration) error {
+	return m.Called(ip, cli, hold).Error(0)
+}
+
+// ReserveStatic implements the lease.Database interface
+func (m *MockDatabase) ReserveStatic(_ context.Context, ip net.IP, cli lease.Client) error {
+	return m.Called(ip, cli).Error(0)
+}
+
 // compile time check
 var _ lease.Database = &MockDatabase{}
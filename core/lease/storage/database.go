@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/nextdhcp/nextdhcp/core/events"
 	"github.com/nextdhcp/nextdhcp/core/lease"
 	dhcpLog "github.com/nextdhcp/nextdhcp/core/log"
 )
@@ -15,16 +17,53 @@ import (
 type Database struct {
 	store LeaseStorage
 	l     dhcpLog.Logger
+
+	// ExpiryInterval defines how often the database is scanned for
+	// expired leases and reservations once Start has been called.
+	// Defaults to DefaultExpiryInterval
+	ExpiryInterval time.Duration
+
+	// ReapInterval defines how often expired leases and reservations
+	// are removed from the database once Start has been called. The
+	// reaper is disabled if zero, which is the default. Expired leases
+	// are needed for the affinity of ranges so it's opt-in
+	ReapInterval time.Duration
+
+	// GracePeriod defines how long expired entries are kept before
+	// they are removed by the reaper. Defaults to DefaultGracePeriod
+	GracePeriod time.Duration
+
+	// Compact enables compaction of the storage after the reaper
+	// removed entries. It requires the storage to implement Compactor
+	Compact bool
+
+	// expired holds the expiration time of all entries for which an
+	// expiry event has already been emitted, keyed by IP address. It
+	// is persisted if the storage implements ExpiryStorage
+	expiredLock sync.Mutex
+	expired     map[string]time.Time
+
+	runLock sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
 }
 
 // NewDatabase creates a new database that uses store for persistence
 func NewDatabase(store LeaseStorage) *Database {
 	return &Database{
-		store: store,
-		l:     log.Log,
+		store:          store,
+		l:              log.Log,
+		ExpiryInterval: DefaultExpiryInterval,
+		GracePeriod:    DefaultGracePeriod,
+		expired:        make(map[string]time.Time),
 	}
 }
 
+// Storage returns the LeaseStorage used for persistence
+func (db *Database) Storage() LeaseStorage {
+	return db.store
+}
+
 // Leases returns all IP address leases
 func (db *Database) Leases(ctx context.Context) ([]lease.Lease, error) {
 	ips, err := db.store.ListIPs(ctx)
@@ -44,13 +83,14 @@ func (db *Database) Leases(ctx context.Context) ([]lease.Lease, error) {
 			continue
 		}
 
-		if !leased {
+		if !leased && !expiration.Equal(lease.Never) {
 			continue
 		}
 
 		leases = append(leases, lease.Lease{
 			Client: lease.Client{
-				ID: cli,
+				ID:       cli,
+				Hostname: db.hostname(ctx, ip),
 			},
 			Expires: expiration,
 			Address: ip,
@@ -83,13 +123,19 @@ func (db *Database) ReservedAddresses(ctx context.Context) (lease.ReservedAddres
 			continue
 		}
 
-		leases = append(leases, lease.ReservedAddress{
+		r := lease.ReservedAddress{
 			Client: lease.Client{
-				ID: cli,
+				ID:       cli,
+				Hostname: db.hostname(ctx, ip),
 			},
-			Expires: &expiration,
-			IP:      ip,
-		})
+			IP: ip,
+		}
+
+		if !expiration.Equal(lease.Never) {
+			r.Expires = &expiration
+		}
+
+		leases = append(leases, r)
 	}
 
 	return leases, nil
@@ -108,6 +154,11 @@ func (db *Database) Reserve(ctx context.Context, ip net.IP, cli lease.Client) er
 	}
 
 	if err == nil { // !IsNotFound(err)
+		if existingClient != clientID && expiration.Equal(lease.Never) {
+			l.Debugf("address %s statically assigned to %s", ip, existingClient)
+			return lease.ErrAddressStatic
+		}
+
 		if existingClient != clientID {
 			// IP address either leased or ŕeserved for a different client
 			if time.Now().Before(expiration) {
@@ -123,6 +174,10 @@ func (db *Database) Reserve(ctx context.Context, ip net.IP, cli lease.Client) er
 		//
 		if time.Now().After(expiration) {
 			if !leased {
+				if existingClient != clientID {
+					db.expire(ip, existingClient, leased, expiration)
+				}
+
 				l.Debugf("updating expired reservation for %s", ip)
 				if err := db.store.Update(ctx, ip, clientID, false, time.Now().Add(time.Minute)); err != nil {
 					return err
@@ -171,13 +226,29 @@ func (db *Database) Lease(ctx context.Context, ip net.IP, cli lease.Client, leas
 
 			if update {
 				l.Debugf("updating existing lease for IP %s (expiration=%s new-expiration=%s)", ip.String(), expiration, newExpiration)
-				return activeLeaseTime, db.store.Update(ctx, ip, existingClient, true, newExpiration)
+				if err := db.store.Update(ctx, ip, existingClient, true, newExpiration); err != nil {
+					return activeLeaseTime, err
+				}
+				db.setHostname(ctx, ip, existingClient, cli.Hostname)
+
+				if !leased || time.Now().After(expiration) {
+					db.emit(ctx, events.EventLeaseCreated, ip, existingClient, newExpiration)
+				} else if !newExpiration.Equal(expiration) {
+					db.emit(ctx, events.EventLeaseRenewed, ip, existingClient, newExpiration)
+				}
+				return activeLeaseTime, nil
 			}
 			l.Debugf("using existing lease for P %s", ip.String())
+			db.setHostname(ctx, ip, existingClient, cli.Hostname)
 
 			return activeLeaseTime, nil
 		}
 
+		if expiration.Equal(lease.Never) {
+			l.Debugf("IP %s statically assigned to client %s", ip.String(), existingClient)
+			return 0, lease.ErrAddressStatic
+		}
+
 		// IP address already leased for a different client
 		// we must not overwrite it if it's still valid
 		if time.Now().Before(expiration) {
@@ -185,8 +256,11 @@ func (db *Database) Lease(ctx context.Context, ip net.IP, cli lease.Client, leas
 			return 0, lease.ErrAddressReserved
 		}
 
-		// IP lease already expired so we can delete it
+		// IP lease already expired so we can delete it. The expiry
+		// is reported first as the storage needs the entry to tell
+		// whether it has been reported already
 		l.Infof("IP %s entry for client %s expired, overwritting (leased = %v)", ip, cli, leased)
+		db.expire(ip, existingClient, leased, expiration)
 		if err := db.store.Delete(ctx, ip, existingClient); err != nil {
 			return 0, err
 		}
@@ -194,11 +268,14 @@ func (db *Database) Lease(ctx context.Context, ip net.IP, cli lease.Client, leas
 		// fallthrough
 	}
 
-	if err := db.store.Create(ctx, ip, clientID, true, time.Now().Add(leaseTime)); err != nil {
+	expiration = time.Now().Add(leaseTime)
+	if err := db.store.Create(ctx, ip, clientID, true, expiration); err != nil {
 		l.Errorf("failed to lease IP %s for client %s: %s", ip.String(), clientID, err.Error())
 		return 0, err
 	}
 	l.Debugf("leased IP %s for client %s", ip.String(), clientID)
+	db.setHostname(ctx, ip, clientID, cli.Hostname)
+	db.emit(ctx, events.EventLeaseCreated, ip, clientID, expiration)
 
 	return leaseTime, nil
 }
@@ -207,7 +284,7 @@ func (db *Database) Lease(ctx context.Context, ip net.IP, cli lease.Client, leas
 func (db *Database) DeleteReservation(ctx context.Context, ip net.IP, cli *lease.Client) error {
 	clientID := ""
 	if cli != nil {
-		clientID = cli.HwAddr.String()
+		clientID = getClientID(*cli)
 	}
 
 	existingClient, leased, _, err := db.store.FindByIP(ctx, ip)
@@ -228,5 +305,189 @@ func (db *Database) DeleteReservation(ctx context.Context, ip net.IP, cli *lease
 
 // Release implements lease.Database
 func (db *Database) Release(ctx context.Context, ip net.IP) error {
-	return db.store.Delete(ctx, ip, "")
+	clientID, leased, expiration, findErr := db.store.FindByIP(ctx, ip)
+	if findErr == nil && expiration.Equal(lease.Never) {
+		// static reservations are kept until the static
+		// assignment is removed
+		return nil
+	}
+
+	if err := db.store.Delete(ctx, ip, ""); err != nil {
+		return err
+	}
+
+	if findErr == nil && leased {
+		db.emit(ctx, events.EventLeaseReleased, ip, clientID, expiration)
+	}
+
+	return nil
+}
+
+// Decline implements lease.Database
+func (db *Database) Decline(ctx context.Context, ip net.IP, cli lease.Client, hold time.Duration) error {
+	clientID := getClientID(cli)
+
+	existingClient, _, expiration, err := db.store.FindByIP(ctx, ip)
+	if err != nil {
+		return err
+	}
+
+	if existingClient != clientID {
+		return ErrClientMismatch
+	}
+
+	if expiration.Equal(lease.Never) {
+		return lease.ErrAddressStatic
+	}
+
+	if err := db.store.Delete(ctx, ip, clientID); err != nil {
+		return err
+	}
+
+	// keep the address reserved so it is not handed out again
+	// until the conflict has hopefully been resolved
+	if err := db.store.Create(ctx, ip, declinedClientID(ip), false, time.Now().Add(hold)); err != nil {
+		return err
+	}
+
+	db.emit(ctx, events.EventLeaseDeclined, ip, clientID, expiration)
+	return nil
+}
+
+// ReserveStatic implements lease.Database
+func (db *Database) ReserveStatic(ctx context.Context, ip net.IP, cli lease.Client) error {
+	l := dhcpLog.With(ctx, db.l)
+
+	clientID := getClientID(cli)
+
+	existingClient, leased, expiration, err := db.store.FindByIP(ctx, ip)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	if err == nil {
+		if existingClient == clientID {
+			if leased || !expiration.Equal(lease.Never) {
+				if err := db.store.Update(ctx, ip, clientID, false, lease.Never); err != nil {
+					return err
+				}
+			}
+
+			db.setHostname(ctx, ip, clientID, cli.Hostname)
+			return nil
+		}
+
+		if leased && time.Now().Before(expiration) {
+			l.Warnf("static IP %s is leased to %s until %s, replacing lease", ip, existingClient, expiration)
+		}
+
+		if err := db.store.Delete(ctx, ip, existingClient); err != nil {
+			return err
+		}
+	}
+
+	// the client may have a lease or reservation for a different
+	// IP address that needs to be removed first
+	existingIP, _, _, err := db.store.FindByID(ctx, clientID)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	if err == nil {
+		l.Debugf("removing entry for IP %s of statically assigned client %s", existingIP, clientID)
+		if err := db.store.Delete(ctx, existingIP, clientID); err != nil {
+			return err
+		}
+	}
+
+	if err := db.store.Create(ctx, ip, clientID, false, lease.Never); err != nil {
+		return err
+	}
+
+	db.setHostname(ctx, ip, clientID, cli.Hostname)
+	return nil
+}
+
+// FindByClient implements lease.Database
+func (db *Database) FindByClient(ctx context.Context, cli lease.Client) (net.IP, bool, time.Time, error) {
+	ip, leased, expiration, err := db.store.FindByID(ctx, getClientID(cli))
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, false, time.Time{}, nil
+		}
+		return nil, false, time.Time{}, err
+	}
+
+	return ip, leased, expiration, nil
+}
+
+// FindByIP implements lease.Database
+func (db *Database) FindByIP(ctx context.Context, ip net.IP) (*lease.Lease, error) {
+	cli, leased, expiration, err := db.store.FindByIP(ctx, ip)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !leased && !expiration.Equal(lease.Never) {
+		return nil, nil
+	}
+
+	l := &lease.Lease{
+		Client: lease.Client{
+			ID:       cli,
+			Hostname: db.hostname(ctx, ip),
+		},
+		Expires: expiration,
+		Address: append(net.IP{}, ip...),
+	}
+
+	// client IDs are hardware addresses for backwards compatibility
+	if mac, err := net.ParseMAC(cli); err == nil {
+		l.Client.HwAddr = mac
+	}
+
+	return l, nil
+}
+
+// getClientID returns the ID used to store entries for cli. For
+// backwards compatibility this is the hardware address of the client
+// if set
+func getClientID(cli lease.Client) string {
+	if len(cli.HwAddr) > 0 {
+		return cli.HwAddr.String()
+	}
+
+	return cli.ID
+}
+
+// setHostname stores hostname for the lease of ip if supported by
+// the storage. Errors are only logged as hostnames are informational
+func (db *Database) setHostname(ctx context.Context, ip net.IP, clientID, hostname string) {
+	hs, ok := db.store.(HostnameStorage)
+	if !ok || hostname == "" {
+		return
+	}
+
+	if err := hs.SetHostname(ctx, ip, clientID, hostname); err != nil {
+		dhcpLog.With(ctx, db.l).Warnf("failed to store hostname %q for %s: %s", hostname, ip, err.Error())
+	}
+}
+
+// hostname returns the hostname stored for the lease of ip or an
+// empty string if the storage does not support hostnames
+func (db *Database) hostname(ctx context.Context, ip net.IP) string {
+	hs, ok := db.store.(HostnameStorage)
+	if !ok {
+		return ""
+	}
+
+	hostname, err := hs.FindHostname(ctx, ip)
+	if err != nil {
+		return ""
+	}
+
+	return hostname
 }
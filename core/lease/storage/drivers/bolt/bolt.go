@@ -3,8 +3,11 @@ package bolt
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/nextdhcp/nextdhcp/core/lease/storage"
@@ -14,6 +17,7 @@ import (
 var (
 	ipLeaseBucketKey = []byte("ip-leases")
 	idToIPBucketKey  = []byte("id-to-ip-bucket")
+	dnsNameBucketKey = []byte("dns-names")
 )
 
 // SchemaVersion is the current version of the bolt db
@@ -23,6 +27,9 @@ type (
 	// Storage is a storage.LeaseStorage implementation that persists
 	// IP leases in a bbolt database
 	Storage struct {
+		// lock protects db from being replaced while
+		// the database is compacted
+		lock sync.RWMutex
 		db   *bbolt.DB
 		path string
 	}
@@ -31,12 +38,19 @@ type (
 		Expires  int64  `json:"expires"`
 		ClientID string `json:"clientID"`
 		Leased   bool   `json:"leased"`
+		Hostname string `json:"hostname,omitempty"`
+		Reported int64  `json:"reported,omitempty"`
+	}
+
+	dnsName struct {
+		Name   string `json:"name"`
+		Digest string `json:"digest,omitempty"`
 	}
 )
 
 // Create implements lease.Storage
 func (s *Storage) Create(ctx context.Context, ip net.IP, clientID string, leased bool, expiration time.Time) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
+	return s.update(func(tx *bbolt.Tx) error {
 		ipLeaseBucket, idToIPBucket, err := openOrCreateBuckets(tx)
 		if err != nil {
 			return err
@@ -71,7 +85,7 @@ func (s *Storage) Create(ctx context.Context, ip net.IP, clientID string, leased
 
 // Delete implements storage.LeaseStorage
 func (s *Storage) Delete(ctx context.Context, ip net.IP, clientID string) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
+	return s.update(func(tx *bbolt.Tx) error {
 		ipLeaseBucket, idToIPBucket, err := openOrCreateBuckets(tx)
 		if err != nil {
 			return err
@@ -101,7 +115,7 @@ func (s *Storage) Delete(ctx context.Context, ip net.IP, clientID string) error
 
 // Update implements storage.LeaseStorage
 func (s *Storage) Update(ctx context.Context, ip net.IP, clientID string, leased bool, expiration time.Time) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
+	return s.update(func(tx *bbolt.Tx) error {
 		ipLeaseBucket, _, err := openOrCreateBuckets(tx)
 		if err != nil {
 			return err
@@ -109,15 +123,22 @@ func (s *Storage) Update(ctx context.Context, ip net.IP, clientID string, leased
 		if err := assertUniqueIP(ipLeaseBucket, ip, clientID); err != nil {
 			return err
 		}
-		if ipLeaseBucket.Get([]byte(ip)) == nil {
+		existing := ipLeaseBucket.Get([]byte(ip))
+		if existing == nil {
 			return &storage.ErrIPNotFound{IP: ip}
 		}
 
-		e := entry{
-			ClientID: clientID,
-			Expires:  expiration.Unix(),
-			Leased:   leased,
+		// the hostname and reported expiration are kept across
+		// updates
+		var e entry
+		if err := json.Unmarshal(existing, &e); err != nil {
+			return err
 		}
+
+		e.ClientID = clientID
+		e.Expires = expiration.Unix()
+		e.Leased = leased
+
 		blob, err := json.Marshal(e)
 		if err != nil {
 			return err
@@ -130,7 +151,7 @@ func (s *Storage) Update(ctx context.Context, ip net.IP, clientID string, leased
 // FindByIP implements storage.LeaseStorage
 func (s *Storage) FindByIP(ctx context.Context, ip net.IP) (string, bool, time.Time, error) {
 	var e entry
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		ipLeaseBucket := tx.Bucket(ipLeaseBucketKey)
 		if ipLeaseBucket == nil {
 			// not found because the bucket hasn't even been created yet
@@ -153,7 +174,7 @@ func (s *Storage) FindByID(ctx context.Context, clientID string) (net.IP, bool,
 	var e entry
 	var ip net.IP
 
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		idToIPBucket := tx.Bucket(idToIPBucketKey)
 		ipBucket := tx.Bucket(ipLeaseBucketKey)
 		if idToIPBucket == nil || ipBucket == nil {
@@ -167,6 +188,8 @@ func (s *Storage) FindByID(ctx context.Context, clientID string) (net.IP, bool,
 			// TODO(ppacher): see above
 			return &storage.ErrIPNotFound{}
 		}
+		// the value is only valid during the transaction
+		ip = append(net.IP{}, ip...)
 
 		blob := ipBucket.Get([]byte(ip))
 		if blob == nil {
@@ -179,10 +202,206 @@ func (s *Storage) FindByID(ctx context.Context, clientID string) (net.IP, bool,
 	return ip, e.Leased, time.Unix(e.Expires, 0), err
 }
 
+// SetHostname implements storage.HostnameStorage
+func (s *Storage) SetHostname(ctx context.Context, ip net.IP, clientID string, hostname string) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		ipLeaseBucket, _, err := openOrCreateBuckets(tx)
+		if err != nil {
+			return err
+		}
+
+		blob := ipLeaseBucket.Get([]byte(ip))
+		if blob == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		var e entry
+		if err := json.Unmarshal(blob, &e); err != nil {
+			return err
+		}
+
+		if e.ClientID != clientID {
+			return storage.ErrClientMismatch
+		}
+
+		if e.Hostname == hostname {
+			return nil
+		}
+		e.Hostname = hostname
+
+		blob, err = json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		return ipLeaseBucket.Put([]byte(ip), blob)
+	})
+}
+
+// FindHostname implements storage.HostnameStorage
+func (s *Storage) FindHostname(ctx context.Context, ip net.IP) (string, error) {
+	var e entry
+	err := s.view(func(tx *bbolt.Tx) error {
+		ipLeaseBucket := tx.Bucket(ipLeaseBucketKey)
+		if ipLeaseBucket == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		blob := ipLeaseBucket.Get([]byte(ip))
+		if blob == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		return json.Unmarshal(blob, &e)
+	})
+
+	return e.Hostname, err
+}
+
+// SetReported implements storage.ExpiryStorage
+func (s *Storage) SetReported(ctx context.Context, ip net.IP, clientID string, expiration time.Time) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		ipLeaseBucket, _, err := openOrCreateBuckets(tx)
+		if err != nil {
+			return err
+		}
+
+		blob := ipLeaseBucket.Get([]byte(ip))
+		if blob == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		var e entry
+		if err := json.Unmarshal(blob, &e); err != nil {
+			return err
+		}
+
+		if e.ClientID != clientID {
+			return storage.ErrClientMismatch
+		}
+
+		e.Reported = expiration.Unix()
+
+		blob, err = json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		return ipLeaseBucket.Put([]byte(ip), blob)
+	})
+}
+
+// FindReported implements storage.ExpiryStorage
+func (s *Storage) FindReported(ctx context.Context, ip net.IP) (time.Time, error) {
+	var e entry
+	err := s.view(func(tx *bbolt.Tx) error {
+		ipLeaseBucket := tx.Bucket(ipLeaseBucketKey)
+		if ipLeaseBucket == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		blob := ipLeaseBucket.Get([]byte(ip))
+		if blob == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		return json.Unmarshal(blob, &e)
+	})
+
+	if err != nil || e.Reported == 0 {
+		return time.Time{}, err
+	}
+
+	return time.Unix(e.Reported, 0), nil
+}
+
+// DeleteExpired implements storage.ExpiryStorage
+func (s *Storage) DeleteExpired(ctx context.Context, ip net.IP, clientID string, expiration time.Time) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		ipLeaseBucket, idToIPBucket, err := openOrCreateBuckets(tx)
+		if err != nil {
+			return err
+		}
+
+		blob := ipLeaseBucket.Get([]byte(ip))
+		if blob == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		var e entry
+		if err := json.Unmarshal(blob, &e); err != nil {
+			return err
+		}
+
+		if e.ClientID != clientID {
+			return storage.ErrClientMismatch
+		}
+
+		if e.Expires != expiration.Unix() {
+			return storage.ErrEntryChanged
+		}
+
+		if err := ipLeaseBucket.Delete([]byte(ip)); err != nil {
+			return err
+		}
+
+		return idToIPBucket.Delete([]byte(e.ClientID))
+	})
+}
+
+// SetDNSName implements storage.DNSStorage
+func (s *Storage) SetDNSName(ctx context.Context, ip net.IP, name, digest string) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(dnsNameBucketKey)
+		if err != nil {
+			return err
+		}
+
+		blob, err := json.Marshal(dnsName{Name: name, Digest: digest})
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(ip), blob)
+	})
+}
+
+// FindDNSName implements storage.DNSStorage
+func (s *Storage) FindDNSName(ctx context.Context, ip net.IP) (string, string, error) {
+	var n dnsName
+	err := s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(dnsNameBucketKey)
+		if bucket == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		blob := bucket.Get([]byte(ip))
+		if blob == nil {
+			return &storage.ErrIPNotFound{IP: ip}
+		}
+
+		return json.Unmarshal(blob, &n)
+	})
+
+	return n.Name, n.Digest, err
+}
+
+// DeleteDNSName implements storage.DNSStorage
+func (s *Storage) DeleteDNSName(ctx context.Context, ip net.IP) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(dnsNameBucketKey)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.Delete([]byte(ip))
+	})
+}
+
 // ListIPs returns a list of all IPs and implements storage.LeaseStorage
 func (s *Storage) ListIPs(ctx context.Context) ([]net.IP, error) {
 	var ips []net.IP
-	return ips, s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		ipBucket := tx.Bucket(ipLeaseBucketKey)
 		if ipBucket == nil {
 			return nil
@@ -191,18 +410,21 @@ func (s *Storage) ListIPs(ctx context.Context) ([]net.IP, error) {
 		cursor := ipBucket.Cursor()
 		key, _ := cursor.First()
 		for key != nil {
-			ips = append(ips, net.IP(key))
+			// key is only valid during the transaction
+			ips = append(ips, append(net.IP{}, key...))
 			key, _ = cursor.Next()
 		}
 
 		return nil
 	})
+
+	return ips, err
 }
 
 // ListIDs returns a list of all IDs and implements storage.LeaseStorage
 func (s *Storage) ListIDs(ctx context.Context) ([]string, error) {
 	var ids []string
-	return ids, s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		idToIPBucket := tx.Bucket(idToIPBucketKey)
 		if idToIPBucket == nil {
 			return nil
@@ -216,6 +438,77 @@ func (s *Storage) ListIDs(ctx context.Context) ([]string, error) {
 		}
 		return nil
 	})
+
+	return ids, err
+}
+
+// Compact implements storage.Compactor. It copies all entries to a new
+// database file that replaces the current one
+func (s *Storage) Compact(ctx context.Context) error {
+	if s.path == "" {
+		return errors.New("database file unknown")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	mode := os.FileMode(0o660)
+	if info, err := os.Stat(s.path); err == nil {
+		mode = info.Mode()
+	}
+
+	tmp := s.path + ".compact"
+	dst, err := bbolt.Open(tmp, mode, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := bbolt.Compact(dst, s.db, 0); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := s.db.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// if replacing the database file fails we still need
+	// to re-open the old one
+	renameErr := os.Rename(tmp, s.path)
+	if renameErr != nil {
+		os.Remove(tmp)
+	}
+
+	db, err := bbolt.Open(s.path, mode, nil)
+	if err != nil {
+		return fmt.Errorf("failed to re-open database: %w", err)
+	}
+	s.db = db
+
+	return renameErr
+}
+
+// view executes fn in a read-only transaction
+func (s *Storage) view(fn func(*bbolt.Tx) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.db.View(fn)
+}
+
+// update executes fn in a read-write transaction
+func (s *Storage) update(fn func(*bbolt.Tx) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.db.Update(fn)
 }
 
 func openOrCreateBuckets(tx *bbolt.Tx) (ipLeaseBucket *bbolt.Bucket, idToIPBucket *bbolt.Bucket, err error) {
@@ -2,11 +2,17 @@ package bolt
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/nextdhcp/nextdhcp/core/lease/storage"
 	"github.com/nextdhcp/nextdhcp/core/lease/storage/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.etcd.io/bbolt"
 )
 
@@ -44,3 +50,47 @@ func TestMemoryStorage(t *testing.T) {
 
 	tests.Run(t, factory, teardown)
 }
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "leases.db")
+
+	s, err := storageFactory(map[string][]string{"file": {path}})
+	require.NoError(t, err)
+	store := s.(*Storage)
+	defer store.db.Close()
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	for i := 0; i < 1000; i++ {
+		ip := net.IP{10, 0, byte(i >> 8), byte(i)}
+		require.NoError(t, store.Create(ctx, ip, fmt.Sprintf("client-%d", i), true, expires))
+	}
+	for i := 1; i < 1000; i++ {
+		require.NoError(t, store.Delete(ctx, net.IP{10, 0, byte(i >> 8), byte(i)}, ""))
+	}
+
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Compact(ctx))
+
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+
+	// the remaining entry must still be available
+	cli, leased, expiration, err := store.FindByIP(ctx, net.IP{10, 0, 0, 0})
+	require.NoError(t, err)
+	assert.Equal(t, "client-0", cli)
+	assert.True(t, leased)
+	assert.Equal(t, expires, expiration)
+
+	ips, err := store.ListIPs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, ips, 1)
+
+	// the database must still be writable
+	require.NoError(t, store.Create(ctx, net.IP{10, 0, 0, 1}, "client-1", false, expires))
+
+	assert.Error(t, (&Storage{}).Compact(ctx))
+}
@@ -31,7 +31,10 @@ func storageFactory(arguments map[string][]string) (storage.LeaseStorage, error)
 		return nil, err
 	}
 
-	d := &Storage{db: db}
+	d := &Storage{
+		db:   db,
+		path: file,
+	}
 
 	return d, nil
 }
@@ -16,6 +16,8 @@ type entry struct {
 	clientID   string
 	leased     bool
 	expiration time.Time
+	hostname   string
+	reported   time.Time
 }
 
 func (e *entry) key() key {
@@ -24,6 +26,11 @@ func (e *entry) key() key {
 
 type key string
 
+type dnsName struct {
+	name   string
+	digest string
+}
+
 // Storage implements the storage.LeaseStorage interface but
 // does not provide any persistence at all as every IP lease
 // is only kept in memory
@@ -32,6 +39,7 @@ type Storage struct {
 	entries   map[key]*entry
 	ips       map[string]key
 	clientIDs map[string]key
+	dnsNames  map[string]dnsName
 }
 
 // New returns a new memory storage
@@ -45,6 +53,7 @@ func makeStorage() *Storage {
 		entries:   make(map[key]*entry),
 		ips:       make(map[string]key),
 		clientIDs: make(map[string]key),
+		dnsNames:  make(map[string]dnsName),
 	}
 }
 
@@ -131,11 +140,15 @@ func (s *Storage) Update(ctx context.Context, ip net.IP, clientID string, leased
 	}
 	entryKey := e.key()
 
-	if _, ok := s.entries[entryKey]; !ok {
+	existing, ok := s.entries[entryKey]
+	if !ok {
 		// TODO(ppacher): there should be a better error
 		return &storage.ErrIPNotFound{IP: ip}
 	}
 
+	// the hostname and reported expiration are kept across updates
+	e.hostname = existing.hostname
+	e.reported = existing.reported
 	s.entries[entryKey] = e
 
 	return nil
@@ -182,6 +195,169 @@ func (s *Storage) FindByID(ctx context.Context, clientID string) (net.IP, bool,
 	return e.ip, e.leased, e.expiration, nil
 }
 
+// SetHostname implements storage.HostnameStorage
+func (s *Storage) SetHostname(ctx context.Context, ip net.IP, clientID string, hostname string) error {
+	if !s.l.TryLock(ctx) {
+		return ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	entryKey, ok := s.ips[ip.String()]
+	if !ok {
+		return &storage.ErrIPNotFound{IP: ip}
+	}
+
+	e, ok := s.entries[entryKey]
+	if !ok {
+		return errors.New("internal error: database inconsistency")
+	}
+
+	if e.clientID != clientID {
+		return storage.ErrClientMismatch
+	}
+
+	e.hostname = hostname
+
+	return nil
+}
+
+// FindHostname implements storage.HostnameStorage
+func (s *Storage) FindHostname(ctx context.Context, ip net.IP) (string, error) {
+	if !s.l.TryLock(ctx) {
+		return "", ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	entryKey, ok := s.ips[ip.String()]
+	if !ok {
+		return "", &storage.ErrIPNotFound{IP: ip}
+	}
+
+	e, ok := s.entries[entryKey]
+	if !ok {
+		return "", errors.New("internal error: database inconsistency")
+	}
+
+	return e.hostname, nil
+}
+
+// SetReported implements storage.ExpiryStorage
+func (s *Storage) SetReported(ctx context.Context, ip net.IP, clientID string, expiration time.Time) error {
+	if !s.l.TryLock(ctx) {
+		return ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	entryKey, ok := s.ips[ip.String()]
+	if !ok {
+		return &storage.ErrIPNotFound{IP: ip}
+	}
+
+	e, ok := s.entries[entryKey]
+	if !ok {
+		return errors.New("internal error: database inconsistency")
+	}
+
+	if e.clientID != clientID {
+		return storage.ErrClientMismatch
+	}
+
+	e.reported = expiration
+
+	return nil
+}
+
+// FindReported implements storage.ExpiryStorage
+func (s *Storage) FindReported(ctx context.Context, ip net.IP) (time.Time, error) {
+	if !s.l.TryLock(ctx) {
+		return time.Time{}, ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	entryKey, ok := s.ips[ip.String()]
+	if !ok {
+		return time.Time{}, &storage.ErrIPNotFound{IP: ip}
+	}
+
+	e, ok := s.entries[entryKey]
+	if !ok {
+		return time.Time{}, errors.New("internal error: database inconsistency")
+	}
+
+	return e.reported, nil
+}
+
+// DeleteExpired implements storage.ExpiryStorage
+func (s *Storage) DeleteExpired(ctx context.Context, ip net.IP, clientID string, expiration time.Time) error {
+	if !s.l.TryLock(ctx) {
+		return ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	entryKey, ok := s.ips[ip.String()]
+	if !ok {
+		return &storage.ErrIPNotFound{IP: ip}
+	}
+
+	e, ok := s.entries[entryKey]
+	if !ok {
+		return errors.New("internal error: database inconsistency")
+	}
+
+	if e.clientID != clientID {
+		return storage.ErrClientMismatch
+	}
+
+	if !e.expiration.Equal(expiration) {
+		return storage.ErrEntryChanged
+	}
+
+	delete(s.entries, entryKey)
+	delete(s.ips, e.ip.String())
+	delete(s.clientIDs, e.clientID)
+
+	return nil
+}
+
+// SetDNSName implements storage.DNSStorage
+func (s *Storage) SetDNSName(ctx context.Context, ip net.IP, name, digest string) error {
+	if !s.l.TryLock(ctx) {
+		return ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	s.dnsNames[ip.String()] = dnsName{name: name, digest: digest}
+
+	return nil
+}
+
+// FindDNSName implements storage.DNSStorage
+func (s *Storage) FindDNSName(ctx context.Context, ip net.IP) (string, string, error) {
+	if !s.l.TryLock(ctx) {
+		return "", "", ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	n, ok := s.dnsNames[ip.String()]
+	if !ok {
+		return "", "", &storage.ErrIPNotFound{IP: ip}
+	}
+
+	return n.name, n.digest, nil
+}
+
+// DeleteDNSName implements storage.DNSStorage
+func (s *Storage) DeleteDNSName(ctx context.Context, ip net.IP) error {
+	if !s.l.TryLock(ctx) {
+		return ctx.Err()
+	}
+	defer s.l.Unlock()
+
+	delete(s.dnsNames, ip.String())
+
+	return nil
+}
+
 // ListIPs implements storage.LeaseStorage
 func (s *Storage) ListIPs(ctx context.Context) ([]net.IP, error) {
 	if !s.l.TryLock(ctx) {
@@ -214,3 +390,6 @@ func (s *Storage) ListIDs(ctx context.Context) ([]string, error) {
 
 // compile time check
 var _ storage.LeaseStorage = &Storage{}
+var _ storage.HostnameStorage = &Storage{}
+var _ storage.ExpiryStorage = &Storage{}
+var _ storage.DNSStorage = &Storage{}
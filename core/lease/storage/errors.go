@@ -42,6 +42,14 @@ var (
 	// ErrClientMismatch is returned from Delete if the given client ID does
 	// not match the one stored
 	ErrClientMismatch = errors.New("expected client ID does not match")
+
+	// ErrEntryChanged is returned from DeleteExpired if the expiration
+	// time stored does not match the expected one
+	ErrEntryChanged = errors.New("entry has been changed")
+
+	// ErrReapUnsupported is returned from Reap if the storage does not
+	// implement ExpiryStorage
+	ErrReapUnsupported = errors.New("storage does not support removing expired entries")
 )
 
 func (eip *ErrDuplicateIP) Error() string {
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+)
+
+const (
+	// DefaultExpiryInterval is the default interval used to scan the
+	// database for expired leases and reservations
+	DefaultExpiryInterval = time.Minute
+
+	// DefaultReapInterval is the interval used to remove expired
+	// leases and reservations from the database if the reaper is
+	// enabled without an interval
+	DefaultReapInterval = 10 * time.Minute
+
+	// DefaultGracePeriod is the default time expired leases and
+	// reservations are kept before they are removed
+	DefaultGracePeriod = 24 * time.Hour
+)
+
+// declinedPrefix is used for the client ID of reservations that hold
+// back addresses declined by clients
+const declinedPrefix = "declined:"
+
+// declinedClientID returns the client ID used to hold back ip after
+// it has been declined
+func declinedClientID(ip net.IP) string {
+	return declinedPrefix + ip.String()
+}
+
+// Start starts scanning the database for expired leases and reservations
+// in the background. Expiry events are emitted even if the client never
+// comes back. If ReapInterval is set, expired entries are removed once
+// their grace period passed
+func (db *Database) Start() {
+	db.runLock.Lock()
+	defer db.runLock.Unlock()
+
+	if db.stop != nil {
+		return
+	}
+
+	interval := db.ExpiryInterval
+	if interval <= 0 {
+		interval = DefaultExpiryInterval
+	}
+
+	db.stop = make(chan struct{})
+	db.done = make(chan struct{})
+
+	go db.run(interval, db.ReapInterval, db.stop, db.done)
+}
+
+// Stop stops the background scanner started by Start and waits for
+// it to finish
+func (db *Database) Stop() {
+	db.runLock.Lock()
+	defer db.runLock.Unlock()
+
+	if db.stop == nil {
+		return
+	}
+
+	close(db.stop)
+	<-db.done
+
+	db.stop = nil
+	db.done = nil
+}
+
+func (db *Database) run(interval, reapInterval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// reap stays nil if the reaper is disabled
+	var reap <-chan time.Time
+	if reapInterval > 0 {
+		reaper := time.NewTicker(reapInterval)
+		defer reaper.Stop()
+		reap = reaper.C
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := db.ScanExpired(context.Background()); err != nil {
+				db.l.Warnf("failed to scan for expired leases: %s", err.Error())
+			}
+		case <-reap:
+			n, err := db.Reap(context.Background())
+			if err != nil {
+				db.l.Warnf("failed to remove expired leases: %s", err.Error())
+			}
+			if n > 0 {
+				db.l.Infof("removed %d expired leases and reservations", n)
+			}
+		}
+	}
+}
+
+// Reap removes all leases and reservations that expired more than
+// GracePeriod ago and returns the number of removed entries. Expiry
+// events are emitted for entries that have not been reported yet. If
+// Compact is set the storage is compacted afterwards. Entries that are
+// renewed or handed out while reaping are kept so the storage must
+// implement ExpiryStorage
+func (db *Database) Reap(ctx context.Context) (int, error) {
+	es, ok := db.store.(ExpiryStorage)
+	if !ok {
+		return 0, ErrReapUnsupported
+	}
+
+	ips, err := db.store.ListIPs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-db.GracePeriod)
+	removed := 0
+
+	for _, ip := range ips {
+		clientID, leased, expiration, err := db.store.FindByIP(ctx, ip)
+		if err != nil {
+			if err == context.Canceled || err == context.DeadlineExceeded {
+				return removed, err
+			}
+
+			if !IsNotFound(err) {
+				db.l.Errorf("An error occured while loading IP lease for %s: %s", ip.String(), err.Error())
+			}
+			continue
+		}
+
+		if expiration.Equal(lease.Never) || !deadline.After(expiration) {
+			continue
+		}
+
+		db.expire(ip, clientID, leased, expiration)
+
+		// the entry is only removed if it has not been changed
+		// since it has been loaded
+		if err := es.DeleteExpired(ctx, ip, clientID, expiration); err != nil {
+			if err == context.Canceled || err == context.DeadlineExceeded {
+				return removed, err
+			}
+
+			if !IsNotFound(err) && err != ErrClientMismatch && err != ErrEntryChanged {
+				db.l.Errorf("failed to remove expired entry for %s: %s", ip.String(), err.Error())
+			}
+			continue
+		}
+
+		db.expiredLock.Lock()
+		delete(db.expired, ip.String())
+		db.expiredLock.Unlock()
+
+		removed++
+	}
+
+	if removed > 0 && db.Compact {
+		if c, ok := db.store.(Compactor); ok {
+			if err := c.Compact(ctx); err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// ScanExpired emits expiry events for all leases and reservations that
+// expired since they have been reported the last time, including those
+// that expired while the server was not running
+func (db *Database) ScanExpired(ctx context.Context) error {
+	ips, err := db.store.ListIPs(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	found := make(map[string]struct{}, len(ips))
+
+	for _, ip := range ips {
+		clientID, leased, expiration, err := db.store.FindByIP(ctx, ip)
+		if err != nil {
+			if err == context.Canceled || err == context.DeadlineExceeded {
+				return err
+			}
+
+			if !IsNotFound(err) {
+				db.l.Errorf("An error occured while loading IP lease for %s: %s", ip.String(), err.Error())
+			}
+			continue
+		}
+
+		found[ip.String()] = struct{}{}
+
+		if expiration.Equal(lease.Never) || !now.After(expiration) {
+			continue
+		}
+
+		db.expire(ip, clientID, leased, expiration)
+	}
+
+	// forget about entries that have been removed in the meantime
+	db.expiredLock.Lock()
+	for key := range db.expired {
+		if _, ok := found[key]; !ok {
+			delete(db.expired, key)
+		}
+	}
+	db.expiredLock.Unlock()
+
+	return nil
+}
+
+// expire emits the expiry event for the entry of ip unless it has already
+// been emitted for the same expiration time. If the storage does not
+// implement ExpiryStorage, entries that are still in the database are
+// reported again after a restart
+func (db *Database) expire(ip net.IP, clientID string, leased bool, expiration time.Time) {
+	// addresses held back after a decline are not
+	// visible to event consumers
+	if strings.HasPrefix(clientID, declinedPrefix) {
+		return
+	}
+
+	// expiry events are never deferred as the entry is marked as
+	// reported before the event is emitted
+	ctx := context.Background()
+
+	if !db.markReported(ctx, ip, clientID, expiration) {
+		return
+	}
+
+	if leased {
+		db.emit(ctx, events.EventLeaseExpired, ip, clientID, expiration)
+	} else {
+		db.emit(ctx, events.EventReservationExpired, ip, clientID, expiration)
+	}
+}
+
+// emit emits a lease event for the entry of ip. Events are deferred if
+// ctx has been returned by events.WithDeferred
+func (db *Database) emit(ctx context.Context, event caddy.EventName, ip net.IP, clientID string, expiration time.Time) {
+	l := &lease.Lease{
+		Client: lease.Client{
+			ID: clientID,
+		},
+		Expires: expiration,
+		Address: append(net.IP{}, ip...),
+	}
+
+	// client IDs are hardware addresses for backwards compatibility
+	if mac, err := net.ParseMAC(clientID); err == nil {
+		l.Client.HwAddr = mac
+	}
+
+	events.EmitLeaseEventContext(ctx, event, l)
+}
+
+// markReported marks the entry of ip as reported for expiration and
+// returns false if it has already been reported before
+func (db *Database) markReported(ctx context.Context, ip net.IP, clientID string, expiration time.Time) bool {
+	key := ip.String()
+
+	db.expiredLock.Lock()
+	defer db.expiredLock.Unlock()
+
+	if reported, ok := db.expired[key]; ok && reported.Equal(expiration) {
+		return false
+	}
+	db.expired[key] = expiration
+
+	es, ok := db.store.(ExpiryStorage)
+	if !ok {
+		return true
+	}
+
+	if reported, err := es.FindReported(ctx, ip); err == nil && reported.Equal(expiration) {
+		return false
+	}
+
+	if err := es.SetReported(ctx, ip, clientID, expiration); err != nil && !IsNotFound(err) {
+		db.l.Warnf("failed to store the expiry of %s: %s", ip, err.Error())
+	}
+
+	return true
+}
@@ -0,0 +1,332 @@
+package storage_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	sync.Mutex
+	events []string
+}
+
+func (r *recorder) hook(e caddy.EventName, l *lease.Lease) error {
+	// other tests in this package may emit events for different networks
+	if !l.Address.Equal(net.IP{10, 99, 0, 1}) && !l.Address.Equal(net.IP{10, 99, 0, 2}) {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, string(e)+" "+l.Address.String()+" "+l.Client.HwAddr.String())
+	return nil
+}
+
+func (r *recorder) take() []string {
+	r.Lock()
+	defer r.Unlock()
+	e := r.events
+	r.events = nil
+	return e
+}
+
+var rec = &recorder{}
+
+func init() {
+	for _, e := range []caddy.EventName{
+		events.EventLeaseCreated,
+		events.EventLeaseRenewed,
+		events.EventLeaseReleased,
+		events.EventLeaseDeclined,
+		events.EventLeaseExpired,
+		events.EventReservationExpired,
+	} {
+		events.RegisterLeaseEventHook("storage-test-"+string(e), e, rec.hook)
+	}
+}
+
+func TestDatabaseEvents(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	ip1 := net.IP{10, 99, 0, 1}
+	ip2 := net.IP{10, 99, 0, 2}
+	cli1 := lease.Client{HwAddr: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}}
+	cli2 := lease.Client{HwAddr: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}}
+
+	require.NoError(t, db.Reserve(ctx, ip1, cli1))
+	_, err := db.Lease(ctx, ip1, cli1, time.Hour, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lease-created 10.99.0.1 aa:bb:cc:dd:ee:01"}, rec.take())
+
+	// using the existing lease without renewal does not emit anything
+	_, err = db.Lease(ctx, ip1, cli1, time.Hour, false)
+	require.NoError(t, err)
+	assert.Empty(t, rec.take())
+
+	_, err = db.Lease(ctx, ip1, cli1, 2*time.Hour, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lease-renewed 10.99.0.1 aa:bb:cc:dd:ee:01"}, rec.take())
+
+	require.NoError(t, db.Release(ctx, ip1))
+	assert.Equal(t, []string{"lease-released 10.99.0.1 aa:bb:cc:dd:ee:01"}, rec.take())
+
+	_, err = db.Lease(ctx, ip2, cli2, time.Hour, false)
+	require.NoError(t, err)
+	rec.take()
+
+	assert.Equal(t, storage.ErrClientMismatch, db.Decline(ctx, ip2, cli1, time.Minute))
+	require.NoError(t, db.Decline(ctx, ip2, cli2, time.Minute))
+	assert.Equal(t, []string{"lease-declined 10.99.0.2 aa:bb:cc:dd:ee:02"}, rec.take())
+
+	// the declined address is held back
+	assert.Equal(t, lease.ErrAddressReserved, db.Reserve(ctx, ip2, cli1))
+	ip, _, _, err := db.FindByClient(ctx, cli2)
+	require.NoError(t, err)
+	assert.Nil(t, ip)
+}
+
+func TestDatabaseScanExpired(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	db := storage.NewDatabase(store)
+
+	ip1 := net.IP{10, 99, 0, 1}
+	ip2 := net.IP{10, 99, 0, 2}
+	now := time.Now()
+
+	require.NoError(t, store.Create(ctx, ip1, "aa:bb:cc:dd:ee:01", true, now.Add(10*time.Millisecond)))
+	require.NoError(t, store.Create(ctx, ip2, "aa:bb:cc:dd:ee:02", false, now.Add(10*time.Millisecond)))
+	rec.take()
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, db.ScanExpired(ctx))
+	assert.ElementsMatch(t, []string{
+		"lease-expired 10.99.0.1 aa:bb:cc:dd:ee:01",
+		"reservation-expired 10.99.0.2 aa:bb:cc:dd:ee:02",
+	}, rec.take())
+
+	// events are only emitted once per expiration
+	require.NoError(t, db.ScanExpired(ctx))
+	assert.Empty(t, rec.take())
+
+	// entries that expired before a restart are not reported again
+	require.NoError(t, storage.NewDatabase(store).ScanExpired(ctx))
+	assert.Empty(t, rec.take())
+
+	// entries that expired while the server was down are reported
+	// once after the restart
+	require.NoError(t, store.Delete(ctx, ip2, "aa:bb:cc:dd:ee:02"))
+	require.NoError(t, store.Create(ctx, ip2, "aa:bb:cc:dd:ee:04", true, now.Add(-time.Hour)))
+	require.NoError(t, storage.NewDatabase(store).ScanExpired(ctx))
+	assert.Equal(t, []string{"lease-expired 10.99.0.2 aa:bb:cc:dd:ee:04"}, rec.take())
+	require.NoError(t, storage.NewDatabase(store).ScanExpired(ctx))
+	assert.Empty(t, rec.take())
+
+	// a different client taking over the address does not emit
+	// another expiry event
+	cli := lease.Client{HwAddr: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x03}}
+	_, err := db.Lease(ctx, ip1, cli, time.Hour, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lease-created 10.99.0.1 aa:bb:cc:dd:ee:03"}, rec.take())
+
+	// the background scanner reports entries that expire later on
+	require.NoError(t, store.Update(ctx, ip1, "aa:bb:cc:dd:ee:03", true, time.Now().Add(50*time.Millisecond)))
+	db.ExpiryInterval = 20 * time.Millisecond
+	db.Start()
+	defer db.Stop()
+
+	assert.Eventually(t, func() bool {
+		rec.Lock()
+		defer rec.Unlock()
+		return len(rec.events) > 0
+	}, time.Second, 10*time.Millisecond)
+	db.Stop()
+	assert.Equal(t, []string{"lease-expired 10.99.0.1 aa:bb:cc:dd:ee:03"}, rec.take())
+}
+
+type compactingStorage struct {
+	*memory.Storage
+	compacted int
+}
+
+func (c *compactingStorage) Compact(context.Context) error {
+	c.compacted++
+	return nil
+}
+
+func TestDatabaseReap(t *testing.T) {
+	ctx := context.Background()
+	store := &compactingStorage{Storage: memory.New()}
+	db := storage.NewDatabase(store)
+	db.GracePeriod = time.Hour
+	db.Compact = true
+
+	ip1 := net.IP{10, 99, 0, 1}
+	ip2 := net.IP{10, 99, 0, 2}
+	now := time.Now()
+
+	require.NoError(t, store.Create(ctx, ip1, "aa:bb:cc:dd:ee:01", true, now.Add(-2*time.Hour)))
+	require.NoError(t, store.Create(ctx, ip2, "aa:bb:cc:dd:ee:02", true, now.Add(10*time.Millisecond)))
+	require.NoError(t, store.Create(ctx, net.IP{10, 99, 0, 3}, "aa:bb:cc:dd:ee:03", false, lease.Never))
+	require.NoError(t, store.Create(ctx, net.IP{10, 99, 0, 4}, "aa:bb:cc:dd:ee:04", true, now.Add(time.Hour)))
+	rec.take()
+	time.Sleep(20 * time.Millisecond)
+
+	// the first entry expired before the database has been created
+	// but has never been reported
+	n, err := db.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, store.compacted)
+	assert.Equal(t, []string{"lease-expired 10.99.0.1 aa:bb:cc:dd:ee:01"}, rec.take())
+
+	ips, err := store.ListIPs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, ips, 3)
+
+	_, _, _, err = store.FindByID(ctx, "aa:bb:cc:dd:ee:01")
+	assert.True(t, storage.IsNotFound(err))
+
+	// entries already reported by the scanner are removed
+	// without emitting the event again
+	db.GracePeriod = 0
+	require.NoError(t, db.ScanExpired(ctx))
+	assert.Equal(t, []string{"lease-expired 10.99.0.2 aa:bb:cc:dd:ee:02"}, rec.take())
+
+	n, err = db.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, rec.take())
+	assert.Equal(t, 2, store.compacted)
+
+	// nothing to do, nothing to compact
+	n, err = db.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 2, store.compacted)
+}
+
+// renewingStorage renews every entry right after it has been loaded
+// to simulate a client that renews its lease while it is reaped
+type renewingStorage struct {
+	*memory.Storage
+}
+
+func (r *renewingStorage) FindByIP(ctx context.Context, ip net.IP) (string, bool, time.Time, error) {
+	clientID, leased, expiration, err := r.Storage.FindByIP(ctx, ip)
+	if err == nil {
+		err = r.Storage.Update(ctx, ip, clientID, leased, time.Now().Add(time.Hour))
+	}
+	return clientID, leased, expiration, err
+}
+
+func TestDatabaseReapRenewed(t *testing.T) {
+	ctx := context.Background()
+	store := &renewingStorage{Storage: memory.New()}
+	db := storage.NewDatabase(store)
+	db.GracePeriod = 0
+
+	require.NoError(t, store.Create(ctx, net.IP{10, 99, 1, 1}, "aa:bb:cc:dd:ee:01", true, time.Now().Add(-time.Hour)))
+
+	n, err := db.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	ips, err := store.ListIPs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, ips, 1)
+
+	// storages that cannot delete entries atomically are not reaped
+	_, err = storage.NewDatabase(struct{ storage.LeaseStorage }{memory.New()}).Reap(ctx)
+	assert.Equal(t, storage.ErrReapUnsupported, err)
+}
+
+func TestDatabaseHostnames(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	hwaddr := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}
+	cli := lease.Client{HwAddr: hwaddr, ID: hwaddr.String(), Hostname: "lab"}
+
+	_, err := db.Lease(ctx, net.IP{10, 98, 0, 1}, cli, time.Hour, false)
+	require.NoError(t, err)
+
+	static := lease.Client{ID: "printer", Hostname: "printer"}
+	require.NoError(t, db.ReserveStatic(ctx, net.IP{10, 98, 0, 2}, static))
+
+	leases, err := db.Leases(ctx)
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+
+	names := map[string]string{}
+	for _, l := range leases {
+		names[l.Address.String()] = l.Hostname
+	}
+	assert.Equal(t, map[string]string{"10.98.0.1": "lab", "10.98.0.2": "printer"}, names)
+
+	// renewing without a hostname keeps the stored one
+	cli.Hostname = ""
+	_, err = db.Lease(ctx, net.IP{10, 98, 0, 1}, cli, time.Hour, true)
+	require.NoError(t, err)
+
+	// a changed hostname replaces the stored one
+	cli.Hostname = "lab-2"
+	_, err = db.Lease(ctx, net.IP{10, 98, 0, 1}, cli, time.Hour, true)
+	require.NoError(t, err)
+
+	leases, err = db.Leases(ctx)
+	require.NoError(t, err)
+	for _, l := range leases {
+		if l.Address.Equal(net.IP{10, 98, 0, 1}) {
+			assert.Equal(t, "lab-2", l.Hostname)
+		}
+	}
+}
+
+func TestDatabaseFindByIP(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	hwaddr := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x02}
+	cli := lease.Client{HwAddr: hwaddr, ID: hwaddr.String(), Hostname: "lab"}
+
+	_, err := db.Lease(ctx, net.IP{10, 97, 0, 1}, cli, time.Hour, false)
+	require.NoError(t, err)
+	require.NoError(t, db.ReserveStatic(ctx, net.IP{10, 97, 0, 2}, lease.Client{ID: "printer", Hostname: "printer"}))
+	other := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x03}
+	require.NoError(t, db.Reserve(ctx, net.IP{10, 97, 0, 3}, lease.Client{HwAddr: other, ID: other.String()}))
+
+	l, err := db.FindByIP(ctx, net.IP{10, 97, 0, 1})
+	require.NoError(t, err)
+	require.NotNil(t, l)
+	assert.Equal(t, hwaddr, l.HwAddr)
+	assert.Equal(t, "lab", l.Hostname)
+	assert.False(t, l.Expired())
+
+	l, err = db.FindByIP(ctx, net.IP{10, 97, 0, 2})
+	require.NoError(t, err)
+	require.NotNil(t, l)
+	assert.Equal(t, "printer", l.Hostname)
+	assert.True(t, l.Expires.Equal(lease.Never))
+
+	// temporary reservations and unknown addresses are not leases
+	l, err = db.FindByIP(ctx, net.IP{10, 97, 0, 3})
+	require.NoError(t, err)
+	assert.Nil(t, l)
+
+	l, err = db.FindByIP(ctx, net.IP{10, 97, 0, 4})
+	require.NoError(t, err)
+	assert.Nil(t, l)
+}
@@ -43,3 +43,62 @@ type LeaseStorage interface {
 	// ListIDs returns a list of client IDs that are available in the storage
 	ListIDs(ctx context.Context) ([]string, error)
 }
+
+// HostnameStorage is implemented by LeaseStorage implementations that
+// can keep the hostname of a client along with its IP lease
+type HostnameStorage interface {
+	// SetHostname stores the hostname for the IP lease of ip. The
+	// operation should only be performed if clientID matches the
+	// stored one. Hostnames are kept until the lease is deleted
+	SetHostname(ctx context.Context, ip net.IP, clientID string, hostname string) error
+
+	// FindHostname returns the hostname stored for the IP lease
+	// of ip
+	FindHostname(ctx context.Context, ip net.IP) (string, error)
+}
+
+// ExpiryStorage is implemented by LeaseStorage implementations that
+// can keep track of the expiration of an IP lease that has been reported
+// to event consumers, so expiry events are emitted exactly once even
+// across restarts, and that can remove expired IP leases atomically
+type ExpiryStorage interface {
+	// SetReported stores expiration as the reported expiration of the
+	// IP lease of ip. The operation should only be performed if
+	// clientID matches the stored one. The value is kept until the
+	// lease is deleted
+	SetReported(ctx context.Context, ip net.IP, clientID string, expiration time.Time) error
+
+	// FindReported returns the reported expiration of the IP lease of
+	// ip or the zero time if none has been reported yet
+	FindReported(ctx context.Context, ip net.IP) (time.Time, error)
+
+	// DeleteExpired deletes the IP lease of ip if it is still bound to
+	// clientID and expires at expiration. Checking and deleting the
+	// entry must happen atomically. ErrClientMismatch or ErrEntryChanged
+	// is returned if the entry has been changed in the meantime
+	DeleteExpired(ctx context.Context, ip net.IP, clientID string, expiration time.Time) error
+}
+
+// DNSStorage is implemented by LeaseStorage implementations that can
+// keep the DNS name registered for an address by dynamic DNS updates.
+// Names are stored independently of IP leases so they are still
+// available once the lease of the address has been deleted
+type DNSStorage interface {
+	// SetDNSName stores the name and the DHCID digest registered
+	// for ip
+	SetDNSName(ctx context.Context, ip net.IP, name, digest string) error
+
+	// FindDNSName returns the name and the DHCID digest registered
+	// for ip
+	FindDNSName(ctx context.Context, ip net.IP) (name string, digest string, err error)
+
+	// DeleteDNSName removes the name registered for ip
+	DeleteDNSName(ctx context.Context, ip net.IP) error
+}
+
+// Compactor is implemented by LeaseStorage implementations that
+// can release the space occupied by deleted entries
+type Compactor interface {
+	// Compact compacts the underlying storage
+	Compact(ctx context.Context) error
+}
@@ -122,6 +122,93 @@ func Run(t *testing.T, factory StorageFactory, teardown TeardownFunc) {
 		assert.Equal(t, 2, count())
 	})
 
+	if hs, ok := instance.(storage.HostnameStorage); ok {
+		t.Run("Hostname", func(t *testing.T) {
+			assert.NoError(t, hs.SetHostname(ctx, net.IP{10, 0, 0, 1}, "client-1", "lab"))
+			hostname, err := hs.FindHostname(ctx, net.IP{10, 0, 0, 1})
+			assert.NoError(t, err)
+			assert.Equal(t, "lab", hostname)
+
+			// hostnames are kept across updates
+			assert.NoError(t, instance.Update(ctx, net.IP{10, 0, 0, 1}, "client-1", true, time.Now()))
+			hostname, err = hs.FindHostname(ctx, net.IP{10, 0, 0, 1})
+			assert.NoError(t, err)
+			assert.Equal(t, "lab", hostname)
+
+			// IP and clientID must match
+			assert.Error(t, hs.SetHostname(ctx, net.IP{10, 0, 0, 1}, "client-3", "office"))
+			assert.Error(t, hs.SetHostname(ctx, net.IP{10, 0, 0, 2}, "client-2", "office"))
+
+			_, err = hs.FindHostname(ctx, net.IP{10, 0, 0, 2})
+			assert.Error(t, err)
+		})
+	}
+
+	if es, ok := instance.(storage.ExpiryStorage); ok {
+		t.Run("Reported", func(t *testing.T) {
+			reported, err := es.FindReported(ctx, net.IP{10, 0, 0, 1})
+			assert.NoError(t, err)
+			assert.True(t, reported.IsZero())
+
+			expires := time.Unix(time.Now().Unix(), 0)
+			assert.NoError(t, es.SetReported(ctx, net.IP{10, 0, 0, 1}, "client-1", expires))
+			reported, err = es.FindReported(ctx, net.IP{10, 0, 0, 1})
+			assert.NoError(t, err)
+			assert.True(t, expires.Equal(reported))
+
+			// the reported expiration is kept across updates
+			assert.NoError(t, instance.Update(ctx, net.IP{10, 0, 0, 1}, "client-1", true, time.Now().Add(time.Hour)))
+			reported, err = es.FindReported(ctx, net.IP{10, 0, 0, 1})
+			assert.NoError(t, err)
+			assert.True(t, expires.Equal(reported))
+
+			// IP and clientID must match
+			assert.Error(t, es.SetReported(ctx, net.IP{10, 0, 0, 1}, "client-3", expires))
+			assert.Error(t, es.SetReported(ctx, net.IP{10, 0, 0, 2}, "client-2", expires))
+
+			_, err = es.FindReported(ctx, net.IP{10, 0, 0, 2})
+			assert.Error(t, err)
+		})
+
+		t.Run("DeleteExpired", func(t *testing.T) {
+			expires := time.Unix(time.Now().Add(-time.Hour).Unix(), 0)
+			assert.NoError(t, instance.Create(ctx, net.IP{10, 0, 0, 4}, "client-4", true, expires))
+
+			// client and expiration must match
+			assert.Equal(t, storage.ErrClientMismatch, es.DeleteExpired(ctx, net.IP{10, 0, 0, 4}, "client-3", expires))
+			assert.Equal(t, storage.ErrEntryChanged, es.DeleteExpired(ctx, net.IP{10, 0, 0, 4}, "client-4", expires.Add(time.Hour)))
+			assert.True(t, storage.IsNotFound(es.DeleteExpired(ctx, net.IP{10, 0, 0, 5}, "client-4", expires)))
+
+			assert.NoError(t, es.DeleteExpired(ctx, net.IP{10, 0, 0, 4}, "client-4", expires))
+			_, _, _, err := instance.FindByID(ctx, "client-4")
+			assert.True(t, storage.IsNotFound(err))
+		})
+	}
+
+	if ds, ok := instance.(storage.DNSStorage); ok {
+		t.Run("DNSName", func(t *testing.T) {
+			_, _, err := ds.FindDNSName(ctx, net.IP{10, 0, 0, 1})
+			assert.True(t, storage.IsNotFound(err))
+
+			assert.NoError(t, ds.SetDNSName(ctx, net.IP{10, 0, 0, 1}, "lab.example.com", "digest"))
+			name, digest, err := ds.FindDNSName(ctx, net.IP{10, 0, 0, 1})
+			assert.NoError(t, err)
+			assert.Equal(t, "lab.example.com", name)
+			assert.Equal(t, "digest", digest)
+
+			// names are not bound to the lease of the address
+			assert.NoError(t, ds.SetDNSName(ctx, net.IP{10, 0, 0, 9}, "office.example.com", ""))
+			name, digest, err = ds.FindDNSName(ctx, net.IP{10, 0, 0, 9})
+			assert.NoError(t, err)
+			assert.Equal(t, "office.example.com", name)
+			assert.Empty(t, digest)
+
+			assert.NoError(t, ds.DeleteDNSName(ctx, net.IP{10, 0, 0, 9}))
+			_, _, err = ds.FindDNSName(ctx, net.IP{10, 0, 0, 9})
+			assert.True(t, storage.IsNotFound(err))
+		})
+	}
+
 	t.Run("Delete", func(t *testing.T) {
 		assert.NoError(t, instance.Delete(ctx, net.IP{10, 0, 0, 1}, "client-1"))
 		assert.Equal(t, 1, count())
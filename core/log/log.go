@@ -6,7 +6,6 @@ import (
 	"github.com/apex/log"
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
-	"github.com/nextdhcp/nextdhcp/plugin"
 )
 
 type requestFieldsKey struct{}
@@ -59,10 +58,16 @@ type Logger interface {
 	Errorf(msg string, args ...interface{})
 }
 
+// Named is implemented by plugins and by the servers started by them
+type Named interface {
+	// Name returns the name of the plugin
+	Name() string
+}
+
 // GetLogger returns a new logger for the given controller and plugin
 // plg may be nil in which case the server instance level logger is
 // returned
-func GetLogger(c *caddy.Controller, plg plugin.Handler) log.Interface {
+func GetLogger(c *caddy.Controller, plg Named) log.Interface {
 	// TODO(ppacher): fix me
 	if plg != nil {
 		return log.WithField("plugin", plg.Name())
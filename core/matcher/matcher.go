@@ -11,6 +11,7 @@ import (
 	"github.com/Knetic/govaluate"
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/replacer"
 )
 
@@ -27,6 +28,7 @@ type (
 	// evalParams implements the govaluate.Parameters interface and works on top of
 	// a DHCPv4 message
 	evalParams struct {
+		ctx      context.Context
 		replacer replacer.Replacer
 		req      *dhcpv4.DHCPv4
 	}
@@ -65,7 +67,7 @@ func SetupMatcherString(exprString string, fns ...map[string]ExprFunc) (*Matcher
 	if exprString != "" {
 		var err error
 
-		expr, err = govaluate.NewEvaluableExpressionWithFunctions(exprString, functions)
+		expr, err = govaluate.NewEvaluableExpressionWithFunctions(placeholdersToParams(exprString), functions)
 		if err != nil {
 			return nil, err
 		}
@@ -76,6 +78,31 @@ func SetupMatcherString(exprString string, fns ...map[string]ExprFunc) (*Matcher
 	}, nil
 }
 
+// placeholdersToParams converts replacer placeholders like {hwaddr} into
+// govaluate parameters ([hwaddr]) so both may be used in expressions.
+// Braces inside string literals are kept as they are
+func placeholdersToParams(expr string) string {
+	b := []byte(expr)
+	var quote byte
+
+	for i, c := range b {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '{':
+			b[i] = '['
+		case c == '}':
+			b[i] = ']'
+		}
+	}
+
+	return string(b)
+}
+
 // Match evaluates the expression stored in the matcher against the given request and response
 // message
 func (m *Matcher) Match(ctx context.Context, request *dhcpv4.DHCPv4) (bool, error) {
@@ -117,12 +144,19 @@ func (m *Matcher) MatchParams(params govaluate.Parameters) (bool, error) {
 func prepareEvalContext(ctx context.Context, request *dhcpv4.DHCPv4) govaluate.Parameters {
 	rep := replacer.NewReplacer(ctx, request)
 	return &evalParams{
+		ctx:      ctx,
 		replacer: rep,
 		req:      request,
 	}
 }
 
 func (e *evalParams) Get(name string) (interface{}, error) {
+	// [class:NAME] is true if the client is a member of
+	// the class NAME
+	if strings.HasPrefix(name, "class:") {
+		return class.Has(e.ctx, strings.TrimPrefix(name, "class:")), nil
+	}
+
 	if e.replacer != nil {
 		value := e.replacer.Get(name)
 		return value, nil
@@ -10,6 +10,7 @@ import (
 	"github.com/caddyserver/caddy"
 	"github.com/caddyserver/caddy/caddyfile"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -105,8 +106,26 @@ func TestMatch(t *testing.T) {
 			I: "msgtype == 'REQUEST'",
 			R: false,
 		},
+		{
+			I: "{msgtype} == 'DISCOVER'",
+			R: true,
+		},
+		{
+			I: "{hwaddr} == '{hwaddr}'",
+			R: false,
+		},
+		{
+			I: "[class:voip] && ! [class:guests]",
+			R: true,
+		},
+		{
+			I: "[class:guests]",
+			R: false,
+		},
 	}
 
+	ctx = class.WithClasses(ctx, []string{"voip"})
+
 	for i, c := range cases {
 		disp := caddyfile.NewDispenser("test", bytes.NewBufferString(c.I))
 		m, err := SetupMatcherRemainingArgs(&caddy.Controller{Dispenser: disp})
@@ -1,10 +1,12 @@
 package option
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 )
@@ -149,6 +151,48 @@ func ParseKnown(name string, values []string) (dhcpv4.OptionCode, dhcpv4.OptionV
 	return nil, nil, ErrUnknownOption
 }
 
+// ParseCustom parses a custom DHCP option. name must be the option code
+// (decimal, octal, hex or binary) and values a list of hex encoded payloads
+// that are concatenated to the option value
+func ParseCustom(name string, values []string) (dhcpv4.OptionCode, dhcpv4.OptionValue, error) {
+	// ParseUint handles octal, hex and binary values as well so let's just try to get a byte option
+	// code
+	code, err := strconv.ParseUint(name, 0, 8)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var payloads [][]byte
+	for _, v := range values {
+		v = strings.TrimPrefix(v, "0x")
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		payloads = append(payloads, b)
+	}
+
+	// now merge the payloads into one byte slice
+	value := dhcpv4.OptionGeneric{}
+	for _, p := range payloads {
+		value.Data = append(value.Data, p...)
+	}
+
+	return dhcpv4.GenericOptionCode(code), value, nil
+}
+
+// Parse parses a well-known option (see ParseKnown) and falls back to
+// a custom option (see ParseCustom) if name is unknown
+func Parse(name string, values []string) (dhcpv4.OptionCode, dhcpv4.OptionValue, error) {
+	code, value, err := ParseKnown(name, values)
+	if err != ErrUnknownOption {
+		return code, value, err
+	}
+
+	return ParseCustom(name, values)
+}
+
 // Code returns the DHCPv4 option code for the known option name
 func Code(name string) (dhcpv4.OptionCode, bool) {
 	code, ok := options[name]
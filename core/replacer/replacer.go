@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
 	"github.com/nextdhcp/nextdhcp/core/option"
 )
 
@@ -42,6 +44,7 @@ type (
 	CtxKey struct{}
 
 	replacer struct {
+		ctx                context.Context
 		msg                *dhcpv4.DHCPv4
 		customReplacements map[string]Value // a list of custom replacements configured via Set
 	}
@@ -87,6 +90,7 @@ func NewReplacer(ctx context.Context, msg *dhcpv4.DHCPv4) Replacer {
 	}
 
 	r := &replacer{
+		ctx:                ctx,
 		msg:                msg,
 		customReplacements: make(map[string]Value),
 	}
@@ -109,6 +113,11 @@ func ipStr(ip net.IP) string {
 }
 
 func (r *replacer) Get(key string) string {
+	// filters are applied to the value of the key in front of them
+	if idx := strings.Index(key, "|"); idx >= 0 {
+		return applyFilters(r.Get(key[:idx]), strings.Split(key[idx+1:], "|"))
+	}
+
 	// try custom replacements first
 	val, ok := r.customReplacements[key]
 	if ok {
@@ -144,6 +153,12 @@ func (r *replacer) Get(key string) string {
 		}
 		return r.msg.ClientHWAddr.String()
 
+	case "oui":
+		if len(r.msg.ClientHWAddr) < 3 {
+			return ""
+		}
+		return r.msg.ClientHWAddr[:3].String()
+
 	case "requestedip":
 		return ipStr(r.msg.RequestedIPAddress())
 
@@ -162,6 +177,49 @@ func (r *replacer) Get(key string) string {
 
 	case "state":
 		return getClientState(r.msg)
+
+	case "classes":
+		return strings.Join(class.FromContext(r.ctx), ",")
+
+	case "fqdn":
+		return clientFQDN(r.ctx, r.msg)
+
+	case "domain":
+		return fqdn.Domain(clientFQDN(r.ctx, r.msg))
+	}
+
+	return ""
+}
+
+// applyFilters applies all filters to value in order. Unknown filters
+// result in "<unknown>"
+func applyFilters(value string, filters []string) string {
+	for _, f := range filters {
+		switch f {
+		case "lower":
+			value = strings.ToLower(value)
+		case "upper":
+			value = strings.ToUpper(value)
+		case "dashes":
+			value = strings.NewReplacer(".", "-", ":", "-").Replace(value)
+		default:
+			return "<unknown>"
+		}
+	}
+
+	return value
+}
+
+// clientFQDN returns the fully qualified domain name of the client without
+// the trailing dot. The name decided by the fqdn plugin takes precedence over
+// the client FQDN option
+func clientFQDN(ctx context.Context, msg *dhcpv4.DHCPv4) string {
+	if reply := fqdn.FromContext(ctx); reply != nil {
+		return strings.TrimSuffix(reply.Name, ".")
+	}
+
+	if o := fqdn.FromRequest(msg); o != nil && o.FullyQualified() {
+		return strings.TrimSuffix(o.Name, ".")
 	}
 
 	return ""
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -78,6 +80,10 @@ func Test_Replacer_KnownKeys(t *testing.T) {
 				"hwaddr",
 				"de:ad:be:ef:01:02",
 			},
+			{
+				"oui",
+				"de:ad:be",
+			},
 			{
 				"requestedip",
 				"10.0.0.3",
@@ -206,6 +212,37 @@ func Test_Replacer_KnownKeys(t *testing.T) {
 		}
 	})
 
+	t.Run("classes", func(t *testing.T) {
+		assert.Equal(t, "", r.Get("classes"))
+
+		ctx := class.WithClasses(context.Background(), []string{"voip", "guests"})
+		assert.Equal(t, "voip,guests", NewReplacer(ctx, msg).Get("classes"))
+	})
+
+	t.Run("fqdn", func(t *testing.T) {
+		assert.Equal(t, "", r.Get("fqdn"))
+		assert.Equal(t, "", r.Get("domain"))
+
+		// fully qualified names of the client FQDN option are used
+		m, err := dhcpv4.FromBytes(msg.ToBytes())
+		assert.NoError(t, err)
+		m.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionFQDN, Value: &fqdn.Option{Name: "lab.example.com."}})
+		assert.Equal(t, "lab.example.com", NewReplacer(context.Background(), m).Get("fqdn"))
+		assert.Equal(t, "example.com", NewReplacer(context.Background(), m).Get("domain"))
+
+		// the name decided by the server takes precedence
+		ctx := fqdn.WithReply(context.Background(), &fqdn.Option{Name: "lab.lan."})
+		assert.Equal(t, "lab.lan", NewReplacer(ctx, m).Get("fqdn"))
+		assert.Equal(t, "lan", NewReplacer(ctx, m).Get("domain"))
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		assert.Equal(t, "10-0-0-1", r.Get("yourip|dashes"))
+		assert.Equal(t, "DE-AD-BE", r.Get("oui|dashes|upper"))
+		assert.Equal(t, "host", r.Get(">hostname|lower"))
+		assert.Equal(t, "<unknown>", r.Get("hwaddr|reverse"))
+	})
+
 	t.Run("custom keys", func(t *testing.T) {
 		r.Set("key1", StringValue("value1"))
 		assert.Equal(t, "value1", r.Get("key1"))
@@ -260,6 +297,10 @@ func Test_Replacer_Replace(t *testing.T) {
 			"{hostname\\} {hwaddr} requested {requestedip}",
 			" requested 10.0.0.3",
 		},
+		{
+			"dhcp-{yourip|dashes}",
+			"dhcp-10-0-0-1",
+		},
 		{
 			"router is {>router}",
 			"router is 10.0.0.254",
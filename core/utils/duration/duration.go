@@ -0,0 +1,52 @@
+// Package duration parses durations used in Dhcpfile directives
+package duration
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse parses a duration string. In addition to the units supported
+// by time.ParseDuration it supports days ("d") and weeks ("w") as a
+// prefix of the duration, like "7d", "1w2d" or "1d12h"
+func Parse(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	matched := false
+
+	for _, unit := range []struct {
+		suffix string
+		d      time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+	} {
+		idx := strings.Index(rest, unit.suffix)
+		if idx <= 0 {
+			continue
+		}
+
+		n, err := strconv.ParseUint(rest[:idx], 10, 32)
+		if err != nil {
+			// not a day or week prefix, let time.ParseDuration
+			// handle (and report) it
+			break
+		}
+
+		total += time.Duration(n) * unit.d
+		rest = rest[idx+1:]
+		matched = true
+	}
+
+	if matched && rest == "" {
+		return total, nil
+	}
+
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, err
+	}
+
+	return total + d, nil
+}
@@ -0,0 +1,41 @@
+package duration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		I string
+		D time.Duration
+		E bool
+	}{
+		{"1h", time.Hour, false},
+		{"3m30s", 3*time.Minute + 30*time.Second, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"1w2d", 9 * 24 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"2w1d3m", 15*24*time.Hour + 3*time.Minute, false},
+		{"", 0, true},
+		{"d", 0, true},
+		{"1x", 0, true},
+		{"1d1x", 0, true},
+		{"foo", 0, true},
+	}
+
+	for _, c := range cases {
+		d, err := Parse(c.I)
+		if c.E {
+			assert.Error(t, err, c.I)
+			continue
+		}
+
+		assert.NoError(t, err, c.I)
+		assert.Equal(t, c.D, d, c.I)
+	}
+}
@@ -36,7 +36,7 @@ const (
 
 // GetBootFileOpt returns option of DHCPs
 func (p *Plugin) GetBootFileOpt(ctx context.Context, req, res *dhcpv4.DHCPv4) (*dhcpv4.Option, error) {
-	bootFileName := p.parseBootFileName(req)
+	bootFileName := p.parseBootFileName(ctx, req)
 	if bootFileName == "" {
 		return nil, errNoClientARCH
 	}
@@ -48,10 +48,10 @@ func (p *Plugin) GetBootFileOpt(ctx context.Context, req, res *dhcpv4.DHCPv4) (*
 	return &option, nil
 }
 
-func (p *Plugin) parseBootFileName(req *dhcpv4.DHCPv4) string {
+func (p *Plugin) parseBootFileName(ctx context.Context, req *dhcpv4.DHCPv4) string {
 	archs := iana.Archs(req.ClientArch())
 
-	var bootFile string
+	var mode BootMode
 
 	switch archs[0] {
 	case iana.INTEL_X86PC:
@@ -63,7 +63,7 @@ func (p *Plugin) parseBootFileName(req *dhcpv4.DHCPv4) string {
 	case iana.ARC_X86:
 		fallthrough
 	case iana.INTEL_LEAN_CLIENT:
-		bootFile = p.Bootfile[BIOS]
+		mode = BIOS
 	case iana.EFI_ITANIUM:
 		fallthrough
 	case iana.EFI_IA32:
@@ -73,7 +73,17 @@ func (p *Plugin) parseBootFileName(req *dhcpv4.DHCPv4) string {
 	case iana.EFI_XSCALE:
 		fallthrough
 	case iana.EFI_X86_64:
-		bootFile = p.Bootfile[UEFI]
+		mode = UEFI
+	}
+
+	bootFile := p.Bootfile[mode]
+
+	// boot files for client classes take precedence
+	for _, r := range p.restricted {
+		if f, ok := r.bootfile[mode]; ok && r.classes.Match(ctx) {
+			bootFile = f
+			break
+		}
 	}
 
 	p.L.Debugf("receive client request with client_archs option: %s, dhcp server set boot-file-name as %s",
@@ -0,0 +1,47 @@
+package bootfile
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootFileClasses(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	bootfile {
+		bios pxelinux.0
+		uefi grubx64.efi
+	}
+	bootfile {
+		class lab
+		uefi lab.efi
+	}
+	`)
+	dhcpserver.GetConfig(c).Classes = []string{"lab"}
+
+	p, err := makeBootFilePlugin(c)
+	require.NoError(t, err)
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	req.UpdateOption(dhcpv4.OptClientArch(iana.EFI_X86_64))
+	lab := class.WithClasses(context.Background(), []string{"lab"})
+
+	assert.Equal(t, "grubx64.efi", p.parseBootFileName(context.Background(), req))
+	assert.Equal(t, "lab.efi", p.parseBootFileName(lab, req))
+
+	// members of the class use the default for other boot modes
+	req.UpdateOption(dhcpv4.OptClientArch(iana.INTEL_X86PC))
+	assert.Equal(t, "pxelinux.0", p.parseBootFileName(lab, req))
+
+	c = test.CreateTestBed(t, "bootfile {\nclass unknown\n}")
+	_, err = makeBootFilePlugin(c)
+	assert.Error(t, err)
+}
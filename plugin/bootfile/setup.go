@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/log"
 	"github.com/nextdhcp/nextdhcp/plugin"
@@ -23,59 +24,96 @@ type Plugin struct {
 	Next     plugin.Handler
 	Bootfile map[BootMode]string
 	L        log.Logger
+
+	// restricted holds boot files for members of client classes
+	restricted []*classBootfile
+}
+
+// classBootfile holds boot files that are used for members of at
+// least one of the classes
+type classBootfile struct {
+	classes  class.Set
+	bootfile map[BootMode]string
 }
 
 func setupBootFile(c *caddy.Controller) error {
+	p, err := makeBootFilePlugin(c)
+	if err != nil {
+		return err
+	}
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		p.Next = next
+		return p
+	})
+
+	return nil
+}
+
+func makeBootFilePlugin(c *caddy.Controller) (*Plugin, error) {
+	cfg := dhcpserver.GetConfig(c)
 	p := &Plugin{
 		Bootfile: make(map[BootMode]string),
 	}
+	p.L = log.GetLogger(c, p)
+
 	for c.Next() {
-		if c.NextBlock() {
+		files := make(map[BootMode]string)
+		var classes class.Set
+
+		for c.NextBlock() {
 			name := c.Val()
+
+			if name == "class" {
+				s, err := class.ParseSet(c, cfg.Classes)
+				if err != nil {
+					return nil, err
+				}
+				classes = s
+				continue
+			}
+
 			values := c.RemainingArgs()
 			if len(values) == 0 {
-				return c.ArgErr()
-			}
-			err := p.parseBootFile(name, values)
-			if err != nil {
-				return err
+				return nil, c.ArgErr()
 			}
 
-			for c.NextBlock() {
-				name = c.Val()
-				values = c.RemainingArgs()
-				if len(values) == 0 {
-					return c.ArgErr()
-				}
-				err := p.parseBootFile(name, values)
-				if err != nil {
-					return err
-				}
+			if err := parseBootFile(files, name, values); err != nil {
+				return nil, err
 			}
 		}
+
+		if len(classes) > 0 {
+			p.restricted = append(p.restricted, &classBootfile{
+				classes:  classes,
+				bootfile: files,
+			})
+			continue
+		}
+
+		for mode, file := range files {
+			p.Bootfile[mode] = file
+		}
 	}
 
-	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		p.Next = next
-		return p
-	})
-	p.L = log.GetLogger(c, p)
-	return nil
+	return p, nil
 }
 
-func (p *Plugin) parseBootFile(name string, values []string) error {
+func parseBootFile(files map[BootMode]string, name string, values []string) error {
 	if len(values) > 1 {
 		return errors.New("bootfile only surport one value for each boot mode")
 	}
+
 	switch strings.ToLower(name) {
 	case "bios":
-		p.Bootfile[BIOS] = values[0]
+		files[BIOS] = values[0]
 	case "legacy":
-		p.Bootfile[BIOS] = values[0]
+		files[BIOS] = values[0]
 	case "uefi":
-		p.Bootfile[UEFI] = values[0]
+		files[UEFI] = values[0]
 	default:
 		return errors.New("unknown boot mode")
 	}
+
 	return nil
 }
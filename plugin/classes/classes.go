@@ -0,0 +1,59 @@
+package classes
+
+import (
+	"context"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+// Class is a named client class. A client is a member of the
+// class if it matches the condition of the class
+type Class struct {
+	*matcher.Matcher
+
+	// Name is the name of the class
+	Name string
+}
+
+// Plugin evaluates all client classes once per request and stores
+// the names of the matching classes on the request context. It
+// implements the plugin.Handler interface
+type Plugin struct {
+	Next    plugin.Handler
+	Classes []*Class
+	L       log.Logger
+}
+
+// Name implements the plugin.Handler interface and returns "class"
+func (p *Plugin) Name() string {
+	return "class"
+}
+
+// ServeDHCP implements the plugin.Handler interface
+func (p *Plugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	l := log.With(ctx, p.L)
+	names := class.FromContext(ctx)
+
+	for _, cls := range p.Classes {
+		// classes may refer to classes defined before them
+		matched, err := cls.Match(class.WithClasses(ctx, names), req)
+		if err != nil {
+			l.Warnf("failed to match class %s: %s", cls.Name, err.Error())
+			continue
+		}
+
+		if matched {
+			names = append(names, cls.Name)
+		}
+	}
+
+	if len(names) > 0 {
+		l.Debugf("%s is a member of %v", req.ClientHWAddr, names)
+	}
+
+	return p.Next.ServeDHCP(class.WithClasses(ctx, names), req, res)
+}
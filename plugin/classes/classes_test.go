@@ -0,0 +1,76 @@
+package classes
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassSetup(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	class voip {
+		if {>class-identifier} == 'Polycom'
+		if {>class-identifier} == 'Yealink'
+		if_op or
+	}
+	class phones {
+		if [class:voip]
+	}
+	`)
+	plg, err := makeClassPlugin(c)
+	require.NoError(t, err)
+	require.Len(t, plg.Classes, 2)
+	assert.Equal(t, "voip", plg.Classes[0].Name)
+	assert.Equal(t, "phones", plg.Classes[1].Name)
+
+	for _, input := range []string{
+		"class",
+		"class voip",
+		"class voip phones {\nif true\n}",
+		"class voip {\nunknown\n}",
+		"class voip {\nif true\n}\nclass voip {\nif false\n}",
+	} {
+		c = test.CreateTestBed(t, input)
+		_, err = makeClassPlugin(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestClassServeDHCP(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	class voip {
+		if {>class-identifier} == 'Polycom'
+	}
+	class phones {
+		if [class:voip]
+	}
+	class guests {
+		if {hostname} == 'guest'
+	}
+	`)
+	plg, err := makeClassPlugin(c)
+	require.NoError(t, err)
+
+	var classes []string
+	plg.Next = test.HandlerFunc(func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+		classes = class.FromContext(ctx)
+		return nil
+	})
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	req.UpdateOption(dhcpv4.OptClassIdentifier("Polycom"))
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, []string{"voip", "phones"}, classes)
+
+	req.UpdateOption(dhcpv4.OptClassIdentifier("other"))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Empty(t, classes)
+}
@@ -0,0 +1,80 @@
+package classes
+
+import (
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+func init() {
+	caddy.RegisterPlugin("class", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupClass,
+	})
+}
+
+func setupClass(c *caddy.Controller) error {
+	plg, err := makeClassPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := dhcpserver.GetConfig(c)
+	for _, cls := range plg.Classes {
+		cfg.Classes = append(cfg.Classes, cls.Name)
+	}
+
+	cfg.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.Next = next
+		return plg
+	})
+
+	return nil
+}
+
+func makeClassPlugin(c *caddy.Controller) (*Plugin, error) {
+	plg := &Plugin{}
+	plg.L = log.GetLogger(c, plg)
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		name := args[0]
+
+		for _, cls := range plg.Classes {
+			if cls.Name == name {
+				return nil, c.Errf("class %s already defined", name)
+			}
+		}
+
+		m, err := matcher.SetupMatcher(c)
+		if err != nil {
+			return nil, c.Errf("invalid condition for class %s: %s", name, err.Error())
+		}
+
+		if m.EmptyCondition() {
+			return nil, c.Errf("class %s has no condition", name)
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "if", "if_op":
+				// already parsed by matcher.SetupMatcher
+				c.RemainingArgs()
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+
+		plg.Classes = append(plg.Classes, &Class{
+			Matcher: m,
+			Name:    name,
+		})
+	}
+
+	return plg, nil
+}
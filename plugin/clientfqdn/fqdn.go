@@ -0,0 +1,72 @@
+package clientfqdn
+
+import (
+	"context"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+// fqdnPlugin decides who updates the DNS records of a client and
+// answers the client FQDN option. It implements plugin.Handler
+type fqdnPlugin struct {
+	next   plugin.Handler
+	policy fqdn.Policy
+	domain string
+	l      log.Logger
+}
+
+// Name returns "fqdn" and implements plugin.Handler
+func (p *fqdnPlugin) Name() string {
+	return "fqdn"
+}
+
+// ServeDHCP stores the decision about DNS updates on the request context
+// so it is available to other plugins and replies with the client FQDN
+// option if the client sent one. It implements plugin.Handler
+func (p *fqdnPlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	o := fqdn.FromRequest(req)
+	reply := p.policy.Reply(o, p.clientName(req, o))
+
+	if o != nil {
+		log.With(ctx, p.l).Debugf("%s: client sent %s, replying with %s", req.ClientHWAddr, o, reply)
+	}
+
+	if err := p.next.ServeDHCP(fqdn.WithReply(ctx, reply), req, res); err != nil {
+		return err
+	}
+
+	if o != nil && (dhcpserver.Offer(res) || dhcpserver.Ack(res)) {
+		res.UpdateOption(dhcpv4.Option{Code: dhcpv4.OptionFQDN, Value: reply})
+	}
+
+	return nil
+}
+
+// clientName returns the domain name of the client. Names that are
+// not fully qualified are completed using the configured domain
+func (p *fqdnPlugin) clientName(req *dhcpv4.DHCPv4, o *fqdn.Option) string {
+	var host string
+
+	switch {
+	case o != nil && o.FullyQualified():
+		return o.Name
+	case o != nil && o.Name != "":
+		host = o.Name
+	default:
+		host = req.HostName()
+		if idx := strings.Index(host, "."); idx >= 0 {
+			host = host[:idx]
+		}
+	}
+
+	if host == "" || p.domain == "" {
+		return host
+	}
+
+	return host + "." + p.domain
+}
@@ -0,0 +1,86 @@
+package clientfqdn
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMessages(t *testing.T, typ dhcpv4.MessageType, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	modifiers = append([]dhcpv4.Modifier{
+		dhcpv4.WithHwAddr(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}),
+		dhcpv4.WithMessageType(typ),
+	}, modifiers...)
+
+	req, err := dhcpv4.New(modifiers...)
+	require.NoError(t, err)
+
+	res, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+
+	if typ == dhcpv4.MessageTypeRequest {
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+	} else {
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	}
+
+	return req, res
+}
+
+func withFQDN(flags byte, name string) dhcpv4.Modifier {
+	return dhcpv4.WithOption(dhcpv4.Option{
+		Code:  dhcpv4.OptionFQDN,
+		Value: &fqdn.Option{Flags: flags, Name: name},
+	})
+}
+
+func TestFQDNServeDHCP(t *testing.T) {
+	plg, err := makeFQDNPlugin(test.CreateTestBed(t, "fqdn client-updates {\ndomain lan\n}"))
+	require.NoError(t, err)
+
+	var (
+		ctxReply     *fqdn.Option
+		placeholders string
+	)
+	plg.next = test.HandlerFunc(func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+		ctxReply = fqdn.FromContext(ctx)
+		placeholders = replacer.NewReplacer(ctx, req).Replace("{fqdn} {domain}")
+		return nil
+	})
+
+	// partial names are completed using the domain
+	req, res := newMessages(t, dhcpv4.MessageTypeRequest, withFQDN(fqdn.FlagS|fqdn.FlagE, "lab"))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+
+	reply := &fqdn.Option{Flags: fqdn.FlagO | fqdn.FlagE, RCode1: 255, RCode2: 255, Name: "lab.lan."}
+	assert.Equal(t, reply, ctxReply)
+	assert.Equal(t, "lab.lan lan", placeholders)
+	assert.Equal(t, reply.ToBytes(), res.Options.Get(dhcpv4.OptionFQDN))
+
+	// fully qualified names are kept
+	req, res = newMessages(t, dhcpv4.MessageTypeDiscover, withFQDN(0, "lab.example.com."))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "lab.example.com. (flags=)", fqdn.FromRequest(res).String())
+	assert.Equal(t, "lab.example.com example.com", placeholders)
+
+	// the option is only sent if requested by the client but the
+	// hostname is used for the context
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest, dhcpv4.WithOption(dhcpv4.OptHostName("office.corp")))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Nil(t, res.Options.Get(dhcpv4.OptionFQDN))
+	assert.Equal(t, "office.lan.", ctxReply.Name)
+	assert.True(t, ctxReply.Has(fqdn.FlagS))
+
+	// the option is not added to DHCPNAKs
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest, withFQDN(fqdn.FlagS, "lab"))
+	res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeNak))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Nil(t, res.Options.Get(dhcpv4.OptionFQDN))
+}
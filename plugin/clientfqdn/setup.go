@@ -0,0 +1,94 @@
+package clientfqdn
+
+import (
+	"strings"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+func init() {
+	caddy.RegisterPlugin("fqdn", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupFQDN,
+	})
+}
+
+func setupFQDN(c *caddy.Controller) error {
+	plg, err := makeFQDNPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	return nil
+}
+
+func makeFQDNPlugin(c *caddy.Controller) (*fqdnPlugin, error) {
+	plg := &fqdnPlugin{
+		policy: fqdn.PolicyServerUpdates,
+	}
+	plg.l = log.GetLogger(c, plg)
+
+	seen := false
+	for c.Next() {
+		if seen {
+			return nil, c.Err("fqdn can only be configured once per subnet")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return nil, c.ArgErr()
+		}
+		if len(args) == 1 {
+			p, err := fqdn.ParsePolicy(args[0])
+			if err != nil {
+				return nil, c.Err(err.Error())
+			}
+			plg.policy = p
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "policy":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				p, err := fqdn.ParsePolicy(c.Val())
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				plg.policy = p
+
+			case "domain":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				domain := strings.Trim(strings.ToLower(c.Val()), ".")
+				if domain == "" {
+					return nil, c.Errf("invalid domain %q", c.Val())
+				}
+				plg.domain = domain + "."
+
+			default:
+				return nil, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	return plg, nil
+}
@@ -0,0 +1,43 @@
+package clientfqdn
+
+import (
+	"testing"
+
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFQDNSetup(t *testing.T) {
+	cases := []struct {
+		I      string
+		Policy fqdn.Policy
+		Domain string
+	}{
+		{"fqdn", fqdn.PolicyServerUpdates, ""},
+		{"fqdn no-updates", fqdn.PolicyNoUpdates, ""},
+		{"fqdn {\npolicy client-updates\ndomain Example.com.\n}", fqdn.PolicyClientUpdates, "example.com."},
+	}
+
+	for _, c := range cases {
+		plg, err := makeFQDNPlugin(test.CreateTestBed(t, c.I))
+		require.NoError(t, err, c.I)
+		assert.Equal(t, c.Policy, plg.policy, c.I)
+		assert.Equal(t, c.Domain, plg.domain, c.I)
+	}
+
+	for _, input := range []string{
+		"fqdn everyone",
+		"fqdn server-updates no-updates",
+		"fqdn {\npolicy\n}",
+		"fqdn {\npolicy unknown\n}",
+		"fqdn {\ndomain .\n}",
+		"fqdn {\ndomain lan lan\n}",
+		"fqdn {\nunknown\n}",
+		"fqdn\nfqdn",
+	} {
+		_, err := makeFQDNPlugin(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
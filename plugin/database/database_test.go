@@ -7,6 +7,7 @@ import (
 
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
 	"github.com/nextdhcp/nextdhcp/plugin/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -55,6 +56,51 @@ func TestDatabaseSetup(t *testing.T) {
 		assert.Equal(t, expected, argsOpts)
 	})
 
+	t.Run("maintenance", func(t *testing.T) {
+		ret = memory.New()
+		defer func() { ret = nil }()
+
+		c := test.CreateTestBed(t, `database test-driver {
+			file leases.db
+			reap 5m
+			grace 1h
+		}`)
+		assert.NoError(t, parseDatabaseDirective(c))
+		assert.Equal(t, map[string][]string{"file": {"leases.db"}}, argsOpts)
+
+		db := dhcpserver.GetConfig(c).Database.(*storage.Database)
+		assert.Equal(t, 5*time.Minute, db.ReapInterval)
+		assert.Equal(t, time.Hour, db.GracePeriod)
+		assert.False(t, db.Compact)
+
+		// the reaper is disabled by default
+		c = test.CreateTestBed(t, "database test-driver")
+		assert.NoError(t, parseDatabaseDirective(c))
+		assert.Equal(t, time.Duration(0), dhcpserver.GetConfig(c).Database.(*storage.Database).ReapInterval)
+
+		c = test.CreateTestBed(t, "database test-driver {\nreap\n}")
+		assert.NoError(t, parseDatabaseDirective(c))
+		assert.Equal(t, storage.DefaultReapInterval, dhcpserver.GetConfig(c).Database.(*storage.Database).ReapInterval)
+
+		c = test.CreateTestBed(t, "database test-driver {\nreap off\n}")
+		assert.NoError(t, parseDatabaseDirective(c))
+		assert.Equal(t, time.Duration(0), dhcpserver.GetConfig(c).Database.(*storage.Database).ReapInterval)
+
+		for _, input := range []string{
+			"reap 1m 2m",
+			"reap -1m",
+			"reap foo",
+			"grace",
+			"grace -1h",
+			"compact now",
+			// the memory driver does not support compaction
+			"compact",
+		} {
+			c = test.CreateTestBed(t, "database test-driver {\n"+input+"\n}")
+			assert.Error(t, parseDatabaseDirective(c), input)
+		}
+	})
+
 	t.Run("invalid", func(t *testing.T) {
 		c := test.CreateTestBed(t, "database")
 		assert.Error(t, parseDatabaseDirective(c))
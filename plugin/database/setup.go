@@ -1,9 +1,12 @@
 package database
 
 import (
+	"fmt"
+
 	"github.com/caddyserver/caddy"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
 )
 
 func init() {
@@ -29,8 +32,21 @@ func parseDatabaseDirective(c *caddy.Controller) error {
 		options["__args__"] = remaining
 	}
 
+	var maintenance []func(db *storage.Database) error
 	for c.NextBlock() {
-		options[c.Val()] = c.RemainingArgs()
+		key := c.Val()
+		args := c.RemainingArgs()
+
+		switch key {
+		case "reap", "grace", "compact":
+			fn, err := parseMaintenance(c, key, args)
+			if err != nil {
+				return err
+			}
+			maintenance = append(maintenance, fn)
+		default:
+			options[key] = args
+		}
 	}
 
 	if c.Next() {
@@ -43,8 +59,79 @@ func parseDatabaseDirective(c *caddy.Controller) error {
 	}
 
 	db := storage.NewDatabase(store)
+	for _, fn := range maintenance {
+		if err := fn(db); err != nil {
+			return c.Err(err.Error())
+		}
+	}
 
 	dhcpserver.GetConfig(c).Database = db
 
 	return nil
 }
+
+// parseMaintenance parses the options of the background reaper. They are
+// applied once the database has been opened
+func parseMaintenance(c *caddy.Controller, key string, args []string) (func(db *storage.Database) error, error) {
+	switch key {
+	case "compact":
+		if len(args) != 0 {
+			return nil, c.ArgErr()
+		}
+
+		return func(db *storage.Database) error {
+			if _, ok := db.Storage().(storage.Compactor); !ok {
+				return fmt.Errorf("database driver does not support compaction")
+			}
+			db.Compact = true
+			return nil
+		}, nil
+
+	case "reap":
+		if len(args) > 1 {
+			return nil, c.ArgErr()
+		}
+
+		interval := storage.DefaultReapInterval
+		switch {
+		case len(args) == 0:
+		case args[0] == "off":
+			interval = 0
+		default:
+			d, err := duration.Parse(args[0])
+			if err != nil {
+				return nil, c.Errf("invalid reap interval %q: %s", args[0], err.Error())
+			}
+			if d <= 0 {
+				return nil, c.Errf("reap interval must be positive or off")
+			}
+			interval = d
+		}
+
+		return func(db *storage.Database) error {
+			if _, ok := db.Storage().(storage.ExpiryStorage); !ok && interval > 0 {
+				return fmt.Errorf("database driver does not support removing expired entries")
+			}
+			db.ReapInterval = interval
+			return nil
+		}, nil
+
+	default: // grace
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+
+		d, err := duration.Parse(args[0])
+		if err != nil {
+			return nil, c.Errf("invalid grace period %q: %s", args[0], err.Error())
+		}
+		if d < 0 {
+			return nil, c.Errf("grace period must not be negative")
+		}
+
+		return func(db *storage.Database) error {
+			db.GracePeriod = d
+			return nil
+		}, nil
+	}
+}
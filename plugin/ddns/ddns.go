@@ -0,0 +1,318 @@
+package ddns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/dnsname"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+type (
+	// record describes the DNS records registered for a leased
+	// address. The digest is only set if the A record has been
+	// registered
+	record struct {
+		name    string
+		digest  string
+		forward bool
+	}
+
+	// ddnsPlugin updates DNS records for leased addresses. It
+	// implements plugin.Handler
+	ddnsPlugin struct {
+		*matcher.Matcher
+
+		next     plugin.Handler
+		updater  *updater
+		zone     string
+		reverse  string
+		ttl      time.Duration
+		override bool
+		classes  class.Set
+		network  net.IPNet
+		l        log.Logger
+
+		// store keeps the records across restarts. It is nil if the
+		// lease database does not support it
+		store storage.DNSStorage
+
+		// mu serializes updates and guards records
+		mu      sync.Mutex
+		records map[string]*record
+
+		// wg is used to wait for pending updates
+		wg sync.WaitGroup
+	}
+)
+
+// Name returns "ddns" and implements plugin.Handler
+func (p *ddnsPlugin) Name() string {
+	return "ddns"
+}
+
+// ServeDHCP registers the hostname of the client once the rest of the
+// chain acknowledged a lease. Updates are sent in the background. It
+// implements plugin.Handler
+func (p *ddnsPlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	if err := p.next.ServeDHCP(ctx, req, res); err != nil {
+		return err
+	}
+
+	if !dhcpserver.Request(req) || !dhcpserver.Ack(res) || !p.classes.Match(ctx) {
+		return nil
+	}
+
+	ip := res.YourIPAddr
+	if ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+
+	l := log.With(ctx, p.l)
+
+	matched, err := p.Match(ctx, req)
+	if err != nil {
+		l.Warnf("failed to match condition: %s", err.Error())
+		return nil
+	}
+	if !matched {
+		return nil
+	}
+
+	host := strings.ToLower(req.HostName())
+	forward := true
+
+	// the decision of the fqdn plugin takes precedence over the
+	// client FQDN option and the hostname
+	if reply := fqdn.FromContext(ctx); reply != nil {
+		if reply.Has(fqdn.FlagN) {
+			l.Debugf("%s: DNS updates disabled for client", req.ClientHWAddr)
+			return nil
+		}
+
+		if reply.Name != "" {
+			host = reply.Host()
+		}
+		forward = reply.Has(fqdn.FlagS)
+	} else if o := fqdn.FromRequest(req); o != nil {
+		if o.Has(fqdn.FlagN) {
+			l.Debugf("%s: client requested no DNS updates", req.ClientHWAddr)
+			return nil
+		}
+
+		if o.Name != "" {
+			host = o.Host()
+		}
+		forward = o.Has(fqdn.FlagS) || p.override
+	}
+
+	label := dnsname.Label(host)
+	if label == "" {
+		l.Debugf("%s: not updating DNS for invalid hostname %q", req.ClientHWAddr, host)
+		return nil
+	}
+	host = label
+
+	ttl := p.ttl
+	if ttl == 0 {
+		// RFC 4702 recommends a third of the lease time
+		ttl = res.IPAddressLeaseTime(time.Hour) / 3
+	}
+
+	rec := &record{
+		name:    host + "." + p.zone,
+		forward: forward,
+	}
+	if forward {
+		idType, id := identifier(req)
+		rec.digest = dhcid(idType, id, rec.name)
+	}
+
+	ip = append(net.IP{}, ip.To4()...)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.register(l, ip, rec, uint32(ttl/time.Second))
+	}()
+
+	return nil
+}
+
+// handleEvent removes the records of addresses that are no longer
+// leased
+func (p *ddnsPlugin) handleEvent(event caddy.EventName, l *lease.Lease) error {
+	switch event {
+	case events.EventLeaseReleased, events.EventLeaseExpired, events.EventLeaseDeclined:
+	default:
+		return nil
+	}
+
+	// events are emitted for all subnets
+	if !p.network.Contains(l.Address) {
+		return nil
+	}
+
+	ip := append(net.IP{}, l.Address.To4()...)
+	hwaddr := append(net.HardwareAddr{}, l.HwAddr...)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.unregister(ip, hwaddr)
+	}()
+
+	return nil
+}
+
+// register adds the records of rec for ip. Nothing is sent if the
+// records are already registered
+func (p *ddnsPlugin) register(l log.Logger, ip net.IP, rec *record, ttl uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := ip.String()
+	old, ok := p.records[key]
+	if !ok {
+		old, ok = p.load(ip)
+	}
+	if ok {
+		if *old == *rec {
+			return
+		}
+
+		// the address has been registered for a different name
+		if old.name != rec.name && old.forward {
+			if err := p.updater.removeForward(p.zone, old.name, ip, old.digest); err != nil {
+				l.Warnf("failed to remove %s for %s: %s", old.name, ip, err.Error())
+			}
+		}
+		delete(p.records, key)
+	}
+
+	if rec.forward {
+		if err := p.updater.addForward(p.zone, rec.name, ip, rec.digest, ttl); err != nil {
+			l.Warnf("failed to add %s for %s: %s", rec.name, ip, err.Error())
+			return
+		}
+	}
+
+	if p.reverse != "" {
+		if err := p.updater.setReverse(p.reverse, ip, rec.name, ttl); err != nil {
+			l.Warnf("failed to add PTR record for %s: %s", ip, err.Error())
+		}
+	}
+
+	p.records[key] = rec
+	p.save(l, ip, rec)
+	l.Infof("registered %s for %s", rec.name, ip)
+}
+
+// unregister removes all records of ip. If the records are unknown,
+// for example after a restart, they are loaded from the lease database.
+// If they are not found there the name is looked up using the PTR
+// record of ip
+func (p *ddnsPlugin) unregister(ip net.IP, hwaddr net.HardwareAddr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := ip.String()
+	rec, ok := p.records[key]
+	if !ok {
+		rec, ok = p.load(ip)
+	}
+	if !ok && p.reverse != "" && len(hwaddr) > 0 {
+		name, err := p.updater.lookupReverse(ip)
+		if err != nil {
+			p.l.Warnf("failed to lookup PTR record for %s: %s", ip, err.Error())
+			return
+		}
+		if name == "" {
+			return
+		}
+
+		// only ethernet hardware addresses are stored in the
+		// lease database
+		rec = &record{
+			name:    name,
+			digest:  dhcid(identifierHwAddr, hwAddrIdentifier(1, hwaddr), name),
+			forward: strings.HasSuffix(name, "."+p.zone),
+		}
+	}
+	if rec == nil {
+		return
+	}
+
+	delete(p.records, key)
+	p.forget(ip)
+
+	if rec.forward {
+		if err := p.updater.removeForward(p.zone, rec.name, ip, rec.digest); err != nil {
+			p.l.Warnf("failed to remove %s for %s: %s", rec.name, ip, err.Error())
+		}
+	}
+
+	if p.reverse != "" {
+		if err := p.updater.removeReverse(p.reverse, ip); err != nil {
+			p.l.Warnf("failed to remove PTR record for %s: %s", ip, err.Error())
+		}
+	}
+
+	p.l.Infof("removed %s for %s", rec.name, ip)
+}
+
+// load returns the records of ip stored in the lease database
+func (p *ddnsPlugin) load(ip net.IP) (*record, bool) {
+	if p.store == nil {
+		return nil, false
+	}
+
+	name, digest, err := p.store.FindDNSName(context.Background(), ip)
+	if err != nil {
+		if !storage.IsNotFound(err) {
+			p.l.Warnf("failed to load records of %s: %s", ip, err.Error())
+		}
+		return nil, false
+	}
+
+	return &record{
+		name:    name,
+		digest:  digest,
+		forward: digest != "",
+	}, true
+}
+
+// save stores the records of ip in the lease database
+func (p *ddnsPlugin) save(l log.Logger, ip net.IP, rec *record) {
+	if p.store == nil {
+		return
+	}
+
+	if err := p.store.SetDNSName(context.Background(), ip, rec.name, rec.digest); err != nil {
+		l.Warnf("failed to store records of %s: %s", ip, err.Error())
+	}
+}
+
+// forget removes the records of ip from the lease database
+func (p *ddnsPlugin) forget(ip net.IP) {
+	if p.store == nil {
+		return
+	}
+
+	if err := p.store.DeleteDNSName(context.Background(), ip); err != nil {
+		p.l.Warnf("failed to remove records of %s: %s", ip, err.Error())
+	}
+}
@@ -0,0 +1,387 @@
+package ddns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/miekg/dns"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/fqdn"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/nextdhcp/nextdhcp/plugin"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKey    = "nextdhcp."
+	testSecret = "c2VjcmV0LWtleS1mb3ItdGVzdHM="
+)
+
+// zoneServer is an authoritative name server that keeps all records
+// in memory and supports RFC 2136 updates signed with testKey
+type zoneServer struct {
+	*dns.Server
+	addr string
+
+	mu  sync.Mutex
+	rrs []dns.RR
+}
+
+func newZoneServer(t *testing.T) *zoneServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &zoneServer{addr: pc.LocalAddr().String()}
+	started := make(chan struct{})
+	s.Server = &dns.Server{
+		PacketConn:        pc,
+		Handler:           s,
+		TsigSecret:        map[string]string{testKey: testSecret},
+		NotifyStartedFunc: func() { close(started) },
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			// the default rejects updates
+			if int(dh.Bits>>11)&0xf == dns.OpcodeUpdate {
+				return dns.MsgAccept
+			}
+			return dns.DefaultMsgAcceptFunc(dh)
+		},
+	}
+
+	go func() { _ = s.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = s.Shutdown() })
+
+	return s
+}
+
+func (s *zoneServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	res := new(dns.Msg)
+	res.SetReply(r)
+
+	s.mu.Lock()
+	switch r.Opcode {
+	case dns.OpcodeUpdate:
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			res.Rcode = dns.RcodeNotAuth
+		} else {
+			res.Rcode = s.update(r)
+		}
+
+	case dns.OpcodeQuery:
+		q := r.Question[0]
+		for _, rr := range s.rrs {
+			if strings.EqualFold(rr.Header().Name, q.Name) && rr.Header().Rrtype == q.Qtype {
+				res.Answer = append(res.Answer, dns.Copy(rr))
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if tsig := r.IsTsig(); tsig != nil {
+		res.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	_ = w.WriteMsg(res)
+}
+
+// update applies the prerequisites and updates of r as described
+// in RFC 2136 section 3
+func (s *zoneServer) update(r *dns.Msg) int {
+	for _, rr := range r.Answer {
+		h := rr.Header()
+		switch {
+		case h.Class == dns.ClassANY && h.Rrtype == dns.TypeANY:
+			if len(s.find(h.Name, dns.TypeANY)) == 0 {
+				return dns.RcodeNameError
+			}
+		case h.Class == dns.ClassNONE && h.Rrtype == dns.TypeANY:
+			if len(s.find(h.Name, dns.TypeANY)) > 0 {
+				return dns.RcodeYXDomain
+			}
+		case h.Class == dns.ClassANY:
+			if len(s.find(h.Name, h.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case h.Class == dns.ClassNONE:
+			if len(s.find(h.Name, h.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		default:
+			if s.index(rr) < 0 {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+
+	for _, rr := range r.Ns {
+		h := rr.Header()
+		switch h.Class {
+		case dns.ClassANY:
+			for _, old := range s.find(h.Name, h.Rrtype) {
+				s.rrs = append(s.rrs[:s.index(old)], s.rrs[s.index(old)+1:]...)
+			}
+		case dns.ClassNONE:
+			if idx := s.index(rr); idx >= 0 {
+				s.rrs = append(s.rrs[:idx], s.rrs[idx+1:]...)
+			}
+		default:
+			if s.index(rr) < 0 {
+				s.rrs = append(s.rrs, dns.Copy(rr))
+			}
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// find returns all records of name with type rrtype. TypeANY matches
+// all records
+func (s *zoneServer) find(name string, rrtype uint16) []dns.RR {
+	var result []dns.RR
+	for _, rr := range s.rrs {
+		if strings.EqualFold(rr.Header().Name, name) && (rrtype == dns.TypeANY || rr.Header().Rrtype == rrtype) {
+			result = append(result, rr)
+		}
+	}
+	return result
+}
+
+// index returns the index of the record with the same data as rr
+func (s *zoneServer) index(rr dns.RR) int {
+	cmp := dns.Copy(rr)
+	cmp.Header().Class = dns.ClassINET
+
+	for i, existing := range s.rrs {
+		if dns.IsDuplicate(existing, cmp) {
+			return i
+		}
+	}
+	return -1
+}
+
+// records returns the string representation of all records of name
+// with type rrtype
+func (s *zoneServer) records(name string, rrtype uint16) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []string
+	for _, rr := range s.find(name, rrtype) {
+		switch v := rr.(type) {
+		case *dns.A:
+			result = append(result, v.A.String())
+		case *dns.PTR:
+			result = append(result, v.Ptr)
+		case *dns.DHCID:
+			result = append(result, v.Digest)
+		}
+	}
+	return result
+}
+
+// ack is a handler that acknowledges all requests for the address
+// set as requested IP
+func ack(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	res.YourIPAddr = req.RequestedIPAddress()
+	res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+	res.UpdateOption(dhcpv4.OptIPAddressLeaseTime(time.Hour))
+	return nil
+}
+
+func newPlugin(t *testing.T, srv *zoneServer, secret string, extra string) *ddnsPlugin {
+	plg, err := makeDDNSPlugin(test.CreateTestBed(t, `
+	ddns {
+		server `+srv.addr+`
+		zone example.com
+		key `+testKey+` `+secret+`
+		timeout 1s
+		`+extra+`
+	}`))
+	require.NoError(t, err)
+	plg.next = plugin.HandlerFunc(ack)
+	return plg
+}
+
+func request(t *testing.T, hwaddr net.HardwareAddr, ip net.IP, hostname string, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	modifiers = append([]dhcpv4.Modifier{
+		dhcpv4.WithHwAddr(hwaddr),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(ip)),
+		dhcpv4.WithOption(dhcpv4.OptHostName(hostname)),
+	}, modifiers...)
+
+	req, err := dhcpv4.New(modifiers...)
+	require.NoError(t, err)
+
+	res, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+	return req, res
+}
+
+// serve sends a DHCPREQUEST through plg and waits for all updates
+func serve(t *testing.T, plg *ddnsPlugin, hwaddr net.HardwareAddr, ip net.IP, hostname string, modifiers ...dhcpv4.Modifier) {
+	req, res := request(t, hwaddr, ip, hostname, modifiers...)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	plg.wg.Wait()
+}
+
+var (
+	hwaddr1 = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	hwaddr2 = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}
+)
+
+func TestDDNSRegister(t *testing.T) {
+	srv := newZoneServer(t)
+	plg := newPlugin(t, srv, testSecret, "")
+
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 10}, "Lab")
+	assert.Equal(t, []string{"127.0.0.10"}, srv.records("lab.example.com.", dns.TypeA))
+	assert.Len(t, srv.records("lab.example.com.", dns.TypeDHCID), 1)
+	assert.Equal(t, []string{"lab.example.com."}, srv.records("10.0.0.127.in-addr.arpa.", dns.TypePTR))
+
+	// a different client must not take over the name
+	serve(t, plg, hwaddr2, net.IP{127, 0, 0, 11}, "lab")
+	assert.Equal(t, []string{"127.0.0.10"}, srv.records("lab.example.com.", dns.TypeA))
+
+	// the same client may move to a different address
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 12}, "lab")
+	assert.Equal(t, []string{"127.0.0.12"}, srv.records("lab.example.com.", dns.TypeA))
+	assert.Equal(t, []string{"lab.example.com."}, srv.records("12.0.0.127.in-addr.arpa.", dns.TypePTR))
+
+	// releasing the address removes all records
+	require.NoError(t, plg.handleEvent(events.EventLeaseReleased, &lease.Lease{
+		Client:  lease.Client{HwAddr: hwaddr1},
+		Address: net.IP{127, 0, 0, 12},
+	}))
+	plg.wg.Wait()
+	assert.Empty(t, srv.records("lab.example.com.", dns.TypeA))
+	assert.Empty(t, srv.records("lab.example.com.", dns.TypeDHCID))
+	assert.Empty(t, srv.records("12.0.0.127.in-addr.arpa.", dns.TypePTR))
+}
+
+func TestDDNSExpireAfterRestart(t *testing.T) {
+	srv := newZoneServer(t)
+	plg := newPlugin(t, srv, testSecret, "")
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 10}, "lab")
+	require.Len(t, srv.records("lab.example.com.", dns.TypeA), 1)
+
+	// the name is found using the PTR record
+	plg = newPlugin(t, srv, testSecret, "")
+	require.NoError(t, plg.handleEvent(events.EventLeaseExpired, &lease.Lease{
+		Client:  lease.Client{HwAddr: hwaddr1},
+		Address: net.IP{127, 0, 0, 10},
+	}))
+	plg.wg.Wait()
+	assert.Empty(t, srv.records("lab.example.com.", dns.TypeA))
+	assert.Empty(t, srv.records("10.0.0.127.in-addr.arpa.", dns.TypePTR))
+}
+
+func TestDDNSClientIDAfterRestart(t *testing.T) {
+	srv := newZoneServer(t)
+	store := memory.New()
+	clientID := dhcpv4.WithOption(dhcpv4.OptClientIdentifier([]byte{0x01, 0x02, 0x03}))
+
+	plg := newPlugin(t, srv, testSecret, "")
+	plg.store = store
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 10}, "lab", clientID)
+	require.Len(t, srv.records("lab.example.com.", dns.TypeA), 1)
+
+	// the digest of the client identifier is loaded from the
+	// lease database
+	plg = newPlugin(t, srv, testSecret, "")
+	plg.store = store
+	require.NoError(t, plg.handleEvent(events.EventLeaseExpired, &lease.Lease{
+		Client:  lease.Client{HwAddr: hwaddr1},
+		Address: net.IP{127, 0, 0, 10},
+	}))
+	plg.wg.Wait()
+	assert.Empty(t, srv.records("lab.example.com.", dns.TypeA))
+	assert.Empty(t, srv.records("lab.example.com.", dns.TypeDHCID))
+	assert.Empty(t, srv.records("10.0.0.127.in-addr.arpa.", dns.TypePTR))
+
+	_, _, err := store.FindDNSName(context.Background(), net.IP{127, 0, 0, 10})
+	assert.True(t, storage.IsNotFound(err))
+}
+
+func TestDDNSClientFQDN(t *testing.T) {
+	srv := newZoneServer(t)
+	plg := newPlugin(t, srv, testSecret, "")
+
+	withFQDN := func(flags byte, name string) dhcpv4.Modifier {
+		return dhcpv4.WithOption(dhcpv4.Option{
+			Code:  dhcpv4.OptionFQDN,
+			Value: &fqdn.Option{Flags: flags, Name: name},
+		})
+	}
+
+	// the client does not want any updates
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 10}, "lab", withFQDN(fqdn.FlagN, "lab"))
+	assert.Empty(t, srv.records("lab.example.com.", dns.TypeA))
+	assert.Empty(t, srv.records("10.0.0.127.in-addr.arpa.", dns.TypePTR))
+
+	// the client updates the A record itself
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 10}, "lab", withFQDN(0, "office.example.org."))
+	assert.Empty(t, srv.records("office.example.com.", dns.TypeA))
+	assert.Equal(t, []string{"office.example.com."}, srv.records("10.0.0.127.in-addr.arpa.", dns.TypePTR))
+
+	// unless we override it
+	plg = newPlugin(t, srv, testSecret, "override-client-updates")
+	serve(t, plg, hwaddr2, net.IP{127, 0, 0, 11}, "lab", withFQDN(fqdn.FlagE, "desk"))
+	assert.Equal(t, []string{"127.0.0.11"}, srv.records("desk.example.com.", dns.TypeA))
+
+	// invalid hostnames are ignored
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 12}, "my_laptop")
+	assert.Empty(t, srv.records("12.0.0.127.in-addr.arpa.", dns.TypePTR))
+}
+
+func TestDDNSPolicy(t *testing.T) {
+	srv := newZoneServer(t)
+	plg := newPlugin(t, srv, testSecret, "")
+
+	serveWithReply := func(hwaddr net.HardwareAddr, ip net.IP, reply *fqdn.Option) {
+		req, res := request(t, hwaddr, ip, "lab", dhcpv4.WithOption(dhcpv4.Option{
+			Code:  dhcpv4.OptionFQDN,
+			Value: &fqdn.Option{Flags: fqdn.FlagS, Name: "lab"},
+		}))
+		require.NoError(t, plg.ServeDHCP(fqdn.WithReply(context.Background(), reply), req, res))
+		plg.wg.Wait()
+	}
+
+	// the decision of the fqdn plugin overrules the client
+	serveWithReply(hwaddr1, net.IP{127, 0, 0, 10}, &fqdn.Option{Flags: fqdn.FlagN | fqdn.FlagO})
+	assert.Empty(t, srv.records("10.0.0.127.in-addr.arpa.", dns.TypePTR))
+
+	serveWithReply(hwaddr1, net.IP{127, 0, 0, 10}, &fqdn.Option{Flags: fqdn.FlagO, Name: "desk.lan."})
+	assert.Empty(t, srv.records("desk.example.com.", dns.TypeA))
+	assert.Equal(t, []string{"desk.example.com."}, srv.records("10.0.0.127.in-addr.arpa.", dns.TypePTR))
+
+	serveWithReply(hwaddr2, net.IP{127, 0, 0, 11}, &fqdn.Option{Flags: fqdn.FlagS})
+	assert.Equal(t, []string{"127.0.0.11"}, srv.records("lab.example.com.", dns.TypeA))
+}
+
+func TestDDNSBadKey(t *testing.T) {
+	srv := newZoneServer(t)
+	plg := newPlugin(t, srv, "d3Jvbmcta2V5", "")
+
+	serve(t, plg, hwaddr1, net.IP{127, 0, 0, 10}, "lab")
+	assert.Empty(t, srv.records("lab.example.com.", dns.TypeA))
+	assert.Empty(t, plg.records)
+}
+
+func TestDHCID(t *testing.T) {
+	// test vectors from RFC 4701 section 3.6
+	assert.Equal(t, "AAIBY2/AuCccgoJbsaxcQc9TUapptP69lOjxfNuVAA2kjEA=",
+		dhcid(identifierDUID, []byte{0x00, 0x01, 0x00, 0x06, 0x41, 0x2d, 0xf1, 0x66, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}, "chi6.example.com"))
+	assert.Equal(t, "AAABxLmlskllE0MVjd57zHcWmEH3pCQ6VytcKD//7es/deY=",
+		dhcid(identifierHwAddr, hwAddrIdentifier(1, net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}), "client.example.com"))
+	assert.Equal(t, "AAEBOSD+XR3Os/0LozeXVqcNc7FwCfQdWL3b/NaiUDlW2No=",
+		dhcid(identifierClientID, []byte{0x01, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c}, "chi.example.com"))
+}
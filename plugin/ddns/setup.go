@@ -0,0 +1,232 @@
+package ddns
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/miekg/dns"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+// defaultTimeout is the default time to wait for the name server
+const defaultTimeout = 5 * time.Second
+
+// algorithms maps the supported TSIG algorithm names to their
+// canonical names
+var algorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+func init() {
+	caddy.RegisterPlugin("ddns", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupDDNS,
+	})
+}
+
+func setupDDNS(c *caddy.Controller) error {
+	plg, err := makeDDNSPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := dhcpserver.GetConfig(c)
+	cfg.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	var unsubscribe func()
+	c.OnStartup(func() error {
+		// the lease database is only known once the servers
+		// have been made
+		if db, ok := cfg.LeaseDatabase().(*storage.Database); ok {
+			plg.store, _ = db.Storage().(storage.DNSStorage)
+		}
+
+		unsubscribe = events.Subscribe(plg.handleEvent)
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+		plg.wg.Wait()
+		return nil
+	})
+
+	return nil
+}
+
+func makeDDNSPlugin(c *caddy.Controller) (*ddnsPlugin, error) {
+	cfg := dhcpserver.GetConfig(c)
+
+	plg := &ddnsPlugin{
+		network: cfg.Network,
+		records: make(map[string]*record),
+	}
+	plg.l = log.GetLogger(c, plg)
+
+	var (
+		server  string
+		key     *tsigKey
+		timeout = defaultTimeout
+		seen    bool
+	)
+
+	plg.reverse = reverseZone(cfg.Network)
+
+	for c.Next() {
+		if seen {
+			return nil, c.Err("ddns can only be configured once per subnet")
+		}
+		seen = true
+
+		cond, err := matcher.SetupMatcherRemainingArgs(c)
+		if err != nil {
+			return nil, err
+		}
+		plg.Matcher = cond
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "server":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				server = c.Val()
+				if _, _, err := net.SplitHostPort(server); err != nil {
+					server = net.JoinHostPort(server, "53")
+				}
+
+			case "zone":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				plg.zone = dns.Fqdn(strings.ToLower(c.Val()))
+				if _, ok := dns.IsDomainName(plg.zone); !ok {
+					return nil, c.Errf("invalid zone %q", c.Val())
+				}
+
+			case "reverse-zone":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				if c.Val() == "off" {
+					plg.reverse = ""
+					break
+				}
+
+				plg.reverse = dns.Fqdn(strings.ToLower(c.Val()))
+				if !strings.HasSuffix(plg.reverse, ".in-addr.arpa.") {
+					return nil, c.Errf("invalid reverse zone %q", c.Val())
+				}
+
+			case "key":
+				args := c.RemainingArgs()
+				if len(args) < 2 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+
+				key = &tsigKey{
+					name:      dns.Fqdn(strings.ToLower(args[0])),
+					secret:    args[1],
+					algorithm: dns.HmacSHA256,
+				}
+				if len(args) == 3 {
+					alg, ok := algorithms[strings.ToLower(args[2])]
+					if !ok {
+						return nil, c.Errf("unsupported TSIG algorithm %q", args[2])
+					}
+					key.algorithm = alg
+				}
+				continue
+
+			case "ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				d, err := duration.Parse(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid ttl %q: %s", c.Val(), err.Error())
+				}
+				if d < time.Second {
+					return nil, c.Err("ttl must be at least one second")
+				}
+				plg.ttl = d
+
+			case "timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				d, err := duration.Parse(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid timeout %q: %s", c.Val(), err.Error())
+				}
+				if d <= 0 {
+					return nil, c.Err("timeout must be positive")
+				}
+				timeout = d
+
+			case "override-client-updates":
+				plg.override = true
+
+			case "class":
+				plg.classes, err = class.ParseSet(c, cfg.Classes)
+				if err != nil {
+					return nil, err
+				}
+
+			default:
+				return nil, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+
+		if server == "" {
+			return nil, c.Err("server expected")
+		}
+
+		if plg.zone == "" {
+			return nil, c.Err("zone expected")
+		}
+	}
+
+	client := &dns.Client{
+		Net:     "udp",
+		Timeout: timeout,
+	}
+	if key != nil {
+		client.TsigSecret = map[string]string{key.name: key.secret}
+	}
+
+	plg.updater = &updater{
+		server: server,
+		key:    key,
+		client: client,
+	}
+
+	return plg, nil
+}
@@ -0,0 +1,90 @@
+package ddns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDDNSSetup(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	ddns msgtype == 'REQUEST' {
+		server 10.0.0.53
+		zone Example.com
+		reverse-zone 0.0.127.in-addr.arpa
+		key dhcp-key c2VjcmV0 hmac-sha512
+		ttl 10m
+		timeout 2s
+		override-client-updates
+		class voip
+	}`)
+	dhcpserver.GetConfig(c).Classes = []string{"voip"}
+
+	plg, err := makeDDNSPlugin(c)
+	require.NoError(t, err)
+
+	assert.Equal(t, "10.0.0.53:53", plg.updater.server)
+	assert.Equal(t, "example.com.", plg.zone)
+	assert.Equal(t, "0.0.127.in-addr.arpa.", plg.reverse)
+	assert.Equal(t, &tsigKey{name: "dhcp-key.", secret: "c2VjcmV0", algorithm: dns.HmacSHA512}, plg.updater.key)
+	assert.Equal(t, map[string]string{"dhcp-key.": "c2VjcmV0"}, plg.updater.client.TsigSecret)
+	assert.Equal(t, 10*time.Minute, plg.ttl)
+	assert.Equal(t, 2*time.Second, plg.updater.client.Timeout)
+	assert.True(t, plg.override)
+	assert.Len(t, plg.classes, 1)
+	assert.False(t, plg.EmptyCondition())
+
+	plg, err = makeDDNSPlugin(test.CreateTestBed(t, `
+	ddns {
+		server [::1]:5353
+		zone lan
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:5353", plg.updater.server)
+	assert.Equal(t, "127.in-addr.arpa.", plg.reverse)
+	assert.Nil(t, plg.updater.key)
+	assert.Zero(t, plg.ttl)
+	assert.Equal(t, defaultTimeout, plg.updater.client.Timeout)
+
+	plg, err = makeDDNSPlugin(test.CreateTestBed(t, "ddns {\nserver 10.0.0.53\nzone lan\nreverse-zone off\n}"))
+	require.NoError(t, err)
+	assert.Empty(t, plg.reverse)
+
+	for _, input := range []string{
+		"ddns",
+		"ddns {\nzone lan\n}",
+		"ddns {\nserver 10.0.0.53\n}",
+		"ddns {\nserver 10.0.0.53\nzone\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\nreverse-zone example.com\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\nkey name\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\nkey name secret hmac-md4\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\nttl 0s\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\ntimeout 0s\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\nclass unknown\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\nunknown\n}",
+		"ddns {\nserver 10.0.0.53\nzone lan\n}\nddns {\nserver 10.0.0.53\nzone lan\n}",
+	} {
+		_, err := makeDDNSPlugin(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestReverseZone(t *testing.T) {
+	for network, zone := range map[string]string{
+		"192.168.0.0/24": "0.168.192.in-addr.arpa.",
+		"10.0.0.0/8":     "10.in-addr.arpa.",
+		"172.16.0.0/12":  "172.in-addr.arpa.",
+		"10.1.0.0/16":    "1.10.in-addr.arpa.",
+		"0.0.0.0/0":      "0.in-addr.arpa.",
+	} {
+		_, ipnet, err := net.ParseCIDR(network)
+		require.NoError(t, err)
+		assert.Equal(t, zone, reverseZone(*ipnet), network)
+	}
+}
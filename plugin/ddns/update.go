@@ -0,0 +1,251 @@
+package ddns
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/miekg/dns"
+)
+
+// Identifier types as defined in RFC 4701
+const (
+	identifierHwAddr   uint16 = 0x0000
+	identifierClientID uint16 = 0x0001
+	identifierDUID     uint16 = 0x0002
+
+	// digestSHA256 is the only digest type defined by RFC 4701
+	digestSHA256 byte = 1
+)
+
+// errConflict is returned if a name is already used by a different
+// client
+var errConflict = errors.New("name is already in use by a different client")
+
+type (
+	// tsigKey is the key used to sign updates
+	tsigKey struct {
+		name      string
+		algorithm string
+		secret    string
+	}
+
+	// rcodeError is returned if the server rejected an update
+	rcodeError int
+
+	// updater sends RFC 2136 dynamic updates to an authoritative
+	// name server using the conflict resolution of RFC 4703
+	updater struct {
+		server string
+		key    *tsigKey
+		client *dns.Client
+	}
+)
+
+func (e rcodeError) Error() string {
+	return fmt.Sprintf("update rejected with %s", dns.RcodeToString[int(e)])
+}
+
+// addForward adds the A record of name. If name is already in use the
+// record is only replaced if the DHCID record of name matches digest
+func (u *updater) addForward(zone, name string, ip net.IP, digest string, ttl uint32) error {
+	a := &dns.A{Hdr: header(name, dns.TypeA, ttl), A: ip.To4()}
+	id := &dns.DHCID{Hdr: header(name, dns.TypeDHCID, ttl), Digest: digest}
+
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	m.NameNotUsed([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name}}})
+	m.Insert([]dns.RR{a, id})
+
+	err := u.exchange(m)
+	if err != rcodeError(dns.RcodeYXDomain) {
+		return err
+	}
+
+	// the name is already in use. Replace the address if the name
+	// belongs to the same client
+	m = new(dns.Msg)
+	m.SetUpdate(zone)
+	m.Used([]dns.RR{&dns.DHCID{Hdr: header(name, dns.TypeDHCID, 0), Digest: digest}})
+	m.RemoveRRset([]dns.RR{&dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA}}})
+	m.Insert([]dns.RR{a})
+
+	err = u.exchange(m)
+	if err == rcodeError(dns.RcodeNXRrset) {
+		return errConflict
+	}
+	return err
+}
+
+// removeForward removes the A record of name for ip if the DHCID
+// record of name matches digest. The DHCID record is removed as well
+// once no addresses are left
+func (u *updater) removeForward(zone, name string, ip net.IP, digest string) error {
+	id := &dns.DHCID{Hdr: header(name, dns.TypeDHCID, 0), Digest: digest}
+
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	m.Used([]dns.RR{id})
+	m.Remove([]dns.RR{&dns.A{Hdr: header(name, dns.TypeA, 0), A: ip.To4()}})
+
+	err := u.exchange(m)
+	if err == rcodeError(dns.RcodeNXRrset) {
+		return errConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	m = new(dns.Msg)
+	m.SetUpdate(zone)
+	m.Used([]dns.RR{id})
+	m.RRsetNotUsed([]dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA}},
+		&dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA}},
+	})
+	m.RemoveRRset([]dns.RR{&dns.DHCID{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeDHCID}}})
+
+	// the name is still used by other addresses of the client
+	if err := u.exchange(m); err != nil && err != rcodeError(dns.RcodeYXRrset) && err != rcodeError(dns.RcodeNXRrset) {
+		return err
+	}
+
+	return nil
+}
+
+// setReverse replaces the PTR record of ip with name
+func (u *updater) setReverse(zone string, ip net.IP, name string, ttl uint32) error {
+	ptr := reverseName(ip)
+
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	m.RemoveRRset([]dns.RR{&dns.PTR{Hdr: dns.RR_Header{Name: ptr, Rrtype: dns.TypePTR}}})
+	m.Insert([]dns.RR{&dns.PTR{Hdr: header(ptr, dns.TypePTR, ttl), Ptr: name}})
+
+	return u.exchange(m)
+}
+
+// removeReverse removes the PTR record of ip
+func (u *updater) removeReverse(zone string, ip net.IP) error {
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	m.RemoveRRset([]dns.RR{&dns.PTR{Hdr: dns.RR_Header{Name: reverseName(ip), Rrtype: dns.TypePTR}}})
+
+	return u.exchange(m)
+}
+
+// lookupReverse returns the name of the PTR record of ip or an empty
+// string if there is none
+func (u *updater) lookupReverse(ip net.IP) (string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(reverseName(ip), dns.TypePTR)
+
+	res, _, err := u.client.Exchange(m, u.server)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range res.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return ptr.Ptr, nil
+		}
+	}
+
+	return "", nil
+}
+
+// exchange signs m and sends it to the server
+func (u *updater) exchange(m *dns.Msg) error {
+	if u.key != nil {
+		m.SetTsig(u.key.name, u.key.algorithm, 300, time.Now().Unix())
+	}
+
+	res, _, err := u.client.Exchange(m, u.server)
+	if err != nil {
+		return err
+	}
+
+	if res.Rcode != dns.RcodeSuccess {
+		return rcodeError(res.Rcode)
+	}
+
+	return nil
+}
+
+// identifier returns the RFC 4701 identifier type and data for
+// the client that sent req
+func identifier(req *dhcpv4.DHCPv4) (uint16, []byte) {
+	if id := req.Options.Get(dhcpv4.OptionClientIdentifier); len(id) > 0 {
+		// RFC 4361 client identifiers carry the IAID and the DUID
+		if id[0] == 255 && len(id) > 5 {
+			return identifierDUID, id[5:]
+		}
+		return identifierClientID, id
+	}
+
+	return identifierHwAddr, hwAddrIdentifier(byte(req.HWType), req.ClientHWAddr)
+}
+
+// hwAddrIdentifier returns the identifier data for a hardware address
+func hwAddrIdentifier(htype byte, hwaddr net.HardwareAddr) []byte {
+	return append([]byte{htype}, hwaddr...)
+}
+
+// dhcid returns the base64 encoded RDATA of the DHCID record of name
+// for the client identified by idType and id
+func dhcid(idType uint16, id []byte, name string) string {
+	wire := make([]byte, 255)
+	n, err := dns.PackDomainName(dns.Fqdn(strings.ToLower(name)), wire, 0, nil, false)
+	if err != nil {
+		// names are validated before so this should never happen
+		n = 0
+	}
+
+	h := sha256.New()
+	h.Write(id)
+	h.Write(wire[:n])
+
+	rdata := []byte{byte(idType >> 8), byte(idType), digestSHA256}
+	rdata = h.Sum(rdata)
+
+	return base64.StdEncoding.EncodeToString(rdata)
+}
+
+// reverseName returns the in-addr.arpa name of ip
+func reverseName(ip net.IP) string {
+	// ReverseAddr only fails for invalid addresses
+	name, _ := dns.ReverseAddr(ip.String())
+	return name
+}
+
+// reverseZone returns the in-addr.arpa zone of network. Networks
+// that do not end on an octet boundary use the enclosing zone
+func reverseZone(network net.IPNet) string {
+	ones, _ := network.Mask.Size()
+	octets := ones / 8
+	if octets < 1 {
+		octets = 1
+	}
+
+	ip := network.IP.To4()
+	labels := make([]string, 0, octets+2)
+	for i := octets - 1; i >= 0; i-- {
+		labels = append(labels, fmt.Sprint(ip[i]))
+	}
+
+	return strings.Join(append(labels, "in-addr", "arpa"), ".") + "."
+}
+
+func header(name string, rrtype uint16, ttl uint32) dns.RR_Header {
+	return dns.RR_Header{
+		Name:   name,
+		Rrtype: rrtype,
+		Class:  dns.ClassINET,
+		Ttl:    ttl,
+	}
+}
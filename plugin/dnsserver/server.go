@@ -0,0 +1,359 @@
+package dnsserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/miekg/dns"
+	"github.com/nextdhcp/nextdhcp/core/dnsname"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+)
+
+const (
+	// defaultTTL is the TTL of all records answered by the server
+	defaultTTL = time.Minute
+
+	// defaultTimeout is how long to wait for upstream resolvers
+	defaultTimeout = 5 * time.Second
+)
+
+// Server is a DNS server that answers A and PTR queries for the active
+// leases of a subnet and forwards all other queries to upstream resolvers
+type Server struct {
+	// Domain is the fully qualified domain of all hostnames
+	Domain string
+
+	// Network is the subnet whose leases are answered
+	Network net.IPNet
+
+	// Upstreams are the resolvers queries are forwarded to. They are
+	// tried in order
+	Upstreams []string
+
+	// TTL is the TTL of all records answered by the server
+	TTL time.Duration
+
+	// Timeout is how long to wait for upstream resolvers
+	Timeout time.Duration
+
+	// Database returns the lease database to query
+	Database func() lease.Database
+
+	// L is the logger to use
+	L log.Logger
+
+	mu      sync.Mutex
+	servers []*dns.Server
+	addr    net.Addr
+
+	// the index of all hostnames and addresses of the subnet is
+	// rebuilt on the first query after a lease event
+	indexMu sync.Mutex
+	fresh   bool
+	names   map[string]record
+	addrs   map[string]record
+}
+
+// record is an entry of the index
+type record struct {
+	host    string
+	ip      net.IP
+	expires time.Time
+}
+
+// active returns true if the lease of r has not expired at now
+func (r record) active(now time.Time) bool {
+	return r.expires.Equal(lease.Never) || !r.expires.Before(now)
+}
+
+// Name returns "dns"
+func (s *Server) Name() string {
+	return "dns"
+}
+
+// ListenAndServe starts serving DNS on addr using UDP and TCP
+func (s *Server) ListenAndServe(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.servers) > 0 {
+		return errors.New("server already started")
+	}
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	// use the port of the UDP listener in case addr uses port 0
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	s.addr = pc.LocalAddr()
+	s.servers = []*dns.Server{
+		{PacketConn: pc, Handler: s},
+		{Listener: ln, Handler: s},
+	}
+
+	var wg sync.WaitGroup
+	for _, srv := range s.servers {
+		wg.Add(1)
+		srv.NotifyStartedFunc = wg.Done
+
+		go func(srv *dns.Server) {
+			if err := srv.ActivateAndServe(); err != nil {
+				s.L.Errorf("DNS server on %s failed: %s", addr, err.Error())
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addr
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, srv := range s.servers {
+		if err := srv.Shutdown(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.servers = nil
+
+	return firstErr
+}
+
+// ServeDNS answers the query r and implements dns.Handler
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	res := s.answer(w, r)
+	if res == nil {
+		return
+	}
+
+	if err := w.WriteMsg(res); err != nil {
+		s.L.Debugf("failed to send DNS response to %s: %s", w.RemoteAddr(), err.Error())
+	}
+}
+
+// answer returns the response for r. Queries for names and addresses
+// that are not handled by the server are forwarded
+func (s *Server) answer(w dns.ResponseWriter, r *dns.Msg) *dns.Msg {
+	res := new(dns.Msg)
+	res.SetReply(r)
+
+	if r.Opcode != dns.OpcodeQuery || len(r.Question) != 1 {
+		res.Rcode = dns.RcodeNotImplemented
+		return res
+	}
+
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	if name == s.Domain || dns.IsSubDomain(s.Domain, name) {
+		// we are authoritative for all names in the domain
+		res.Authoritative = true
+
+		ip := s.lookupHost(name)
+		switch {
+		case ip != nil && (q.Qtype == dns.TypeA || q.Qtype == dns.TypeANY):
+			res.Answer = append(res.Answer, &dns.A{
+				Hdr: s.header(q.Name, dns.TypeA),
+				A:   ip,
+			})
+		case ip == nil && name != s.Domain:
+			res.Rcode = dns.RcodeNameError
+		}
+
+		return res
+	}
+
+	if ip := addressOf(name); ip != nil && s.Network.Contains(ip) {
+		if host := s.lookupAddr(ip); host != "" {
+			res.Authoritative = true
+			if q.Qtype == dns.TypePTR || q.Qtype == dns.TypeANY {
+				res.Answer = append(res.Answer, &dns.PTR{
+					Hdr: s.header(q.Name, dns.TypePTR),
+					Ptr: host + "." + s.Domain,
+				})
+			}
+			return res
+		}
+	}
+
+	return s.forward(w, r)
+}
+
+// forward sends r to the upstream resolvers and returns the first
+// response
+func (s *Server) forward(w dns.ResponseWriter, r *dns.Msg) *dns.Msg {
+	if len(s.Upstreams) == 0 {
+		res := new(dns.Msg)
+		res.SetRcode(r, dns.RcodeRefused)
+		return res
+	}
+
+	client := &dns.Client{
+		Net:     "udp",
+		Timeout: s.Timeout,
+	}
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		client.Net = "tcp"
+	}
+
+	for _, upstream := range s.Upstreams {
+		res, _, err := client.Exchange(r, upstream)
+		if err == nil {
+			return res
+		}
+
+		s.L.Debugf("failed to forward %s to %s: %s", r.Question[0].Name, upstream, err.Error())
+	}
+
+	res := new(dns.Msg)
+	res.SetRcode(r, dns.RcodeServerFailure)
+	return res
+}
+
+// lookupHost returns the address leased to the host with the fully
+// qualified name
+func (s *Server) lookupHost(name string) net.IP {
+	host := strings.TrimSuffix(name, "."+s.Domain)
+	if host == name || strings.Contains(host, ".") {
+		return nil
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	s.refresh()
+	if r, ok := s.names[host]; ok && r.active(time.Now()) {
+		return r.ip
+	}
+
+	return nil
+}
+
+// lookupAddr returns the hostname of the client that has leased ip
+func (s *Server) lookupAddr(ip net.IP) string {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	s.refresh()
+	if r, ok := s.addrs[ip.String()]; ok && r.active(time.Now()) {
+		return r.host
+	}
+
+	return ""
+}
+
+// handleEvent marks the index as outdated for lease events of the
+// subnet
+func (s *Server) handleEvent(_ caddy.EventName, l *lease.Lease) error {
+	// events are emitted for all subnets
+	if !s.Network.Contains(l.Address) {
+		return nil
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	s.fresh = false
+
+	return nil
+}
+
+// refresh rebuilds the index from all leases and static assignments of
+// the subnet that have a valid hostname unless it is up to date. If a
+// hostname is used multiple times the lease that expires last wins.
+// The caller must hold indexMu
+func (s *Server) refresh() {
+	if s.fresh {
+		return
+	}
+
+	db := s.Database()
+	if db == nil {
+		return
+	}
+
+	leases, err := db.Leases(context.Background())
+	if err != nil {
+		s.L.Warnf("failed to load leases: %s", err.Error())
+		return
+	}
+
+	now := time.Now()
+	s.names = make(map[string]record)
+	s.addrs = make(map[string]record)
+	for _, l := range leases {
+		if !s.Network.Contains(l.Address) {
+			continue
+		}
+
+		r := record{
+			host:    dnsname.Label(l.Hostname),
+			ip:      l.Address.To4(),
+			expires: l.Expires,
+		}
+		if r.host == "" || !r.active(now) {
+			continue
+		}
+
+		s.addrs[r.ip.String()] = r
+		if other, ok := s.names[r.host]; ok && (other.expires.Equal(lease.Never) || other.expires.After(r.expires)) {
+			continue
+		}
+		s.names[r.host] = r
+	}
+	s.fresh = true
+}
+
+// header returns the header of an answer for name
+func (s *Server) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{
+		Name:   name,
+		Rrtype: rrtype,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(s.TTL / time.Second),
+	}
+}
+
+// addressOf returns the IPv4 address of an in-addr.arpa name or
+// nil
+func addressOf(name string) net.IP {
+	if !strings.HasSuffix(name, ".in-addr.arpa.") {
+		return nil
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa."), ".")
+	if len(labels) != net.IPv4len {
+		return nil
+	}
+
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	return net.ParseIP(strings.Join(labels, ".")).To4()
+}
@@ -0,0 +1,174 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUpstream starts a resolver on loopback that answers all A queries
+// with 192.0.2.1
+func newUpstream(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			res := new(dns.Msg)
+			res.SetReply(r)
+			res.Answer = append(res.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.IP{192, 0, 2, 1},
+			})
+			_ = w.WriteMsg(res)
+		}),
+	}
+
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func newServer(t *testing.T, input string) *Server {
+	srv, _, err := makeDNSServer(test.CreateTestBed(t, input))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+	srv.Database = func() lease.Database {
+		return db
+	}
+
+	hwaddr := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	_, err = db.Lease(ctx, net.IP{127, 0, 0, 10}, lease.Client{HwAddr: hwaddr, ID: hwaddr.String(), Hostname: "Lab"}, time.Hour, false)
+	require.NoError(t, err)
+
+	require.NoError(t, db.ReserveStatic(ctx, net.IP{127, 0, 0, 20}, lease.Client{ID: "printer", Hostname: "printer"}))
+
+	// leases of other subnets are not answered
+	hwaddr = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}
+	_, err = db.Lease(ctx, net.IP{10, 0, 0, 10}, lease.Client{HwAddr: hwaddr, ID: hwaddr.String(), Hostname: "remote"}, time.Hour, false)
+	require.NoError(t, err)
+
+	require.NoError(t, srv.ListenAndServe("127.0.0.1:0"))
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv
+}
+
+func query(t *testing.T, srv *Server, network, name string, qtype uint16) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+
+	client := &dns.Client{Net: network, Timeout: time.Second}
+	res, _, err := client.Exchange(msg, srv.Addr().String())
+	require.NoError(t, err)
+
+	return res
+}
+
+func TestServerLeases(t *testing.T) {
+	srv := newServer(t, "dns lan")
+
+	for _, network := range []string{"udp", "tcp"} {
+		res := query(t, srv, network, "lab.lan.", dns.TypeA)
+		assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+		assert.True(t, res.Authoritative)
+		require.Len(t, res.Answer, 1, network)
+		assert.Equal(t, "lab.lan.\t60\tIN\tA\t127.0.0.10", res.Answer[0].String())
+	}
+
+	res := query(t, srv, "udp", "Printer.LAN.", dns.TypeA)
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, "127.0.0.20", res.Answer[0].(*dns.A).A.String())
+
+	res = query(t, srv, "udp", "10.0.0.127.in-addr.arpa.", dns.TypePTR)
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, "lab.lan.", res.Answer[0].(*dns.PTR).Ptr)
+
+	// known names without matching records
+	res = query(t, srv, "udp", "lab.lan.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+	assert.Empty(t, res.Answer)
+
+	res = query(t, srv, "udp", "lan.", dns.TypeSOA)
+	assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+
+	// unknown names
+	for _, name := range []string{"remote.lan.", "office.lan.", "lab.office.lan."} {
+		res = query(t, srv, "udp", name, dns.TypeA)
+		assert.Equal(t, dns.RcodeNameError, res.Rcode, name)
+	}
+
+	// nothing is forwarded without upstreams
+	res = query(t, srv, "udp", "example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeRefused, res.Rcode)
+
+	res = query(t, srv, "udp", "10.0.0.10.in-addr.arpa.", dns.TypePTR)
+	assert.Equal(t, dns.RcodeRefused, res.Rcode)
+}
+
+func TestServerIndex(t *testing.T) {
+	srv := newServer(t, "dns lan")
+	ctx := context.Background()
+
+	res := query(t, srv, "udp", "lab.lan.", dns.TypeA)
+	require.Len(t, res.Answer, 1)
+
+	hwaddr := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x03}
+	cli := lease.Client{HwAddr: hwaddr, ID: hwaddr.String(), Hostname: "nas"}
+	_, err := srv.Database().Lease(ctx, net.IP{127, 0, 0, 30}, cli, time.Hour, false)
+	require.NoError(t, err)
+
+	// the index is only rebuilt after lease events of the subnet
+	res = query(t, srv, "udp", "nas.lan.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, res.Rcode)
+
+	require.NoError(t, srv.handleEvent("lease-created", &lease.Lease{Address: net.IP{10, 0, 0, 30}}))
+	res = query(t, srv, "udp", "nas.lan.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, res.Rcode)
+
+	require.NoError(t, srv.handleEvent("lease-created", &lease.Lease{Client: cli, Address: net.IP{127, 0, 0, 30}}))
+	res = query(t, srv, "udp", "nas.lan.", dns.TypeA)
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, "127.0.0.30", res.Answer[0].(*dns.A).A.String())
+
+	res = query(t, srv, "udp", "30.0.0.127.in-addr.arpa.", dns.TypePTR)
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, "nas.lan.", res.Answer[0].(*dns.PTR).Ptr)
+}
+
+func TestServerForward(t *testing.T) {
+	upstream := newUpstream(t)
+	srv := newServer(t, "dns lan {\nforward 127.0.0.1:1 "+upstream+"\ntimeout 200ms\n}")
+
+	res := query(t, srv, "udp", "example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, "192.0.2.1", res.Answer[0].(*dns.A).A.String())
+
+	// local names are never forwarded
+	res = query(t, srv, "udp", "office.lan.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, res.Rcode)
+}
+
+func TestAddressOf(t *testing.T) {
+	assert.Equal(t, net.IP{192, 168, 0, 10}, addressOf("10.0.168.192.in-addr.arpa."))
+	assert.Nil(t, addressOf("0.168.192.in-addr.arpa."))
+	assert.Nil(t, addressOf("10.0.168.192.example.com."))
+	assert.Nil(t, addressOf("a.0.168.192.in-addr.arpa."))
+}
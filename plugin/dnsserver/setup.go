@@ -0,0 +1,161 @@
+package dnsserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/caddyserver/caddy"
+	"github.com/miekg/dns"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
+)
+
+func init() {
+	caddy.RegisterPlugin("dns", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupDNS,
+	})
+}
+
+func setupDNS(c *caddy.Controller) error {
+	srv, addr, err := makeDNSServer(c)
+	if err != nil {
+		return err
+	}
+
+	var unsubscribe func()
+	start := func() error {
+		if err := srv.ListenAndServe(addr); err != nil {
+			return fmt.Errorf("failed to start DNS server on %s: %s", addr, err.Error())
+		}
+		unsubscribe = events.Subscribe(srv.handleEvent)
+		srv.L.Infof("serving %s via DNS on %s", srv.Domain, addr)
+		return nil
+	}
+
+	stop := func() error {
+		if unsubscribe != nil {
+			unsubscribe()
+			unsubscribe = nil
+		}
+		return srv.Close()
+	}
+
+	// The new instance is started before the old one is shut down
+	// during restarts so we need to release the listener in OnRestart
+	c.OnStartup(start)
+	c.OnRestart(stop)
+	c.OnRestartFailed(start)
+	c.OnFinalShutdown(stop)
+
+	return nil
+}
+
+func makeDNSServer(c *caddy.Controller) (*Server, string, error) {
+	cfg := dhcpserver.GetConfig(c)
+
+	srv := &Server{
+		Network: cfg.Network,
+		TTL:     defaultTTL,
+		Timeout: defaultTimeout,
+		Database: func() lease.Database {
+			return cfg.LeaseDatabase()
+		},
+	}
+	srv.L = log.GetLogger(c, srv)
+
+	addr := net.JoinHostPort(cfg.IP.String(), "53")
+	seen := false
+
+	for c.Next() {
+		if seen {
+			return nil, "", c.Err("dns can only be configured once per subnet")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return nil, "", c.ArgErr()
+		}
+		if len(args) == 1 {
+			srv.Domain = args[0]
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "domain":
+				if !c.NextArg() {
+					return nil, "", c.ArgErr()
+				}
+				srv.Domain = c.Val()
+
+			case "listen":
+				if !c.NextArg() {
+					return nil, "", c.ArgErr()
+				}
+				addr = withDefaultPort(c.Val())
+
+			case "forward":
+				upstreams := c.RemainingArgs()
+				if len(upstreams) == 0 {
+					return nil, "", c.ArgErr()
+				}
+				for _, u := range upstreams {
+					srv.Upstreams = append(srv.Upstreams, withDefaultPort(u))
+				}
+				continue
+
+			case "ttl":
+				if !c.NextArg() {
+					return nil, "", c.ArgErr()
+				}
+				d, err := duration.Parse(c.Val())
+				if err != nil || d <= 0 {
+					return nil, "", c.SyntaxErr("positive duration")
+				}
+				srv.TTL = d
+
+			case "timeout":
+				if !c.NextArg() {
+					return nil, "", c.ArgErr()
+				}
+				d, err := duration.Parse(c.Val())
+				if err != nil || d <= 0 {
+					return nil, "", c.SyntaxErr("positive duration")
+				}
+				srv.Timeout = d
+
+			default:
+				return nil, "", c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, "", c.ArgErr()
+			}
+		}
+	}
+
+	domain := strings.Trim(strings.ToLower(srv.Domain), ".")
+	if domain == "" {
+		return nil, "", c.Err("dns: domain required")
+	}
+	if _, ok := dns.IsDomainName(domain); !ok {
+		return nil, "", c.Errf("dns: invalid domain %q", srv.Domain)
+	}
+	srv.Domain = dns.Fqdn(domain)
+
+	return srv, addr, nil
+}
+
+// withDefaultPort adds port 53 to addr if it does not have a port
+func withDefaultPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+
+	return net.JoinHostPort(addr, "53")
+}
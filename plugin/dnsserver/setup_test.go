@@ -0,0 +1,51 @@
+package dnsserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSSetup(t *testing.T) {
+	srv, addr, err := makeDNSServer(test.CreateTestBed(t, "dns Lan.Example.com."))
+	require.NoError(t, err)
+	assert.Equal(t, "lan.example.com.", srv.Domain)
+	assert.Equal(t, "127.0.0.1:53", addr)
+	assert.Empty(t, srv.Upstreams)
+	assert.Equal(t, defaultTTL, srv.TTL)
+	assert.Equal(t, defaultTimeout, srv.Timeout)
+
+	srv, addr, err = makeDNSServer(test.CreateTestBed(t, `dns {
+		domain lan
+		listen 127.0.0.1:5353
+		forward 1.1.1.1 9.9.9.9:5353
+		ttl 5m
+		timeout 1s
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "lan.", srv.Domain)
+	assert.Equal(t, "127.0.0.1:5353", addr)
+	assert.Equal(t, []string{"1.1.1.1:53", "9.9.9.9:5353"}, srv.Upstreams)
+	assert.Equal(t, 5*time.Minute, srv.TTL)
+	assert.Equal(t, time.Second, srv.Timeout)
+
+	for _, input := range []string{
+		"dns",
+		"dns .",
+		"dns lan lan",
+		"dns lan {\nforward\n}",
+		"dns lan {\nlisten\n}",
+		"dns lan {\nttl soon\n}",
+		"dns lan {\nttl 0s\n}",
+		"dns lan {\nttl -1m\n}",
+		"dns lan {\ntimeout 0s\n}",
+		"dns lan {\nunknown\n}",
+		"dns lan\ndns lan",
+	} {
+		_, _, err := makeDNSServer(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,259 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+type (
+	// hook executes a command for matching DHCP requests or
+	// lease events
+	hook struct {
+		*matcher.Matcher
+
+		command []string
+		events  map[caddy.EventName]bool
+		classes class.Set
+		timeout time.Duration
+		sync    bool
+
+		// sem limits the number of commands running concurrently
+		sem chan struct{}
+
+		// queue limits the number of asynchronous commands that are
+		// running or waiting for a free slot
+		queue chan struct{}
+	}
+
+	// execPlugin runs hooks after the request has been handled by the
+	// rest of the chain. It implements plugin.Handler
+	execPlugin struct {
+		next    plugin.Handler
+		hooks   []*hook
+		network net.IPNet
+		l       log.Logger
+
+		// wg is used to wait for asynchronous commands
+		wg sync.WaitGroup
+	}
+)
+
+// Name returns "exec" and implements plugin.Handler
+func (e *execPlugin) Name() string {
+	return "exec"
+}
+
+// ServeDHCP runs all hooks that match the request after the rest of the
+// chain has served it. In sync mode a failing command vetoes the address
+// allocation. It implements plugin.Handler
+func (e *execPlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	if !e.hasSync() {
+		if err := e.next.ServeDHCP(ctx, req, res); err != nil {
+			return err
+		}
+		_, err := e.runHooks(ctx, req, res)
+		return err
+	}
+
+	// lease events are deferred until the hooks decided about the
+	// allocation so a vetoed lease is never reported
+	ctx, deferred := events.WithDeferred(ctx)
+
+	if err := e.next.ServeDHCP(ctx, req, res); err != nil {
+		deferred.Flush()
+		return err
+	}
+
+	vetoed, err := e.runHooks(ctx, req, res)
+
+	// a vetoed lease that has just been created is removed without
+	// a trace. Renewed leases have been released instead
+	if vetoed && deferred.Has(events.EventLeaseCreated) {
+		deferred.Discard()
+	} else {
+		deferred.Flush()
+	}
+
+	return err
+}
+
+// hasSync returns true if a hook runs in sync mode
+func (e *execPlugin) hasSync() bool {
+	for _, h := range e.hooks {
+		if h.sync {
+			return true
+		}
+	}
+	return false
+}
+
+// runHooks runs all hooks that match the request and reports whether
+// a hook in sync mode vetoed the address allocation
+func (e *execPlugin) runHooks(ctx context.Context, req, res *dhcpv4.DHCPv4) (bool, error) {
+	l := log.With(ctx, e.l)
+	for _, h := range e.hooks {
+		if !h.events[events.EventRequest] || !h.classes.Match(ctx) {
+			continue
+		}
+
+		matched, err := h.Match(ctx, req)
+		if err != nil {
+			l.Warnf("failed to match condition for %s: %s", h.command[0], err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+
+		rep := events.NewRequestReplacer(ctx, req, res)
+		if !h.sync {
+			e.runAsync(h, rep)
+			continue
+		}
+
+		if err := h.run(rep); err != nil {
+			l.Infof("%s: %s vetoed %s: %s", req.ClientHWAddr, h.command[0], res.MessageType(), err.Error())
+			return true, veto(ctx, res)
+		}
+	}
+
+	return false, nil
+}
+
+// handleEvent runs all hooks registered for the lease event. Lease
+// events are always handled asynchronously
+func (e *execPlugin) handleEvent(event caddy.EventName, l *lease.Lease) error {
+	// events are emitted for all subnets
+	if e.network.IP != nil && !e.network.Contains(l.Address) {
+		return nil
+	}
+
+	for _, h := range e.hooks {
+		if h.events[event] {
+			e.runAsync(h, events.NewReplacer(event, l))
+		}
+	}
+
+	return nil
+}
+
+// runAsync executes the hook in a dedicated go routine. If too many
+// commands of the hook are already waiting the command is dropped
+func (e *execPlugin) runAsync(h *hook, rep replacer.Replacer) {
+	select {
+	case h.queue <- struct{}{}:
+	default:
+		e.l.Warnf("%s: too many commands waiting for a free slot, dropping %s", h.command[0], rep.Get("event"))
+		return
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer func() { <-h.queue }()
+
+		if err := h.run(rep); err != nil {
+			e.l.Warnf("%s failed: %s", h.command[0], err.Error())
+		}
+	}()
+}
+
+// veto revokes the address allocation of res
+func veto(ctx context.Context, res *dhcpv4.DHCPv4) error {
+	switch {
+	case dhcpserver.Offer(res):
+		return dhcpserver.ErrNoResponse
+
+	case dhcpserver.Ack(res):
+		if db := lease.GetDatabase(ctx); db != nil && !res.YourIPAddr.IsUnspecified() {
+			if err := db.Release(ctx, res.YourIPAddr); err != nil {
+				return err
+			}
+		}
+
+		res.YourIPAddr = net.IPv4zero
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeNak))
+	}
+
+	return nil
+}
+
+// run executes the command of h and returns an error if it failed
+// or did not finish in time
+func (h *hook) run(rep replacer.Replacer) error {
+	if err := h.acquire(); err != nil {
+		return err
+	}
+	defer func() { <-h.sem }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	args := make([]string, len(h.command))
+	for i, a := range h.command {
+		args[i] = rep.Replace(a)
+	}
+
+	cmd := osexec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), environment(rep)...)
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", h.timeout)
+	}
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s: %s", err.Error(), out)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// acquire waits for a free slot to run the command. In sync mode a
+// request must not wait longer than the timeout
+func (h *hook) acquire() error {
+	if !h.sync {
+		h.sem <- struct{}{}
+		return nil
+	}
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+
+	select {
+	case h.sem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("no free slot within %s", h.timeout)
+	}
+}
+
+// environment returns all replacer values as environment variables
+func environment(rep replacer.Replacer) []string {
+	env := make([]string, 0, len(events.Keys))
+	for _, key := range events.Keys {
+		env = append(env, "NEXTDHCP_"+strings.ToUpper(key)+"="+rep.Get(key))
+	}
+
+	return env
+}
@@ -0,0 +1,220 @@
+package exec
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/mockdb"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/nextdhcp/nextdhcp/plugin"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// offer is a handler that assigns 127.0.0.10 and sets the response
+// type depending on the request
+var offer plugin.HandlerFunc = func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	res.YourIPAddr = net.IP{127, 0, 0, 10}
+	if dhcpserver.Request(req) {
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+	} else {
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	}
+	return nil
+}
+
+func newPlugin(t *testing.T, input string) *execPlugin {
+	plg, err := makeExecPlugin(test.CreateTestBed(t, input))
+	require.NoError(t, err)
+	plg.next = offer
+	return plg
+}
+
+func newMessages(t *testing.T, typ dhcpv4.MessageType) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.New(
+		dhcpv4.WithHwAddr(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}),
+		dhcpv4.WithMessageType(typ),
+		dhcpv4.WithOption(dhcpv4.OptHostName("lab")),
+	)
+	require.NoError(t, err)
+
+	res, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+	return req, res
+}
+
+func readFile(t *testing.T, path string) string {
+	var content []byte
+	assert.Eventually(t, func() bool {
+		var err error
+		content, err = os.ReadFile(path)
+		return err == nil && len(content) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	return string(content)
+}
+
+func TestExecAsync(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	plg := newPlugin(t, `
+	exec msgtype == 'DISCOVER' {
+		command sh -c "echo $NEXTDHCP_EVENT $NEXTDHCP_HWADDR $NEXTDHCP_YOURIP $NEXTDHCP_HOSTNAME {oui} > `+out+`"
+	}`)
+
+	req, res := newMessages(t, dhcpv4.MessageTypeRequest)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	plg.wg.Wait()
+	_, err := os.Stat(out)
+	assert.True(t, os.IsNotExist(err))
+
+	req, res = newMessages(t, dhcpv4.MessageTypeDiscover)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	plg.wg.Wait()
+	assert.Equal(t, "request aa:bb:cc:dd:ee:ff 127.0.0.10 lab aa:bb:cc\n", readFile(t, out))
+}
+
+func TestExecSyncVeto(t *testing.T) {
+	plg := newPlugin(t, `
+	exec {
+		command sh -c "test $NEXTDHCP_HOSTNAME != lab"
+		mode sync
+	}`)
+
+	// DHCPOFFER is not sent at all
+	req, res := newMessages(t, dhcpv4.MessageTypeDiscover)
+	assert.Equal(t, dhcpserver.ErrNoResponse, plg.ServeDHCP(context.Background(), req, res))
+
+	// DHCPACK is turned into a DHCPNAK and the lease is released
+	db := new(mockdb.MockDatabase)
+	db.On("Release", net.IP{127, 0, 0, 10}).Return(nil)
+	ctx := lease.WithDatabase(context.Background(), db)
+
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest)
+	require.NoError(t, plg.ServeDHCP(ctx, req, res))
+	assert.Equal(t, dhcpv4.MessageTypeNak, res.MessageType())
+	assert.True(t, res.YourIPAddr.IsUnspecified())
+	db.AssertExpectations(t)
+
+	// other clients are not vetoed
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest)
+	req.UpdateOption(dhcpv4.OptHostName("office"))
+	require.NoError(t, plg.ServeDHCP(ctx, req, res))
+	assert.Equal(t, dhcpv4.MessageTypeAck, res.MessageType())
+	assert.Equal(t, net.IP{127, 0, 0, 10}, res.YourIPAddr)
+}
+
+func TestExecSyncTimeout(t *testing.T) {
+	plg := newPlugin(t, `
+	exec {
+		command sleep 5
+		mode sync
+		timeout 50ms
+	}`)
+
+	start := time.Now()
+	req, res := newMessages(t, dhcpv4.MessageTypeDiscover)
+	assert.Equal(t, dhcpserver.ErrNoResponse, plg.ServeDHCP(context.Background(), req, res))
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+}
+
+func TestExecLeaseEvents(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	plg := newPlugin(t, `
+	exec {
+		command sh -c "echo $NEXTDHCP_EVENT $NEXTDHCP_YOURIP $NEXTDHCP_CLIENTID >> `+out+`"
+		on lease-expired
+	}`)
+
+	unsubscribe := events.Subscribe(plg.handleEvent)
+	defer unsubscribe()
+
+	l := &lease.Lease{
+		Client:  lease.Client{ID: "aa:bb:cc:dd:ee:ff"},
+		Address: net.IP{127, 0, 0, 10},
+		Expires: time.Now(),
+	}
+	events.EmitLeaseEvent(events.EventLeaseCreated, l)
+
+	// leases of other subnets are ignored
+	other := *l
+	other.Address = net.IP{10, 0, 0, 1}
+	events.EmitLeaseEvent(events.EventLeaseExpired, &other)
+
+	events.EmitLeaseEvent(events.EventLeaseExpired, l)
+	plg.wg.Wait()
+
+	assert.Equal(t, "lease-expired 127.0.0.10 aa:bb:cc:dd:ee:ff", strings.TrimSpace(readFile(t, out)))
+}
+
+func TestExecSyncVetoEvents(t *testing.T) {
+	plg := newPlugin(t, `
+	exec {
+		command sh -c "test $NEXTDHCP_HOSTNAME != lab"
+		mode sync
+	}`)
+
+	db := storage.NewDatabase(memory.New())
+	plg.next = plugin.HandlerFunc(func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+		cli := lease.Client{HwAddr: req.ClientHWAddr, Hostname: req.HostName()}
+		if _, err := db.Lease(ctx, net.IP{127, 0, 0, 10}, cli, time.Hour, false); err != nil {
+			return err
+		}
+		return offer(ctx, req, res)
+	})
+
+	var received []string
+	unsubscribe := events.Subscribe(func(e caddy.EventName, l *lease.Lease) error {
+		if l.Address.Equal(net.IP{127, 0, 0, 10}) {
+			received = append(received, string(e))
+		}
+		return nil
+	})
+	defer unsubscribe()
+
+	ctx := lease.WithDatabase(context.Background(), db)
+
+	// a vetoed lease is never reported
+	req, res := newMessages(t, dhcpv4.MessageTypeRequest)
+	require.NoError(t, plg.ServeDHCP(ctx, req, res))
+	assert.Equal(t, dhcpv4.MessageTypeNak, res.MessageType())
+	assert.Empty(t, received)
+
+	// accepted leases are reported once the hooks finished
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest)
+	req.UpdateOption(dhcpv4.OptHostName("office"))
+	require.NoError(t, plg.ServeDHCP(ctx, req, res))
+	assert.Equal(t, dhcpv4.MessageTypeAck, res.MessageType())
+	assert.Equal(t, []string{events.EventLeaseCreated}, received)
+}
+
+func TestExecAsyncQueue(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	plg := newPlugin(t, `
+	exec {
+		command sh -c "sleep 0.1; echo $NEXTDHCP_EVENT >> `+out+`"
+		concurrency 1
+	}`)
+
+	// one command may run, one may wait for a free slot
+	plg.hooks[0].queue = make(chan struct{}, 2)
+
+	for i := 0; i < 5; i++ {
+		req, res := newMessages(t, dhcpv4.MessageTypeDiscover)
+		require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	}
+	plg.wg.Wait()
+
+	assert.Equal(t, "request\nrequest\n", readFile(t, out))
+}
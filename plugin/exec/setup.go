@@ -0,0 +1,184 @@
+package exec
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+const (
+	// defaultTimeout is the default time a command may run
+	defaultTimeout = 5 * time.Second
+
+	// defaultConcurrency is the default number of commands
+	// that may run at the same time per exec block
+	defaultConcurrency = 4
+
+	// maxQueued is the number of asynchronous commands per exec
+	// block that may wait for a free slot. Further commands are
+	// dropped
+	maxQueued = 100
+)
+
+func init() {
+	caddy.RegisterPlugin("exec", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupExec,
+	})
+}
+
+func setupExec(c *caddy.Controller) error {
+	plg, err := makeExecPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	var unsubscribe func()
+	c.OnStartup(func() error {
+		unsubscribe = events.Subscribe(plg.handleEvent)
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+		plg.wg.Wait()
+		return nil
+	})
+
+	return nil
+}
+
+func makeExecPlugin(c *caddy.Controller) (*execPlugin, error) {
+	plg := &execPlugin{}
+	plg.l = log.GetLogger(c, plg)
+
+	var classes []string
+	if cfg := dhcpserver.GetConfig(c); cfg != nil {
+		plg.network = cfg.Network
+		classes = cfg.Classes
+	}
+
+	for c.Next() {
+		cond, err := matcher.SetupMatcherRemainingArgs(c)
+		if err != nil {
+			return nil, err
+		}
+
+		h := &hook{
+			Matcher: cond,
+			events:  make(map[caddy.EventName]bool),
+			timeout: defaultTimeout,
+		}
+		concurrency := defaultConcurrency
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "command":
+				h.command = c.RemainingArgs()
+				if len(h.command) == 0 {
+					return nil, c.ArgErr()
+				}
+
+			case "on":
+				names := c.RemainingArgs()
+				if len(names) == 0 {
+					return nil, c.ArgErr()
+				}
+
+				for _, name := range names {
+					event := caddy.EventName(name)
+					if event != events.EventRequest && !events.IsLeaseEvent(event) {
+						return nil, c.Errf("unknown event %q", name)
+					}
+					h.events[event] = true
+				}
+
+			case "class":
+				h.classes, err = class.ParseSet(c, classes)
+				if err != nil {
+					return nil, err
+				}
+
+			case "timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				d, err := duration.Parse(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid timeout %q: %s", c.Val(), err.Error())
+				}
+				if d <= 0 {
+					return nil, c.Err("timeout must be positive")
+				}
+				h.timeout = d
+
+			case "concurrency":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 1 {
+					return nil, c.SyntaxErr("a positive number")
+				}
+				concurrency = n
+
+			case "mode":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				switch c.Val() {
+				case "sync":
+					h.sync = true
+				case "async":
+					h.sync = false
+				default:
+					return nil, c.SyntaxErr("sync or async")
+				}
+
+			default:
+				return nil, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+
+		if len(h.command) == 0 {
+			return nil, c.Err("command expected")
+		}
+
+		// run for requests if no events are selected
+		if len(h.events) == 0 {
+			h.events[events.EventRequest] = true
+		}
+
+		if h.sync && !h.events[events.EventRequest] {
+			return nil, c.Err("mode sync is only supported for requests")
+		}
+
+		h.sem = make(chan struct{}, concurrency)
+		h.queue = make(chan struct{}, concurrency+maxQueued)
+		plg.hooks = append(plg.hooks, h)
+	}
+
+	return plg, nil
+}
@@ -0,0 +1,72 @@
+package exec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecSetup(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	exec msgtype == 'REQUEST' {
+		command /usr/local/bin/allocate {hwaddr} {yourip}
+		timeout 2s
+		concurrency 1
+		mode sync
+	}
+	exec {
+		command /usr/local/bin/notify
+		on lease-created lease-expired request
+		class voip
+	}
+	`)
+	dhcpserver.GetConfig(c).Classes = []string{"voip"}
+
+	plg, err := makeExecPlugin(c)
+	require.NoError(t, err)
+	require.Len(t, plg.hooks, 2)
+
+	h := plg.hooks[0]
+	assert.Equal(t, []string{"/usr/local/bin/allocate", "{hwaddr}", "{yourip}"}, h.command)
+	assert.Equal(t, map[caddy.EventName]bool{events.EventRequest: true}, h.events)
+	assert.Equal(t, 2*time.Second, h.timeout)
+	assert.Equal(t, 1, cap(h.sem))
+	assert.True(t, h.sync)
+	assert.False(t, h.EmptyCondition())
+
+	h = plg.hooks[1]
+	assert.Equal(t, map[caddy.EventName]bool{
+		events.EventLeaseCreated: true,
+		events.EventLeaseExpired: true,
+		events.EventRequest:      true,
+	}, h.events)
+	assert.Equal(t, defaultTimeout, h.timeout)
+	assert.Equal(t, defaultConcurrency, cap(h.sem))
+	assert.False(t, h.sync)
+	assert.Len(t, h.classes, 1)
+
+	for _, input := range []string{
+		"exec",
+		"exec {\ntimeout 1s\n}",
+		"exec {\ncommand\n}",
+		"exec {\ncommand foo\non\n}",
+		"exec {\ncommand foo\non unknown-event\n}",
+		"exec {\ncommand foo\ntimeout\n}",
+		"exec {\ncommand foo\ntimeout 0s\n}",
+		"exec {\ncommand foo\ntimeout 1s 2s\n}",
+		"exec {\ncommand foo\nconcurrency 0\n}",
+		"exec {\ncommand foo\nmode blocking\n}",
+		"exec {\ncommand foo\non lease-created\nmode sync\n}",
+		"exec {\ncommand foo\nclass unknown\n}",
+		"exec {\ncommand foo\nunknown\n}",
+	} {
+		_, err := makeExecPlugin(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
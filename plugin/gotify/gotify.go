@@ -11,6 +11,7 @@ import (
 	"github.com/gotify/go-api-client/v2/gotify"
 	"github.com/gotify/go-api-client/v2/models"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/log"
 	"github.com/nextdhcp/nextdhcp/core/matcher"
 	"github.com/nextdhcp/nextdhcp/plugin"
@@ -35,10 +36,11 @@ type (
 	// factory for a gotify notification
 	notification struct {
 		*matcher.Matcher
-		msg   msgFactory
-		title msgFactory
-		srv   string
-		token string
+		msg     msgFactory
+		title   msgFactory
+		srv     string
+		token   string
+		classes class.Set
 	}
 
 	// notifyFunc for sending a notification via gotify. Used for unit testing
@@ -58,7 +60,7 @@ var notify notifyFunc = func(gotifyURL *url.URL, token string, msg *message.Crea
 // the message body. An empty message body indicates that no notification should be
 // sent
 func (n *notification) Prepare(ctx context.Context, req, res *dhcpv4.DHCPv4) (string, string, error) {
-	if n.msg == nil {
+	if n.msg == nil || !n.classes.Match(ctx) {
 		return "", "", nil
 	}
 
@@ -11,6 +11,7 @@ import (
 	"github.com/gotify/go-api-client/v2/client/message"
 	"github.com/gotify/go-api-client/v2/models"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/matcher"
 	"github.com/nextdhcp/nextdhcp/plugin/test"
 	"github.com/stretchr/testify/assert"
@@ -73,7 +74,21 @@ func TestNotificationPrepare(t *testing.T) {
 	_, _, err = n.Prepare(ctx, req, res)
 	assert.Error(t, err)
 
+	// should return empty strings if the client is not a member
+	// of the classes
 	n.Matcher = emptyMatcher
+	n.classes = class.Set{"voip"}
+	nt, nm, err = n.Prepare(ctx, req, res)
+	assert.NoError(t, err)
+	assert.Empty(t, nm)
+	assert.Empty(t, nt)
+
+	nt, nm, err = n.Prepare(class.WithClasses(ctx, []string{"voip"}), req, res)
+	assert.NoError(t, err)
+	assert.Equal(t, "some message", nm)
+	assert.Equal(t, "some title", nt)
+	n.classes = nil
+
 	msgErr = errors.New("simulated error")
 	nt, nm, err = n.Prepare(ctx, req, res)
 	assert.Equal(t, msgErr, err)
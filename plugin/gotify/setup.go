@@ -5,6 +5,7 @@ import (
 
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/log"
 	"github.com/nextdhcp/nextdhcp/core/matcher"
@@ -39,10 +40,11 @@ func makeGotifyPlugin(c *caddy.Controller) (*gotifyPlugin, error) {
 
 	for c.Next() {
 		var (
-			msg   msgFactory
-			title msgFactory
-			srv   string
-			token string
+			msg     msgFactory
+			title   msgFactory
+			srv     string
+			token   string
+			classes class.Set
 		)
 
 		cond, err := matcher.SetupMatcherRemainingArgs(c)
@@ -86,6 +88,12 @@ func makeGotifyPlugin(c *caddy.Controller) (*gotifyPlugin, error) {
 				}
 				token = c.Val()
 
+			case "class":
+				classes, err = class.ParseSet(c, dhcpserver.GetConfig(c).Classes)
+				if err != nil {
+					return nil, err
+				}
+
 			default:
 				return nil, c.ArgErr()
 			}
@@ -100,7 +108,7 @@ func makeGotifyPlugin(c *caddy.Controller) (*gotifyPlugin, error) {
 			}
 		}
 
-		if msg == nil && !cond.EmptyCondition() {
+		if msg == nil && (!cond.EmptyCondition() || len(classes) > 0) {
 			return nil, c.Err("Message must not be empty if a condition is set")
 		}
 
@@ -110,6 +118,7 @@ func makeGotifyPlugin(c *caddy.Controller) (*gotifyPlugin, error) {
 			title:   title,
 			srv:     srv,
 			token:   token,
+			classes: classes,
 		}
 
 		g.addNotification(n)
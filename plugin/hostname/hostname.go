@@ -0,0 +1,241 @@
+package hostname
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/dnsname"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+// hostnamePlugin sanitizes and generates client hostnames. It implements
+// plugin.Handler
+type hostnamePlugin struct {
+	next     plugin.Handler
+	template string
+	db       func() lease.Database
+	l        log.Logger
+
+	// mu guards names, clients and seeded
+	mu sync.Mutex
+
+	// names holds the client that uses a hostname
+	names map[string]lease.Client
+
+	// clients holds the hostname used by a client
+	clients map[string]string
+
+	// seeded is set once names has been loaded from the hostnames
+	// stored in the lease database
+	seeded bool
+}
+
+// Name returns "hostname" and implements plugin.Handler
+func (p *hostnamePlugin) Name() string {
+	return "hostname"
+}
+
+// ServeDHCP replaces the hostname of the request with a sanitized or
+// generated one before calling the next handler so all other plugins
+// see the final name. The name is returned in the hostname option if
+// requested by the client. It implements plugin.Handler
+func (p *hostnamePlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	l := log.With(ctx, p.l)
+
+	original := req.HostName()
+	name := dnsname.Sanitize(original)
+	generated := false
+	if name == "" {
+		// for DISCOVER messages the address is not known yet and
+		// the name is generated once the offer is ready
+		name = p.generate(ctx, req, requestedAddress(req))
+		generated = true
+	}
+
+	if name != "" {
+		name = p.claim(ctx, l, name, req.ClientHWAddr)
+		p.rename(l, req, original, name)
+	}
+
+	if err := p.next.ServeDHCP(ctx, req, res); err != nil {
+		return err
+	}
+
+	if !dhcpserver.Offer(res) && !dhcpserver.Ack(res) {
+		return nil
+	}
+
+	if generated {
+		if n := p.generate(ctx, req, res.YourIPAddr); n != "" && n != name {
+			name = p.claim(ctx, l, n, req.ClientHWAddr)
+			p.rename(l, req, original, name)
+		}
+	}
+
+	if name != "" && req.IsOptionRequested(dhcpv4.OptionHostName) {
+		res.UpdateOption(dhcpv4.OptHostName(name))
+	}
+
+	return nil
+}
+
+// rename replaces the hostname option of req with name
+func (p *hostnamePlugin) rename(l log.Logger, req *dhcpv4.DHCPv4, original, name string) {
+	if name == req.HostName() {
+		return
+	}
+
+	if original == "" {
+		l.Debugf("%s: using generated hostname %q", req.ClientHWAddr, name)
+	} else {
+		l.Debugf("%s: renamed %q to %q", req.ClientHWAddr, original, name)
+	}
+
+	req.UpdateOption(dhcpv4.OptHostName(name))
+}
+
+// generate returns a hostname for req and ip using the configured template.
+// An empty string is returned if no template is configured or ip is not
+// known
+func (p *hostnamePlugin) generate(ctx context.Context, req *dhcpv4.DHCPv4, ip net.IP) string {
+	if p.template == "" || ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+
+	// the template is evaluated as if ip had already been assigned
+	msg := *req
+	msg.YourIPAddr = ip
+
+	return dnsname.Sanitize(replacer.NewReplacer(ctx, &msg).Replace(p.template))
+}
+
+// claim reserves name for the client with hwaddr. If name is already used
+// by another client with an active lease a numeric suffix is appended
+func (p *hostnamePlugin) claim(ctx context.Context, l log.Logger, name string, hwaddr net.HardwareAddr) string {
+	cli := lease.Client{
+		HwAddr: hwaddr,
+		ID:     hwaddr.String(),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.seeded {
+		p.seed(ctx, l)
+	}
+
+	candidate := name
+	for i := 2; ; i++ {
+		owner, ok := p.names[candidate]
+		if !ok || owner.ID == cli.ID || !p.active(ctx, l, owner) {
+			break
+		}
+
+		suffix := fmt.Sprintf("-%d", i)
+		base := name
+		if len(base)+len(suffix) > dnsname.MaxLabelLength {
+			base = strings.TrimRight(base[:dnsname.MaxLabelLength-len(suffix)], "-")
+		}
+		candidate = base + suffix
+	}
+
+	if candidate != name {
+		l.Infof("%s: hostname %q is already in use, using %q", hwaddr, name, candidate)
+	}
+
+	if old, ok := p.clients[cli.ID]; ok && old != candidate && p.names[old].ID == cli.ID {
+		delete(p.names, old)
+	}
+	if owner, ok := p.names[candidate]; ok {
+		// the lease of the previous owner is no longer active
+		delete(p.clients, owner.ID)
+	}
+	p.names[candidate] = cli
+	p.clients[cli.ID] = candidate
+
+	return candidate
+}
+
+// seed loads the hostnames of all active leases and static assignments
+// from the lease database so names used before a restart are not handed
+// out twice. The caller must hold p.mu
+func (p *hostnamePlugin) seed(ctx context.Context, l log.Logger) {
+	db := p.db()
+	if db == nil {
+		return
+	}
+
+	leases, err := db.Leases(ctx)
+	if err != nil {
+		l.Warnf("failed to load hostnames from the lease database: %s", err.Error())
+		return
+	}
+
+	for _, ls := range leases {
+		name := dnsname.Sanitize(ls.Hostname)
+		if name == "" || ls.Expired() {
+			continue
+		}
+
+		cli := ls.Client
+		if len(cli.HwAddr) > 0 {
+			cli.ID = cli.HwAddr.String()
+		}
+
+		if _, ok := p.names[name]; ok {
+			continue
+		}
+		if _, ok := p.clients[cli.ID]; ok {
+			continue
+		}
+
+		p.names[name] = cli
+		p.clients[cli.ID] = name
+	}
+
+	p.seeded = true
+}
+
+// active checks if cli has an active lease or a static assignment in the
+// lease database. If the database cannot be queried the lease is expected
+// to be active
+func (p *hostnamePlugin) active(ctx context.Context, l log.Logger, cli lease.Client) bool {
+	db := p.db()
+	if db == nil {
+		return true
+	}
+
+	ip, leased, expires, err := db.FindByClient(ctx, cli)
+	if err != nil {
+		l.Warnf("failed to find lease of %s: %s", cli.ID, err.Error())
+		return true
+	}
+
+	if ip == nil {
+		return false
+	}
+
+	return expires.Equal(lease.Never) || (leased && expires.After(time.Now()))
+}
+
+// requestedAddress returns the address a DHCPREQUEST is asking for
+func requestedAddress(req *dhcpv4.DHCPv4) net.IP {
+	if !dhcpserver.Request(req) {
+		return nil
+	}
+
+	if ip := req.RequestedIPAddress(); ip != nil && !ip.IsUnspecified() {
+		return ip
+	}
+
+	return req.ClientIPAddr
+}
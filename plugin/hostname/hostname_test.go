@@ -0,0 +1,160 @@
+package hostname
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/mockdb"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newMessages(t *testing.T, typ dhcpv4.MessageType, hwaddr net.HardwareAddr, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	modifiers = append([]dhcpv4.Modifier{
+		dhcpv4.WithHwAddr(hwaddr),
+		dhcpv4.WithMessageType(typ),
+		dhcpv4.WithRequestedOptions(dhcpv4.OptionHostName),
+	}, modifiers...)
+
+	req, err := dhcpv4.New(modifiers...)
+	require.NoError(t, err)
+
+	res, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+
+	if typ == dhcpv4.MessageTypeRequest {
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+	} else {
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	}
+
+	return req, res
+}
+
+func TestHostnameServeDHCP(t *testing.T) {
+	plg, err := makeHostnamePlugin(test.CreateTestBed(t, "hostname dhcp-{yourip|dashes}"))
+	require.NoError(t, err)
+
+	var seen string
+	plg.next = test.HandlerFunc(func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+		seen = req.HostName()
+		res.YourIPAddr = net.IP{10, 0, 0, 10}
+		return nil
+	})
+
+	hwaddr := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	// names are sanitized before other plugins see them
+	req, res := newMessages(t, dhcpv4.MessageTypeRequest, hwaddr, dhcpv4.WithOption(dhcpv4.OptHostName("Lab PC")))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "lab-pc", seen)
+	assert.Equal(t, "lab-pc", req.HostName())
+	assert.Equal(t, "lab-pc", res.HostName())
+
+	// names are generated for the requested address
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest, hwaddr, dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.IP{10, 0, 0, 10})))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "dhcp-10-0-0-10", seen)
+	assert.Equal(t, "dhcp-10-0-0-10", res.HostName())
+
+	// offers use the address selected by the rest of the chain
+	req, res = newMessages(t, dhcpv4.MessageTypeDiscover, hwaddr)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "", seen)
+	assert.Equal(t, "dhcp-10-0-0-10", req.HostName())
+	assert.Equal(t, "dhcp-10-0-0-10", res.HostName())
+
+	// the option is only sent if requested
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest, hwaddr, dhcpv4.WithOption(dhcpv4.OptHostName("lab")))
+	req.UpdateOption(dhcpv4.OptParameterRequestList(dhcpv4.OptionRouter))
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "lab", seen)
+	assert.Equal(t, "", res.HostName())
+
+	// nothing is generated without template
+	plg.template = ""
+	req, res = newMessages(t, dhcpv4.MessageTypeDiscover, hwaddr)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "", req.HostName())
+	assert.Equal(t, "", res.HostName())
+}
+
+func TestHostnameDuplicates(t *testing.T) {
+	plg, err := makeHostnamePlugin(test.CreateTestBed(t, "hostname"))
+	require.NoError(t, err)
+	plg.next = test.HandlerFunc(func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+		return nil
+	})
+
+	db := new(mockdb.MockDatabase)
+	db.On("Leases").Return([]lease.Lease{}, nil).Once()
+	plg.db = func() lease.Database {
+		return db
+	}
+
+	first := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	second := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}
+	third := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x03}
+
+	serve := func(hwaddr net.HardwareAddr, name string) string {
+		req, res := newMessages(t, dhcpv4.MessageTypeRequest, hwaddr, dhcpv4.WithOption(dhcpv4.OptHostName(name)))
+		require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+		return res.HostName()
+	}
+
+	assert.Equal(t, "lab", serve(first, "lab"))
+	assert.Equal(t, "lab", serve(first, "LAB"))
+
+	// all clients have active leases
+	db.On("FindByClient", mock.Anything).Return(net.IP{10, 0, 0, 1}, true, time.Now().Add(time.Hour), nil)
+
+	assert.Equal(t, "lab-2", serve(second, "lab"))
+	assert.Equal(t, "lab-3", serve(third, "lab"))
+	db.AssertExpectations(t)
+
+	// the name is free again once the lease expired
+	db.ExpectedCalls = nil
+	db.On("FindByClient", mock.Anything).Return(net.IP{10, 0, 0, 1}, true, time.Now().Add(-time.Hour), nil)
+	assert.Equal(t, "lab", serve(third, "lab"))
+	assert.Equal(t, "lab-2", serve(first, "lab-2"))
+}
+
+func TestHostnameDuplicatesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	first := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	second := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02}
+
+	// names used before the restart are kept in the lease database
+	_, err := db.Lease(ctx, net.IP{10, 0, 0, 1}, lease.Client{HwAddr: first, Hostname: "lab"}, time.Hour, false)
+	require.NoError(t, err)
+	require.NoError(t, db.ReserveStatic(ctx, net.IP{10, 0, 0, 2}, lease.Client{ID: "printer", Hostname: "printer"}))
+
+	plg, err := makeHostnamePlugin(test.CreateTestBed(t, "hostname"))
+	require.NoError(t, err)
+	plg.next = test.HandlerFunc(func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+		return nil
+	})
+	plg.db = func() lease.Database {
+		return db
+	}
+
+	serve := func(hwaddr net.HardwareAddr, name string) string {
+		req, res := newMessages(t, dhcpv4.MessageTypeRequest, hwaddr, dhcpv4.WithOption(dhcpv4.OptHostName(name)))
+		require.NoError(t, plg.ServeDHCP(ctx, req, res))
+		return res.HostName()
+	}
+
+	assert.Equal(t, "lab-2", serve(second, "lab"))
+	assert.Equal(t, "printer-2", serve(second, "printer"))
+	assert.Equal(t, "lab", serve(first, "lab"))
+}
@@ -0,0 +1,78 @@
+package hostname
+
+import (
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+func init() {
+	caddy.RegisterPlugin("hostname", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupHostname,
+	})
+}
+
+func setupHostname(c *caddy.Controller) error {
+	plg, err := makeHostnamePlugin(c)
+	if err != nil {
+		return err
+	}
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	return nil
+}
+
+func makeHostnamePlugin(c *caddy.Controller) (*hostnamePlugin, error) {
+	cfg := dhcpserver.GetConfig(c)
+
+	plg := &hostnamePlugin{
+		db: func() lease.Database {
+			return cfg.LeaseDatabase()
+		},
+		names:   make(map[string]lease.Client),
+		clients: make(map[string]string),
+	}
+	plg.l = log.GetLogger(c, plg)
+
+	seen := false
+	for c.Next() {
+		if seen {
+			return nil, c.Err("hostname can only be configured once per subnet")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return nil, c.ArgErr()
+		}
+		if len(args) == 1 {
+			plg.template = args[0]
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "generate":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				plg.template = c.Val()
+
+			default:
+				return nil, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	return plg, nil
+}
@@ -0,0 +1,37 @@
+package hostname
+
+import (
+	"testing"
+
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostnameSetup(t *testing.T) {
+	cases := []struct {
+		I        string
+		Template string
+	}{
+		{"hostname", ""},
+		{"hostname dhcp-{yourip|dashes}", "dhcp-{yourip|dashes}"},
+		{"hostname {\ngenerate host-{hwaddr|dashes}\n}", "host-{hwaddr|dashes}"},
+	}
+
+	for _, c := range cases {
+		plg, err := makeHostnamePlugin(test.CreateTestBed(t, c.I))
+		require.NoError(t, err, c.I)
+		assert.Equal(t, c.Template, plg.template, c.I)
+	}
+
+	for _, input := range []string{
+		"hostname a b",
+		"hostname {\ngenerate\n}",
+		"hostname {\ngenerate a b\n}",
+		"hostname {\nunknown\n}",
+		"hostname\nhostname",
+	} {
+		_, err := makeHostnamePlugin(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
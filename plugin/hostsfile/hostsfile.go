@@ -0,0 +1,244 @@
+package hostsfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dnsname"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+)
+
+// Supported file formats
+const (
+	formatHosts   = "hosts"
+	formatDnsmasq = "dnsmasq"
+	formatUnbound = "unbound"
+)
+
+// header is written at the top of each file
+const header = "# generated by NextDHCP, do not edit\n"
+
+// exporter keeps a file with the hostnames of all active leases of a
+// subnet up to date
+type exporter struct {
+	path    string
+	format  string
+	domain  string
+	ttl     time.Duration
+	reload  []string
+	timeout time.Duration
+	network net.IPNet
+	db      func() lease.Database
+	l       log.Logger
+
+	// last holds the content that has been written last
+	last []byte
+
+	trigger chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Name returns "hostsfile"
+func (e *exporter) Name() string {
+	return "hostsfile"
+}
+
+// Start writes the file and starts updating it whenever triggered by
+// a lease event
+func (e *exporter) Start() {
+	e.stop = make(chan struct{})
+
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-e.trigger:
+				if err := e.update(); err != nil {
+					e.l.Errorf("failed to update %s: %s", e.path, err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops updating the file and waits for a running update to
+// finish
+func (e *exporter) Stop() {
+	if e.stop == nil {
+		return
+	}
+
+	close(e.stop)
+	e.wg.Wait()
+	e.stop = nil
+}
+
+// handleEvent triggers an update of the file for lease events of the
+// subnet. Multiple events are coalesced into a single update
+func (e *exporter) handleEvent(_ caddy.EventName, l *lease.Lease) error {
+	// events are emitted for all subnets
+	if !e.network.Contains(l.Address) {
+		return nil
+	}
+
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// update writes the file and runs the reload command if the active
+// leases changed since the last update
+func (e *exporter) update() error {
+	db := e.db()
+	if db == nil {
+		return nil
+	}
+
+	leases, err := db.Leases(context.Background())
+	if err != nil {
+		return err
+	}
+
+	content := e.render(leases, time.Now())
+	if bytes.Equal(content, e.last) {
+		return nil
+	}
+
+	if err := writeFile(e.path, content); err != nil {
+		return err
+	}
+	e.last = content
+	e.l.Debugf("updated %s", e.path)
+
+	if len(e.reload) == 0 {
+		return nil
+	}
+
+	return e.runReload()
+}
+
+// runReload runs the reload command
+func (e *exporter) runReload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	cmd := osexec.CommandContext(ctx, e.reload[0], e.reload[1:]...)
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", e.reload[0], e.timeout)
+	}
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s failed: %s: %s", e.reload[0], err.Error(), out)
+		}
+		return fmt.Errorf("%s failed: %s", e.reload[0], err.Error())
+	}
+
+	return nil
+}
+
+// render returns the file content for all leases that are active at
+// now and have a valid hostname. Entries are sorted by address
+func (e *exporter) render(leases []lease.Lease, now time.Time) []byte {
+	sort.Slice(leases, func(i, j int) bool {
+		return bytes.Compare(leases[i].Address.To4(), leases[j].Address.To4()) < 0
+	})
+
+	var b bytes.Buffer
+	b.WriteString(header)
+
+	ttl := int64(e.ttl / time.Second)
+	for _, l := range leases {
+		if !e.network.Contains(l.Address) {
+			continue
+		}
+		if !l.Expires.Equal(lease.Never) && l.Expires.Before(now) {
+			continue
+		}
+
+		host := dnsname.Label(l.Hostname)
+		if host == "" {
+			continue
+		}
+
+		ip := l.Address.To4().String()
+		switch e.format {
+		case formatUnbound:
+			name := host + "." + e.domain + "."
+			fmt.Fprintf(&b, "local-data: \"%s %d IN A %s\"\n", name, ttl, ip)
+			fmt.Fprintf(&b, "local-data-ptr: \"%s %d %s\"\n", ip, ttl, name)
+		default:
+			if e.domain != "" {
+				fmt.Fprintf(&b, "%s\t%s.%s %s\n", ip, host, e.domain, host)
+			} else {
+				fmt.Fprintf(&b, "%s\t%s\n", ip, host)
+			}
+		}
+	}
+
+	return b.Bytes()
+}
+
+// writeFile atomically replaces the file at path with data by writing
+// to a temporary file in the same directory first
+func writeFile(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
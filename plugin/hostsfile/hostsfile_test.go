@@ -0,0 +1,126 @@
+package hostsfile
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLeases() []lease.Lease {
+	now := time.Now()
+	return []lease.Lease{
+		{Client: lease.Client{Hostname: "Printer"}, Address: net.IP{127, 0, 0, 20}, Expires: lease.Never},
+		{Client: lease.Client{Hostname: "lab.example.com"}, Address: net.IP{127, 0, 0, 10}, Expires: now.Add(time.Hour)},
+		{Client: lease.Client{Hostname: "expired"}, Address: net.IP{127, 0, 0, 11}, Expires: now.Add(-time.Hour)},
+		{Client: lease.Client{Hostname: "Lab PC"}, Address: net.IP{127, 0, 0, 12}, Expires: now.Add(time.Hour)},
+		{Client: lease.Client{}, Address: net.IP{127, 0, 0, 13}, Expires: now.Add(time.Hour)},
+		{Client: lease.Client{Hostname: "remote"}, Address: net.IP{10, 0, 0, 10}, Expires: now.Add(time.Hour)},
+	}
+}
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		I string
+		O string
+	}{
+		{
+			"hostsfile hosts",
+			header +
+				"127.0.0.10\tlab\n" +
+				"127.0.0.20\tprinter\n",
+		},
+		{
+			"hostsfile hosts dnsmasq {\ndomain lan\n}",
+			header +
+				"127.0.0.10\tlab.lan lab\n" +
+				"127.0.0.20\tprinter.lan printer\n",
+		},
+		{
+			"hostsfile hosts unbound {\ndomain lan\nttl 5m\n}",
+			header +
+				"local-data: \"lab.lan. 300 IN A 127.0.0.10\"\n" +
+				"local-data-ptr: \"127.0.0.10 300 lab.lan.\"\n" +
+				"local-data: \"printer.lan. 300 IN A 127.0.0.20\"\n" +
+				"local-data-ptr: \"127.0.0.20 300 printer.lan.\"\n",
+		},
+	}
+
+	for _, c := range cases {
+		e, err := makeExporter(test.CreateTestBed(t, c.I))
+		require.NoError(t, err, c.I)
+		assert.Equal(t, c.O, string(e.render(testLeases(), time.Now())), c.I)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	marker := filepath.Join(dir, "reloaded")
+
+	e, err := makeExporter(test.CreateTestBed(t, "hostsfile "+path+" {\nreload touch "+marker+"\n}"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+	e.db = func() lease.Database {
+		return db
+	}
+
+	hwaddr := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	_, err = db.Lease(ctx, net.IP{127, 0, 0, 10}, lease.Client{HwAddr: hwaddr, ID: hwaddr.String(), Hostname: "lab"}, time.Hour, false)
+	require.NoError(t, err)
+
+	require.NoError(t, e.update())
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, header+"127.0.0.10\tlab\n", string(content))
+	assert.FileExists(t, marker)
+
+	// nothing is written or reloaded if the leases did not change
+	require.NoError(t, os.Remove(marker))
+	require.NoError(t, e.update())
+	assert.NoFileExists(t, marker)
+
+	// the file is updated on lease events
+	e.Start()
+	defer e.Stop()
+
+	unsubscribe := events.Subscribe(e.handleEvent)
+	defer unsubscribe()
+
+	require.NoError(t, db.Release(ctx, net.IP{127, 0, 0, 10}))
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(path)
+		return err == nil && string(content) == header
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(marker)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestReloadFailure(t *testing.T) {
+	e, err := makeExporter(test.CreateTestBed(t, "hostsfile "+filepath.Join(t.TempDir(), "hosts")+" {\nreload false\n}"))
+	require.NoError(t, err)
+	e.db = func() lease.Database {
+		return storage.NewDatabase(memory.New())
+	}
+
+	assert.Error(t, e.update())
+}
@@ -0,0 +1,173 @@
+package hostsfile
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
+)
+
+const (
+	// defaultTTL is the TTL of unbound records
+	defaultTTL = time.Minute
+
+	// defaultTimeout is the default time the reload command may run
+	defaultTimeout = 30 * time.Second
+)
+
+// pathsKey is the key of the paths used by all hostsfile directives
+// of a server instance
+type pathsKey struct{}
+
+func init() {
+	caddy.RegisterPlugin("hostsfile", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupHostsfile,
+	})
+}
+
+func setupHostsfile(c *caddy.Controller) error {
+	e, err := makeExporter(c)
+	if err != nil {
+		return err
+	}
+
+	var unsubscribe func()
+	c.OnStartup(func() error {
+		e.Start()
+		unsubscribe = events.Subscribe(e.handleEvent)
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+		e.Stop()
+		return nil
+	})
+
+	return nil
+}
+
+func makeExporter(c *caddy.Controller) (*exporter, error) {
+	cfg := dhcpserver.GetConfig(c)
+
+	e := &exporter{
+		format:  formatHosts,
+		ttl:     defaultTTL,
+		timeout: defaultTimeout,
+		network: cfg.Network,
+		db: func() lease.Database {
+			return cfg.LeaseDatabase()
+		},
+		trigger: make(chan struct{}, 1),
+	}
+	e.l = log.GetLogger(c, e)
+
+	seen := false
+	for c.Next() {
+		if seen {
+			return nil, c.Err("hostsfile can only be configured once per subnet")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return nil, c.ArgErr()
+		}
+		e.path = args[0]
+		if len(args) == 2 {
+			e.format = args[1]
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "format":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				e.format = c.Val()
+
+			case "domain":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				e.domain = strings.Trim(strings.ToLower(c.Val()), ".")
+				if e.domain == "" {
+					return nil, c.Errf("invalid domain %q", c.Val())
+				}
+
+			case "ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := duration.Parse(c.Val())
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				e.ttl = d
+
+			case "reload":
+				e.reload = c.RemainingArgs()
+				if len(e.reload) == 0 {
+					return nil, c.ArgErr()
+				}
+				continue
+
+			case "timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := duration.Parse(c.Val())
+				if err != nil || d <= 0 {
+					return nil, c.SyntaxErr("positive duration")
+				}
+				e.timeout = d
+
+			default:
+				return nil, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	switch e.format {
+	case formatHosts, formatDnsmasq:
+	case formatUnbound:
+		if e.domain == "" {
+			return nil, c.Err("hostsfile: the unbound format requires a domain")
+		}
+	default:
+		return nil, c.Errf("hostsfile: unknown format %q", e.format)
+	}
+
+	path, err := filepath.Abs(e.path)
+	if err != nil {
+		return nil, c.Errf("hostsfile: %s", err.Error())
+	}
+	e.path = path
+
+	// each exporter replaces the whole file so multiple subnets or
+	// blocks writing the same file would overwrite each other
+	paths, _ := c.Get(pathsKey{}).(map[string]bool)
+	if paths == nil {
+		paths = make(map[string]bool)
+		c.Set(pathsKey{}, paths)
+	}
+	if paths[path] {
+		return nil, c.Errf("hostsfile: %s is already used by a different subnet", path)
+	}
+	paths[path] = true
+
+	return e, nil
+}
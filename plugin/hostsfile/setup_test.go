@@ -0,0 +1,76 @@
+package hostsfile
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/caddyfile"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostsfileSetup(t *testing.T) {
+	e, err := makeExporter(test.CreateTestBed(t, "hostsfile /etc/hosts.dhcp"))
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/hosts.dhcp", e.path)
+	assert.Equal(t, formatHosts, e.format)
+	assert.Equal(t, "", e.domain)
+	assert.Empty(t, e.reload)
+
+	e, err = makeExporter(test.CreateTestBed(t, `hostsfile leases.conf unbound {
+		domain Lan.
+		ttl 5m
+		reload unbound-control reload
+		timeout 10s
+	}`))
+	require.NoError(t, err)
+	abs, _ := filepath.Abs("leases.conf")
+	assert.Equal(t, abs, e.path)
+	assert.Equal(t, formatUnbound, e.format)
+	assert.Equal(t, "lan", e.domain)
+	assert.Equal(t, 5*time.Minute, e.ttl)
+	assert.Equal(t, []string{"unbound-control", "reload"}, e.reload)
+	assert.Equal(t, 10*time.Second, e.timeout)
+
+	e, err = makeExporter(test.CreateTestBed(t, "hostsfile /etc/addn-hosts {\nformat dnsmasq\n}"))
+	require.NoError(t, err)
+	assert.Equal(t, formatDnsmasq, e.format)
+
+	for _, input := range []string{
+		"hostsfile",
+		"hostsfile a hosts b",
+		"hostsfile a bind",
+		"hostsfile a unbound",
+		"hostsfile a {\ndomain .\n}",
+		"hostsfile a {\nreload\n}",
+		"hostsfile a {\nttl soon\n}",
+		"hostsfile a {\ntimeout 0s\n}",
+		"hostsfile a {\nunknown\n}",
+		"hostsfile a\nhostsfile b",
+	} {
+		_, err := makeExporter(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestHostsfileSharedPath(t *testing.T) {
+	c := test.CreateTestBed(t, "hostsfile /etc/hosts.dhcp")
+	_, err := makeExporter(c)
+	require.NoError(t, err)
+
+	// a different subnet of the same instance
+	c.Dispenser = caddyfile.NewDispenser("Testfile", strings.NewReader("hostsfile /etc/../etc/hosts.dhcp dnsmasq"))
+	_, err = makeExporter(c)
+	assert.Error(t, err)
+
+	c.Dispenser = caddyfile.NewDispenser("Testfile", strings.NewReader("hostsfile /etc/addn-hosts"))
+	_, err = makeExporter(c)
+	assert.NoError(t, err)
+
+	// new instances, for example after a restart, may use the path again
+	_, err = makeExporter(test.CreateTestBed(t, "hostsfile /etc/hosts.dhcp"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,250 @@
+package httpboot
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
+)
+
+// templateSuffix is the file extension of files that are rendered
+// using the replacer before being sent to the client
+const templateSuffix = ".tmpl"
+
+// rootFS is a http.FileSystem that opens files through an os.Root so
+// neither ".." nor symbolic links can escape the root directory
+type rootFS struct {
+	http.FileSystem
+	root *os.Root
+}
+
+// openRootFS opens dir as a http.FileSystem. Use Close to release the
+// directory
+func openRootFS(dir string) (*rootFS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rootFS{
+		FileSystem: http.FS(root.FS()),
+		root:       root,
+	}, nil
+}
+
+// Close closes the root directory
+func (fs *rootFS) Close() error {
+	return fs.root.Close()
+}
+
+// Server serves boot and provisioning files via HTTP. Files ending in
+// .tmpl are rendered with the replacer values of the requesting client's
+// current IP address lease
+type Server struct {
+	// Root is the directory to serve files from
+	Root http.FileSystem
+
+	// Database returns the lease database used to lookup the lease of
+	// requesting clients. It's a function because the database of a
+	// subnet may only be opened after all plugins have been setup
+	Database func() lease.Database
+
+	// L is the logger to use
+	L log.Logger
+
+	l   sync.Mutex
+	srv *http.Server
+	ln  net.Listener
+}
+
+// Name returns "http-boot"
+func (s *Server) Name() string {
+	return "http-boot"
+}
+
+// ListenAndServe starts listening on addr and serves HTTP requests
+// in a dedicated goroutine. Use Close to stop the server
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:     s,
+		ReadTimeout: 30 * time.Second,
+	}
+
+	s.l.Lock()
+	s.srv = srv
+	s.ln = ln
+	s.l.Unlock()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.L.Errorf("http-boot: server stopped: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the local address the server is listening on or nil
+// if the server has not been started
+func (s *Server) Addr() net.Addr {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.ln == nil {
+		return nil
+	}
+
+	return s.ln.Addr()
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	s.l.Lock()
+	srv := s.srv
+	s.srv = nil
+	s.ln = nil
+	s.l.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+
+	return srv.Close()
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+
+	if strings.HasSuffix(name, templateSuffix) {
+		s.serveTemplate(w, r, name)
+		return
+	}
+
+	f, err := s.Root.Open(name)
+	if err == nil {
+		stat, err := f.Stat()
+		f.Close()
+
+		// directory listings would expose the names of templates
+		if err != nil || stat.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		s.L.Infof("http-boot: serving %s to %s", name, r.RemoteAddr)
+		http.FileServer(s.Root).ServeHTTP(w, r)
+		return
+	}
+
+	// if there's no such file we check if there's a template that
+	// can be rendered instead
+	s.serveTemplate(w, r, name+templateSuffix)
+}
+
+func (s *Server) serveTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := s.Root.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		s.L.Errorf("http-boot: failed to read %s: %s", name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	l, err := s.findLease(r.Context(), net.ParseIP(host))
+	if err != nil {
+		s.L.Errorf("http-boot: failed to lookup lease for %s: %s", host, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if l == nil {
+		s.L.Warnf("http-boot: denying template %s for %s: no active lease", name, host)
+		http.NotFound(w, r)
+		return
+	}
+
+	rep := newLeaseReplacer(r.Context(), l)
+	body := []byte(rep.Replace(string(content)))
+
+	s.L.Infof("http-boot: serving rendered template %s to %s (%s)", name, host, l.HwAddr)
+	http.ServeContent(w, r, strings.TrimSuffix(name, templateSuffix), stat.ModTime(), bytes.NewReader(body))
+}
+
+// findLease searches the lease database for an active lease of ip. It returns
+// nil if there's no such lease
+func (s *Server) findLease(ctx context.Context, ip net.IP) (*lease.Lease, error) {
+	ip = ip.To4()
+	if ip == nil || s.Database == nil {
+		return nil, nil
+	}
+
+	db := s.Database()
+	if db == nil {
+		return nil, nil
+	}
+
+	l, err := db.FindByIP(ctx, ip)
+	if err != nil || l == nil || l.Expired() {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// newLeaseReplacer returns a replacer for the client of l. Since there's no
+// DHCP message for HTTP requests a message is synthesized from the lease
+func newLeaseReplacer(ctx context.Context, l *lease.Lease) replacer.Replacer {
+	msg, _ := dhcpv4.New(
+		dhcpv4.WithHwAddr(l.HwAddr),
+		dhcpv4.WithYourIP(l.Address),
+		dhcpv4.WithClientIP(l.Address),
+	)
+	if l.Hostname != "" {
+		msg.UpdateOption(dhcpv4.OptHostName(l.Hostname))
+	}
+
+	rep := replacer.NewReplacer(ctx, msg)
+	rep.Set("expires", replacer.StringValue(l.Expires.Format(time.RFC3339)))
+
+	return rep
+}
@@ -0,0 +1,125 @@
+package httpboot
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/mockdb"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPBootSetup(t *testing.T) {
+	dir := t.TempDir()
+
+	c := test.CreateTestBed(t, "http-boot "+dir)
+	srv, addr, err := makeHTTPBootServer(c)
+	require.NoError(t, err)
+	assert.NotNil(t, srv.Root)
+	assert.Equal(t, "127.0.0.1:80", addr)
+
+	c = test.CreateTestBed(t, "http-boot {\nroot "+dir+"\nport 8080\n}")
+	_, addr, err = makeHTTPBootServer(c)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", addr)
+
+	for _, input := range []string{
+		"http-boot",
+		"http-boot " + filepath.Join(dir, "missing"),
+		"http-boot " + dir + " {\nport foo\n}",
+		"http-boot " + dir + " {\nfoo bar\n}",
+	} {
+		c = test.CreateTestBed(t, input)
+		_, _, err = makeHTTPBootServer(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestHTTPBootServe(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vmlinuz"), []byte("kernel"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "profiles"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ks.cfg.tmpl"), []byte("network --hostname=host-{hwaddr} --ip={yourip} \\{literal\\}"), 0o644))
+
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.tmpl"), []byte("secret {hwaddr}"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "escape")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.tmpl"), filepath.Join(dir, "escape.tmpl")))
+	require.NoError(t, os.Symlink("vmlinuz", filepath.Join(dir, "kernel")))
+
+	db := &mockdb.MockDatabase{}
+	db.On("FindByIP", net.IP{10, 0, 0, 10}).Return(&lease.Lease{
+		Client:  lease.Client{HwAddr: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, ID: "aa:bb:cc:dd:ee:ff"},
+		Address: net.IP{10, 0, 0, 10},
+		Expires: time.Now().Add(time.Hour),
+	}, nil)
+	db.On("FindByIP", net.IP{10, 0, 0, 11}).Return(&lease.Lease{
+		Client:  lease.Client{HwAddr: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x00}, ID: "aa:bb:cc:dd:ee:00"},
+		Address: net.IP{10, 0, 0, 11},
+		Expires: time.Now().Add(-time.Hour),
+	}, nil)
+	db.On("FindByIP", net.IP{10, 0, 0, 99}).Return(nil, nil)
+
+	fsys, err := openRootFS(dir)
+	require.NoError(t, err)
+	defer fsys.Close()
+
+	srv := &Server{
+		Root:     fsys,
+		Database: func() lease.Database { return db },
+		L:        log.Log,
+	}
+
+	get := func(path, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/vmlinuz", "10.0.0.99:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "kernel", rec.Body.String())
+
+	for _, path := range []string{"/ks.cfg", "/ks.cfg.tmpl"} {
+		rec = get(path, "10.0.0.10:1234")
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "network --hostname=host-aa:bb:cc:dd:ee:ff --ip=10.0.0.10 {literal}", rec.Body.String(), path)
+	}
+
+	// expired leases and unknown clients must not get a rendered template
+	assert.Equal(t, http.StatusNotFound, get("/ks.cfg", "10.0.0.11:1234").Code)
+	assert.Equal(t, http.StatusNotFound, get("/ks.cfg", "10.0.0.99:1234").Code)
+
+	assert.Equal(t, http.StatusNotFound, get("/missing", "10.0.0.10:1234").Code)
+
+	// directories are never listed
+	assert.Equal(t, http.StatusNotFound, get("/", "10.0.0.10:1234").Code)
+	assert.Equal(t, http.StatusNotFound, get("/profiles/", "10.0.0.10:1234").Code)
+	assert.Equal(t, http.StatusNotFound, get("/../../etc/passwd", "10.0.0.10:1234").Code)
+
+	// symbolic links are only followed inside the root directory
+	rec = get("/kernel", "10.0.0.10:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "kernel", rec.Body.String())
+	for _, path := range []string{"/escape", "/escape.tmpl"} {
+		rec = get(path, "10.0.0.10:1234")
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+		assert.NotContains(t, rec.Body.String(), "secret", path)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/vmlinuz", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
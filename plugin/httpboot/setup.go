@@ -0,0 +1,133 @@
+package httpboot
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+)
+
+func init() {
+	caddy.RegisterPlugin("http-boot", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupHTTPBoot,
+	})
+}
+
+func setupHTTPBoot(c *caddy.Controller) error {
+	srv, addr, err := makeHTTPBootServer(c)
+	if err != nil {
+		return err
+	}
+
+	start := func() error {
+		if err := srv.ListenAndServe(addr); err != nil {
+			return fmt.Errorf("failed to start HTTP boot server on %s: %s", addr, err.Error())
+		}
+		srv.L.Infof("serving boot files via HTTP on %s", addr)
+		return nil
+	}
+
+	stop := func() error {
+		return srv.Close()
+	}
+
+	// The new instance is started before the old one is shut down
+	// during restarts so we need to release the listener in OnRestart
+	c.OnStartup(start)
+	c.OnRestart(stop)
+	c.OnRestartFailed(start)
+	c.OnFinalShutdown(stop)
+
+	// the root directory is kept open until the instance is gone for
+	// good, including restarts that failed
+	c.OnShutdown(func() error {
+		if root, ok := srv.Root.(io.Closer); ok {
+			return root.Close()
+		}
+		return nil
+	})
+
+	return nil
+}
+
+func makeHTTPBootServer(c *caddy.Controller) (*Server, string, error) {
+	cfg := dhcpserver.GetConfig(c)
+
+	var root string
+	port := 80
+	seen := false
+
+	for c.Next() {
+		if seen {
+			return nil, "", c.Err("http-boot can only be configured once per subnet")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return nil, "", c.ArgErr()
+		}
+		if len(args) == 1 {
+			root = args[0]
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "root":
+				if !c.NextArg() {
+					return nil, "", c.ArgErr()
+				}
+				root = c.Val()
+			case "port":
+				if !c.NextArg() {
+					return nil, "", c.ArgErr()
+				}
+				p, err := strconv.ParseUint(c.Val(), 10, 16)
+				if err != nil {
+					return nil, "", c.SyntaxErr("port number")
+				}
+				port = int(p)
+			default:
+				return nil, "", c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, "", c.ArgErr()
+			}
+		}
+	}
+
+	if root == "" {
+		return nil, "", c.Err("http-boot: root directory required")
+	}
+
+	stat, err := os.Stat(root)
+	if err != nil {
+		return nil, "", c.Errf("http-boot: %s", err.Error())
+	}
+	if !stat.IsDir() {
+		return nil, "", c.Errf("http-boot: %s is not a directory", root)
+	}
+
+	fsys, err := openRootFS(root)
+	if err != nil {
+		return nil, "", c.Errf("http-boot: %s", err.Error())
+	}
+
+	srv := &Server{
+		Root: fsys,
+		Database: func() lease.Database {
+			return cfg.LeaseDatabase()
+		},
+	}
+	srv.L = log.GetLogger(c, srv)
+
+	return srv, net.JoinHostPort(cfg.IP.String(), strconv.Itoa(port)), nil
+}
@@ -6,8 +6,10 @@ import (
 
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
 	"github.com/nextdhcp/nextdhcp/plugin"
 )
 
@@ -21,19 +23,43 @@ func init() {
 type leaseTimePlugin struct {
 	next      plugin.Handler
 	leaseTime time.Duration
+
+	// restricted holds lease times for members of client classes
+	restricted []classLeaseTime
+}
+
+// classLeaseTime is a lease time used for members of at least
+// one of the classes
+type classLeaseTime struct {
+	classes   class.Set
+	leaseTime time.Duration
 }
 
 func (p *leaseTimePlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
 	if dhcpserver.Discover(req) || dhcpserver.Request(req) {
 		code := dhcpv4.OptionIPAddressLeaseTime.Code()
 		if _, ok := res.Options[code]; !ok {
-			res.UpdateOption(dhcpv4.OptIPAddressLeaseTime(p.leaseTime))
+			if d := p.leaseTimeFor(ctx); d > 0 {
+				res.UpdateOption(dhcpv4.OptIPAddressLeaseTime(d))
+			}
 		}
 	}
 
 	return p.next.ServeDHCP(ctx, req, res)
 }
 
+// leaseTimeFor returns the lease time of the first client class the
+// client of ctx is a member of or the default lease time
+func (p *leaseTimePlugin) leaseTimeFor(ctx context.Context) time.Duration {
+	for _, r := range p.restricted {
+		if r.classes.Match(ctx) {
+			return r.leaseTime
+		}
+	}
+
+	return p.leaseTime
+}
+
 func (p *leaseTimePlugin) Name() string {
 	return "lease"
 }
@@ -41,25 +67,60 @@ func (p *leaseTimePlugin) Name() string {
 func setupLease(c *caddy.Controller) error {
 	config := dhcpserver.GetConfig(c)
 
+	plg, err := makeLeaseTimePlugin(c)
+	if err != nil {
+		return err
+	}
+
+	if plg.leaseTime > 0 {
+		config.LeaseTime = plg.leaseTime
+	}
+
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	return nil
+}
+
+func makeLeaseTimePlugin(c *caddy.Controller) (*leaseTimePlugin, error) {
+	config := dhcpserver.GetConfig(c)
+	plg := &leaseTimePlugin{}
+
 	for c.Next() {
 		if !c.NextArg() {
-			return c.ArgErr()
+			return nil, c.ArgErr()
 		}
 
-		d, err := time.ParseDuration(c.Val())
+		d, err := duration.Parse(c.Val())
 		if err != nil {
-			return c.SyntaxErr("time.Duration")
+			return nil, c.SyntaxErr("time.Duration")
 		}
 
-		config.LeaseTime = d
-	}
+		var classes class.Set
+		for c.NextBlock() {
+			switch c.Val() {
+			case "class":
+				classes, err = class.ParseSet(c, config.Classes)
+				if err != nil {
+					return nil, err
+				}
+			default:
+				return nil, c.ArgErr()
+			}
+		}
 
-	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
-		return &leaseTimePlugin{
-			next:      next,
-			leaseTime: config.LeaseTime,
+		if len(classes) == 0 {
+			plg.leaseTime = d
+			continue
 		}
-	})
 
-	return nil
+		plg.restricted = append(plg.restricted, classLeaseTime{
+			classes:   classes,
+			leaseTime: d,
+		})
+	}
+
+	return plg, nil
 }
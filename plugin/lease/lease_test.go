@@ -0,0 +1,51 @@
+package lease
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseTimeClasses(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	lease 1h
+	lease 10m {
+		class guests
+	}
+	`)
+	dhcpserver.GetConfig(c).Classes = []string{"guests"}
+
+	plg, err := makeLeaseTimePlugin(c)
+	require.NoError(t, err)
+	plg.next = test.NoOpHandler
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, time.Hour, res.IPAddressLeaseTime(0))
+
+	ctx := class.WithClasses(context.Background(), []string{"guests"})
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(ctx, req, res))
+	assert.Equal(t, 10*time.Minute, res.IPAddressLeaseTime(0))
+
+	for _, input := range []string{
+		"lease",
+		"lease forever",
+		"lease 1h {\nclass unknown\n}",
+		"lease 1h {\nfoo\n}",
+	} {
+		c = test.CreateTestBed(t, input)
+		_, err = makeLeaseTimePlugin(c)
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,49 @@
+package match
+
+import (
+	"context"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+// matchPlugin runs a nested middleware chain for requests that match
+// a condition. Other requests are passed to the next handler. It
+// implements the plugin.Handler interface
+type matchPlugin struct {
+	*matcher.Matcher
+
+	next plugin.Handler
+	l    log.Logger
+
+	// expr is the condition of the block
+	expr string
+
+	// nested builds the middleware chain of the block and
+	// chain is the result
+	nested plugin.Plugin
+	chain  plugin.Handler
+}
+
+// Name implements the plugin.Handler interface and returns "match"
+func (m *matchPlugin) Name() string {
+	return "match"
+}
+
+// ServeDHCP implements the plugin.Handler interface
+func (m *matchPlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	matched, err := m.Match(ctx, req)
+	if err != nil {
+		log.With(ctx, m.l).Warnf("failed to match condition %q: %s", m.expr, err.Error())
+		return m.next.ServeDHCP(ctx, req, res)
+	}
+
+	if !matched {
+		return m.next.ServeDHCP(ctx, req, res)
+	}
+
+	// the nested chain ends with m.next
+	return m.chain.ServeDHCP(ctx, req, res)
+}
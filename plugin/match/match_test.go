@@ -0,0 +1,76 @@
+package match
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/nextdhcp/nextdhcp/plugin/lease"
+	_ "github.com/nextdhcp/nextdhcp/plugin/option"
+)
+
+func TestMatchSetup(t *testing.T) {
+	for _, input := range []string{
+		"match",
+		"match true",
+		"match true {\n}",
+		"match true {\nunknown 1\n}",
+		"match true {\nclass foo {\nif true\n}\n}",
+		"match true {\nlease forever\n}",
+		"match 'string {\nlease 1h\n}",
+		"match true {\nlease 1h",
+	} {
+		c := test.CreateTestBed(t, input)
+		_, err := makeMatchPlugins(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMatchServeDHCP(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	match {>class-identifier} == 'PXEClient' {
+		option {
+			router 10.0.0.2
+			tftp-server-name tftp.example.com
+		}
+		lease 10m
+	}
+	`)
+	blocks, err := makeMatchPlugins(c)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+
+	m := blocks[0]
+	nextCalled := false
+	m.next = test.HandlerFunc(func(_ context.Context, req, res *dhcpv4.DHCPv4) error {
+		nextCalled = true
+		return nil
+	})
+	m.chain = m.nested(m.next)
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	req.UpdateOption(dhcpv4.OptParameterRequestList(dhcpv4.OptionRouter, dhcpv4.OptionTFTPServerName))
+
+	// requests that don't match are passed to the next handler
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, m.ServeDHCP(context.Background(), req, res))
+	assert.True(t, nextCalled)
+	assert.Nil(t, res.Router())
+	assert.Equal(t, time.Duration(0), res.IPAddressLeaseTime(0))
+
+	// matching requests run through the nested chain
+	nextCalled = false
+	req.UpdateOption(dhcpv4.OptClassIdentifier("PXEClient"))
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, m.ServeDHCP(context.Background(), req, res))
+	assert.True(t, nextCalled)
+	assert.Equal(t, []net.IP{{10, 0, 0, 2}}, res.Router())
+	assert.Equal(t, "tftp.example.com", res.TFTPServerName())
+	assert.Equal(t, 10*time.Minute, res.IPAddressLeaseTime(0))
+}
@@ -0,0 +1,150 @@
+package match
+
+import (
+	"strings"
+
+	"github.com/caddyserver/caddy"
+	"github.com/caddyserver/caddy/caddyfile"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+func init() {
+	caddy.RegisterPlugin("match", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupMatch,
+	})
+}
+
+// serverDirectives configure the server block itself and cannot be
+// used inside a match block
+var serverDirectives = map[string]bool{
+	"log":       true,
+	"database":  true,
+	"interface": true,
+	"class":     true,
+}
+
+func setupMatch(c *caddy.Controller) error {
+	blocks, err := makeMatchPlugins(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := dhcpserver.GetConfig(c)
+	for _, m := range blocks {
+		m := m
+		cfg.AddPlugin(func(next plugin.Handler) plugin.Handler {
+			m.next = next
+			m.chain = m.nested(next)
+			return m
+		})
+	}
+
+	return nil
+}
+
+func makeMatchPlugins(c *caddy.Controller) ([]*matchPlugin, error) {
+	var blocks []*matchPlugin
+
+	for c.Next() {
+		expr := strings.Join(c.RemainingArgs(), " ")
+		if expr == "" {
+			return nil, c.ArgErr()
+		}
+
+		cond, err := matcher.SetupMatcherString(expr)
+		if err != nil {
+			return nil, c.Errf("invalid condition %q: %s", expr, err.Error())
+		}
+
+		tokens, err := parseNestedTokens(c)
+		if err != nil {
+			return nil, err
+		}
+
+		nested, err := dhcpserver.SetupNested(c, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		m := &matchPlugin{
+			Matcher: cond,
+			expr:    expr,
+			nested:  nested,
+		}
+		m.l = log.GetLogger(c, m)
+
+		blocks = append(blocks, m)
+	}
+
+	return blocks, nil
+}
+
+// parseNestedTokens collects the tokens of the block following the
+// current line grouped by directive
+func parseNestedTokens(c *caddy.Controller) (map[string][]caddyfile.Token, error) {
+	if !c.Next() || c.Val() != "{" {
+		return nil, c.SyntaxErr("{")
+	}
+
+	tokens := make(map[string][]caddyfile.Token)
+	dir := ""
+	depth := 0
+	line := c.Line()
+
+	for {
+		if !c.Next() {
+			return nil, c.EOFErr()
+		}
+
+		if depth == 0 && c.Val() == "}" {
+			break
+		}
+
+		// directives start at the beginning of a line
+		if depth == 0 && (dir == "" || c.Line() > line) {
+			dir = c.Val()
+
+			if !isDirective(dir) {
+				return nil, c.Errf("unknown directive %q", dir)
+			}
+
+			if serverDirectives[dir] {
+				return nil, c.Errf("%s cannot be used inside match", dir)
+			}
+		}
+
+		switch c.Val() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+
+		tokens[dir] = append(tokens[dir], caddyfile.Token{
+			File: c.File(),
+			Line: c.Line(),
+			Text: c.Val(),
+		})
+		line = c.Line()
+	}
+
+	if len(tokens) == 0 {
+		return nil, c.Err("match block must not be empty")
+	}
+
+	return tokens, nil
+}
+
+func isDirective(name string) bool {
+	for _, d := range dhcpserver.Directives {
+		if d == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -8,6 +8,7 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/log"
 	"github.com/nextdhcp/nextdhcp/core/matcher"
 	"github.com/nextdhcp/nextdhcp/plugin"
@@ -37,6 +38,7 @@ type (
 		name    string // optional name for the mqtt config
 		topic   msgFactory
 		payload msgFactory
+		classes class.Set
 	}
 
 	mqttPlugin struct {
@@ -60,6 +62,10 @@ func (m *mqttPlugin) ServeDHCP(ctx context.Context, req *dhcpv4.DHCPv4, resp *dh
 	}
 
 	for _, cfg := range m.configs {
+		if !cfg.classes.Match(ctx) {
+			continue
+		}
+
 		go func(cfg *mqttConfig) {
 			match, err := cfg.Match(ctx, req)
 			if err != nil {
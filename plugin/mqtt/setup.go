@@ -7,6 +7,7 @@ import (
 
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/log"
 	"github.com/nextdhcp/nextdhcp/core/matcher"
@@ -72,6 +73,12 @@ func setupMqtt(c *caddy.Controller) error {
 
 				cfg.payload = getStringFactory(c.Val())
 
+			case "class":
+				cfg.classes, err = class.ParseSet(c, dhcpserver.GetConfig(c).Classes)
+				if err != nil {
+					return err
+				}
+
 			case "payload-from":
 				//
 				// TODO(ppacher): payload-from allows to execute an external script and use it's output
@@ -79,7 +86,7 @@ func setupMqtt(c *caddy.Controller) error {
 				// that calls an external binary/script and use that for publishing to MQTT.
 				//
 				plg.l.Warnf("payload-from: use of unofficial directive detected")
-				plg.l.Warnf("payload-from: this directive may vanish in future versions.")
+				plg.l.Warnf("payload-from: this directive may vanish in future versions. Consider using the exec plugin instead.")
 
 				cmd := c.RemainingArgs()
 				if len(cmd) == 0 {
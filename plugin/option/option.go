@@ -2,15 +2,18 @@ package option
 
 import (
 	"context"
-	"encoding/hex"
+	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/nextdhcp/nextdhcp/core/log"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
 	"github.com/nextdhcp/nextdhcp/core/option"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
 	"github.com/nextdhcp/nextdhcp/plugin"
 )
 
@@ -20,6 +23,53 @@ type Plugin struct {
 	Next    plugin.Handler
 	Options map[dhcpv4.OptionCode]dhcpv4.OptionValue
 	L       log.Logger
+
+	// dynamic holds options that are restricted to client classes,
+	// guarded by a condition or rendered per request. They are
+	// evaluated in the order they have been configured
+	dynamic []*optionLine
+}
+
+// optionLine is a single option that must be evaluated for each
+// request
+type optionLine struct {
+	code   dhcpv4.OptionCode
+	name   string
+	values []string
+
+	// value holds the parsed value of the option. It is nil if
+	// values contain placeholders
+	value dhcpv4.OptionValue
+
+	// classes restricts the option to members of at least one
+	// of the client classes
+	classes class.Set
+
+	// cond is an optional condition that must match
+	cond *matcher.Matcher
+	expr string
+
+	// always is set if the option should be sent even if the
+	// client did not request it
+	always bool
+
+	// vendor is set if the line configures a sub-option of the
+	// vendor specific information option (43). code holds the
+	// sub-option code in this case
+	vendor bool
+}
+
+// requested returns true if o should be sent in response to req
+func (o *optionLine) requested(req *dhcpv4.DHCPv4) bool {
+	if o.always {
+		return true
+	}
+
+	if o.vendor {
+		return req.IsOptionRequested(dhcpv4.OptionVendorSpecificInformation)
+	}
+
+	return req.IsOptionRequested(o.code)
 }
 
 // Name implements the plugin.Handler interface and returns "option"
@@ -31,11 +81,48 @@ func (p *Plugin) Name() string {
 // if they are requested
 func (p *Plugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
 	if dhcpserver.Discover(req) || dhcpserver.Request(req) {
-		for code, value := range p.Options {
-			if req.IsOptionRequested(code) {
-				// TODO(ppacher): should we only set the option if no plugin above us already
-				// did it?
-				res.UpdateOption(dhcpv4.OptGeneric(code, value.ToBytes()))
+		setOptions(req, res, p.Options)
+
+		// options that are restricted or rendered per request
+		// take precedence
+		l := log.With(ctx, p.L)
+		var vendorOpts vendorOptions
+		for _, o := range p.dynamic {
+			if !o.requested(req) || !o.classes.Match(ctx) {
+				continue
+			}
+
+			if o.cond != nil {
+				matched, err := o.cond.Match(ctx, req)
+				if err != nil {
+					l.Warnf("failed to match condition for option %s (%s): %s", o.name, o.expr, err.Error())
+					continue
+				}
+				if !matched {
+					continue
+				}
+			}
+
+			value, err := o.render(ctx, req)
+			if err != nil {
+				l.Warnf("%s: invalid value for option %s: %s", req.ClientHWAddr, o.name, err.Error())
+				continue
+			}
+
+			if o.vendor {
+				vendorOpts.set(o.code.Code(), value.ToBytes())
+				continue
+			}
+
+			res.UpdateOption(dhcpv4.OptGeneric(o.code, value.ToBytes()))
+		}
+
+		if len(vendorOpts) > 0 {
+			data, err := vendorOpts.encode()
+			if err != nil {
+				l.Warnf("%s: invalid vendor options: %s", req.ClientHWAddr, err.Error())
+			} else {
+				res.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, data))
 			}
 		}
 	}
@@ -43,50 +130,116 @@ func (p *Plugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
 	return p.Next.ServeDHCP(ctx, req, res)
 }
 
-func (p *Plugin) parseOption(name string, values []string) error {
-	c, v, err := option.ParseKnown(name, values)
-	if err != nil {
-		if err != option.ErrUnknownOption {
-			return err
+// setOptions adds all options requested by req to res
+func setOptions(req, res *dhcpv4.DHCPv4, options map[dhcpv4.OptionCode]dhcpv4.OptionValue) {
+	for code, value := range options {
+		if req.IsOptionRequested(code) {
+			// TODO(ppacher): should we only set the option if no plugin above us already
+			// did it?
+			res.UpdateOption(dhcpv4.OptGeneric(code, value.ToBytes()))
 		}
+	}
+}
+
+// vendorOptions holds the sub-options of the vendor specific
+// information option in the order they have been configured
+type vendorOptions []vendorOption
+
+type vendorOption struct {
+	code uint8
+	data []byte
+}
 
-		// check if we can parse a custom option
-		c, v, err = parseCustomOption(name, values)
-		if err != nil {
-			return err
+// set sets the value of a sub-option. An existing value is replaced
+func (v *vendorOptions) set(code uint8, data []byte) {
+	for i := range *v {
+		if (*v)[i].code == code {
+			(*v)[i].data = data
+			return
 		}
 	}
 
-	p.Options[c] = v
+	*v = append(*v, vendorOption{code, data})
+}
+
+// encode encodes all sub-options as code/length/value triplets
+func (v vendorOptions) encode() ([]byte, error) {
+	var data []byte
+	for _, o := range v {
+		if len(o.data) > 255 {
+			return nil, fmt.Errorf("sub-option %d exceeds 255 bytes", o.code)
+		}
 
-	return nil
+		data = append(data, o.code, uint8(len(o.data)))
+		data = append(data, o.data...)
+	}
+
+	return data, nil
 }
 
-func parseCustomOption(name string, values []string) (dhcpv4.OptionCode, dhcpv4.OptionValue, error) {
-	// ParseUint handles octal, hex and binary values as well so let's just try to get a byte option
-	// code
-	code, err := strconv.ParseUint(name, 0, 8)
-	if err != nil {
-		return nil, nil, err
+// add adds an option line to the plugin. Options that do not need to be
+// evaluated per request are stored in Options
+func (p *Plugin) add(o *optionLine) {
+	if o.value != nil && o.cond == nil && len(o.classes) == 0 && !o.always && !o.vendor {
+		p.Options[o.code] = o.value
+		return
 	}
 
-	var payloads [][]byte
-	for _, v := range values {
-		v = strings.TrimPrefix(v, "0x")
+	p.dynamic = append(p.dynamic, o)
+}
+
+// render returns the value of the option for req. Placeholders
+// are replaced before the value is parsed
+func (o *optionLine) render(ctx context.Context, req *dhcpv4.DHCPv4) (dhcpv4.OptionValue, error) {
+	if o.value != nil {
+		return o.value, nil
+	}
+
+	rep := replacer.NewReplacer(ctx, req)
+	values := make([]string, len(o.values))
+	for i, v := range o.values {
+		values[i] = rep.Replace(v)
+	}
 
-		b, err := hex.DecodeString(v)
-		if err != nil {
-			return nil, nil, err
+	_, value, err := option.Parse(o.name, values)
+	return value, err
+}
+
+// splitCondition splits args at the first "if" and returns the option
+// values and the condition expression
+func splitCondition(args []string) ([]string, string) {
+	for i, a := range args {
+		if a == "if" {
+			return args[:i], strings.Join(args[i+1:], " ")
+		}
+	}
+
+	return args, ""
+}
+
+// hasPlaceholder returns true if one of values contains a
+// replacer placeholder
+func hasPlaceholder(values []string) bool {
+	for _, v := range values {
+		if idx := strings.Index(v, "{"); idx >= 0 && strings.Contains(v[idx:], "}") {
+			return true
 		}
+	}
 
-		payloads = append(payloads, b)
+	return false
+}
+
+// optionCode returns the option code for a well-known option name
+// or a custom option code
+func optionCode(name string) (dhcpv4.OptionCode, error) {
+	if code, ok := option.Code(name); ok {
+		return code, nil
 	}
 
-	// now merge the payloads into one byte slice
-	value := dhcpv4.OptionGeneric{}
-	for _, p := range payloads {
-		value.Data = append(value.Data, p...)
+	c, err := strconv.ParseUint(name, 0, 8)
+	if err != nil {
+		return nil, option.ErrUnknownOption
 	}
 
-	return dhcpv4.GenericOptionCode(code), value, nil
+	return dhcpv4.GenericOptionCode(c), nil
 }
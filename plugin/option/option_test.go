@@ -1,11 +1,18 @@
 package option
 
 import (
+	"context"
+	"net"
 	"testing"
 
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/option"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCustomOption(t *testing.T) {
@@ -47,7 +54,7 @@ func TestCustomOption(t *testing.T) {
 	}
 
 	for idx, c := range cases {
-		o, v, err := parseCustomOption(c.Name, c.Value)
+		o, v, err := option.ParseCustom(c.Name, c.Value)
 
 		if err == nil {
 			assert.Equal(t, c.Code, o.Code(), "case %d: code does not match", idx)
@@ -82,3 +89,157 @@ func TestSetupPlugin(t *testing.T) {
 
 	}
 }
+
+func TestClassOptions(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	option router 10.0.0.1
+	option {
+		class voip
+		router 10.0.0.2
+		tftp-server-name tftp.example.com
+	}
+	`)
+	dhcpserver.GetConfig(c).Classes = []string{"voip"}
+
+	plg, err := makeOptionPlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.NoOpHandler
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	req.UpdateOption(dhcpv4.OptParameterRequestList(dhcpv4.OptionRouter, dhcpv4.OptionTFTPServerName))
+
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, []net.IP{{10, 0, 0, 1}}, res.Router())
+	assert.Equal(t, "", res.TFTPServerName())
+
+	ctx := class.WithClasses(context.Background(), []string{"voip"})
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(ctx, req, res))
+	assert.Equal(t, []net.IP{{10, 0, 0, 2}}, res.Router())
+	assert.Equal(t, "tftp.example.com", res.TFTPServerName())
+
+	c = test.CreateTestBed(t, "option {\nclass guests\nrouter 10.0.0.1\n}")
+	_, err = makeOptionPlugin(c)
+	assert.Error(t, err)
+}
+
+func TestTemplatedOptions(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	option hostname dev-{hostname}
+	option {
+		root-path /nfs/{hostname}
+		router 10.0.0.2 if {hostname} == 'lab'
+		router 10.0.0.3 if {hostname} == 'office'
+	}
+	option nameserver {hostname}
+	`)
+
+	plg, err := makeOptionPlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.NoOpHandler
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	req.UpdateOption(dhcpv4.OptHostName("lab"))
+	req.UpdateOption(dhcpv4.OptParameterRequestList(
+		dhcpv4.OptionHostName,
+		dhcpv4.OptionRootPath,
+		dhcpv4.OptionRouter,
+		dhcpv4.OptionDomainNameServer,
+	))
+
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "dev-lab", res.HostName())
+	assert.Equal(t, "/nfs/lab", res.RootPath())
+	assert.Equal(t, []net.IP{{10, 0, 0, 2}}, res.Router())
+
+	// "lab" is not a valid IP address so the option must be skipped
+	assert.Nil(t, res.DNS())
+
+	req.UpdateOption(dhcpv4.OptHostName("office"))
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "dev-office", res.HostName())
+	assert.Equal(t, []net.IP{{10, 0, 0, 3}}, res.Router())
+
+	req.UpdateOption(dhcpv4.OptHostName("other"))
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Nil(t, res.Router())
+}
+
+func TestTemplatedOptionsSetup(t *testing.T) {
+	cases := []struct {
+		I string
+		E bool
+	}{
+		{"option router {gwip}", false},
+		{"option 0x10 {hostname}", false},
+		{"option router 10.0.0.1 if [hostname] == 'lab'", false},
+		{"option unknown-name {hostname}", true},
+		{"option router 10.0.0.1 if", true},
+		{"option router if [hostname] == 'lab'", true},
+		{"option router 10.0.0.1 if [hostname] ==", true},
+		{"option router not-an-ip if [hostname] == 'lab'", true},
+	}
+
+	for idx, c := range cases {
+		_, err := makeOptionPlugin(test.CreateTestBed(t, c.I))
+		if c.E {
+			assert.Error(t, err, "case %d", idx)
+		} else {
+			assert.NoError(t, err, "case %d", idx)
+		}
+	}
+}
+
+func TestAlwaysAndVendorOptions(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	option router 10.0.0.1
+	option always tftp-server-name tftp.example.com
+	option {
+		always vendor-option 1 0x0a000001
+		vendor-option 0x02 0xff if [hostname] == 'lab'
+		always 0xe0 0x01
+	}
+	`)
+
+	plg, err := makeOptionPlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.NoOpHandler
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	req.UpdateOption(dhcpv4.OptParameterRequestList(dhcpv4.OptionSubnetMask))
+
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Nil(t, res.Router())
+	assert.Equal(t, "tftp.example.com", res.TFTPServerName())
+	assert.Equal(t, []byte{1, 4, 10, 0, 0, 1}, res.Options.Get(dhcpv4.OptionVendorSpecificInformation))
+	assert.Equal(t, []byte{0x01}, res.Options.Get(dhcpv4.GenericOptionCode(0xe0)))
+
+	// sub-options without always require option 43 to be requested
+	req.UpdateOption(dhcpv4.OptHostName("lab"))
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, []byte{1, 4, 10, 0, 0, 1}, res.Options.Get(dhcpv4.OptionVendorSpecificInformation))
+
+	req.UpdateOption(dhcpv4.OptParameterRequestList(dhcpv4.OptionVendorSpecificInformation))
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, []byte{1, 4, 10, 0, 0, 1, 2, 1, 0xff}, res.Options.Get(dhcpv4.OptionVendorSpecificInformation))
+
+	cases := []string{
+		"option always",
+		"option always router",
+		"option vendor-option",
+		"option vendor-option foo 0x01",
+		"option vendor-option 0x100 0x01",
+		"option vendor-option 1 not-hex",
+	}
+	for _, input := range cases {
+		_, err := makeOptionPlugin(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
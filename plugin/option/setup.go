@@ -1,10 +1,15 @@
 package option
 
 import (
+	"strconv"
+
 	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/option"
 	"github.com/nextdhcp/nextdhcp/plugin"
 )
 
@@ -16,51 +21,132 @@ func init() {
 }
 
 func setupOption(c *caddy.Controller) error {
+	plg, err := makeOptionPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.Next = next
+		return plg
+	})
+	return nil
+}
+
+func makeOptionPlugin(c *caddy.Controller) (*Plugin, error) {
+	cfg := dhcpserver.GetConfig(c)
 	plg := &Plugin{
 		Options: make(map[dhcpv4.OptionCode]dhcpv4.OptionValue),
 	}
+	plg.L = log.GetLogger(c, plg)
 
 	for c.Next() {
-		if c.NextBlock() {
-			name := c.Val()
-			values := c.RemainingArgs()
-			if len(values) == 0 {
-				return c.ArgErr()
-			}
-
-			if err := plg.parseOption(name, values); err != nil {
-				return err
-			}
+		var lines []*optionLine
+		var classes class.Set
 
-			for c.NextBlock() {
-				name = c.Val()
-				values = c.RemainingArgs()
-				if len(values) == 0 {
-					return c.ArgErr()
-				}
+		isBlock := false
+		for c.NextBlock() {
+			isBlock = true
+			name := c.Val()
 
-				if err := plg.parseOption(name, values); err != nil {
-					return err
+			if name == "class" {
+				s, err := class.ParseSet(c, cfg.Classes)
+				if err != nil {
+					return nil, err
 				}
+				classes = s
+				continue
 			}
 
-		} else if c.NextArg() {
-			name := c.Val()
-			values := c.RemainingArgs()
-			if len(values) == 0 {
-				return c.ArgErr()
+			o, err := parseOptionLine(c, name, c.RemainingArgs())
+			if err != nil {
+				return nil, err
 			}
+			lines = append(lines, o)
+		}
 
-			if err := plg.parseOption(name, values); err != nil {
-				return err
+		if !isBlock && c.NextArg() {
+			o, err := parseOptionLine(c, c.Val(), c.RemainingArgs())
+			if err != nil {
+				return nil, err
 			}
+			lines = append(lines, o)
+		}
+
+		for _, o := range lines {
+			o.classes = classes
+			plg.add(o)
 		}
 	}
 
-	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		plg.Next = next
-		return plg
-	})
-	plg.L = log.GetLogger(c, plg)
-	return nil
+	return plg, nil
+}
+
+// parseOptionLine parses an option line in the format
+// [always] NAME VALUE... [if CONDITION] or
+// [always] vendor-option CODE VALUE... [if CONDITION]
+func parseOptionLine(c *caddy.Controller, name string, args []string) (*optionLine, error) {
+	always := false
+	if name == "always" {
+		if len(args) == 0 {
+			return nil, c.ArgErr()
+		}
+		always = true
+		name, args = args[0], args[1:]
+	}
+
+	vendor := false
+	if name == "vendor-option" {
+		if len(args) == 0 {
+			return nil, c.ArgErr()
+		}
+		if _, err := strconv.ParseUint(args[0], 0, 8); err != nil {
+			return nil, c.Errf("invalid vendor sub-option code %q", args[0])
+		}
+		vendor = true
+		name, args = args[0], args[1:]
+	}
+
+	values, expr := splitCondition(args)
+	if len(values) == 0 {
+		return nil, c.ArgErr()
+	}
+
+	o := &optionLine{
+		name:   name,
+		values: values,
+		always: always,
+		vendor: vendor,
+	}
+
+	if expr != "" {
+		m, err := matcher.SetupMatcherString(expr)
+		if err != nil {
+			return nil, c.Errf("invalid condition for option %s: %s", name, err.Error())
+		}
+		o.cond = m
+		o.expr = expr
+	} else if len(values) < len(args) {
+		return nil, c.Errf("missing condition for option %s", name)
+	}
+
+	// values with placeholders can only be validated once they
+	// have been rendered for a request
+	if hasPlaceholder(values) {
+		code, err := optionCode(name)
+		if err != nil {
+			return nil, c.Errf("%s: %s", name, err.Error())
+		}
+		o.code = code
+		return o, nil
+	}
+
+	code, value, err := option.Parse(name, values)
+	if err != nil {
+		return nil, err
+	}
+	o.code = code
+	o.value = value
+
+	return o, nil
 }
@@ -0,0 +1,190 @@
+package provision
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+const (
+	// optionTFTPServerAddress is the Cisco proprietary TFTP server address
+	// option (RFC 5859)
+	optionTFTPServerAddress = 150
+
+	// Juniper vendor specific sub-options used with option 43
+	juniperImageFile    = 0
+	juniperConfigFile   = 1
+	juniperTransferMode = 3
+)
+
+type (
+	// settings holds the rendered provisioning values for a single client
+	settings struct {
+		servers      []string
+		config       string
+		image        string
+		transferMode string
+		vendorInfo   []vendorInfo
+	}
+
+	// vendorInfo holds the sub-options for a single enterprise number
+	// used in the V-I vendor specific information option
+	vendorInfo struct {
+		enterprise uint32
+		sub        []subOption
+	}
+
+	// subOption is a code/value pair used in vendor specific options
+	subOption struct {
+		code  uint8
+		value []byte
+	}
+
+	// vendor describes how provisioning settings are encoded for the
+	// devices of a specific vendor
+	vendor struct {
+		// condition is the default condition used to select the profile
+		condition string
+
+		// image and transferMode are true if the vendor supports the
+		// respective setting
+		image        bool
+		transferMode bool
+
+		// build returns the DHCP options for s
+		build func(s *settings) ([]dhcpv4.Option, error)
+	}
+)
+
+// vendors holds all supported provisioning profiles
+var vendors = map[string]*vendor{
+	"generic": {
+		build: func(s *settings) ([]dhcpv4.Option, error) {
+			return withVendorInfo(s, serverNameAndBootfile(s))
+		},
+	},
+	"cisco": {
+		condition: vendorCondition("cisco", "00:00:0c", "00:01:42", "00:01:43", "00:01:63", "00:01:64"),
+		build: func(s *settings) ([]dhcpv4.Option, error) {
+			return withVendorInfo(s, append(serverNameAndBootfile(s), tftpServerAddress(s)...))
+		},
+	},
+	"arista": {
+		condition: vendorCondition("arista", "00:1c:73", "28:99:3a", "44:4c:a8", "74:83:ef", "98:5d:82", "fc:bd:67"),
+		build: func(s *settings) ([]dhcpv4.Option, error) {
+			return withVendorInfo(s, serverNameAndBootfile(s))
+		},
+	},
+	"juniper": {
+		condition:    vendorCondition("juniper", "00:05:85", "00:12:1e", "00:19:e2", "2c:6b:f5", "3c:61:04", "88:e0:f3", "f4:b5:2f"),
+		image:        true,
+		transferMode: true,
+		build: func(s *settings) ([]dhcpv4.Option, error) {
+			var opts []dhcpv4.Option
+			if len(s.servers) > 0 {
+				opts = append(opts, dhcpv4.OptTFTPServerName(s.servers[0]))
+			}
+			opts = append(opts, tftpServerAddress(s)...)
+
+			var sub []subOption
+			if s.image != "" {
+				sub = append(sub, subOption{juniperImageFile, []byte(s.image)})
+			}
+			if s.config != "" {
+				sub = append(sub, subOption{juniperConfigFile, []byte(s.config)})
+			}
+			if s.transferMode != "" {
+				sub = append(sub, subOption{juniperTransferMode, []byte(s.transferMode)})
+			}
+			if len(sub) > 0 {
+				data, err := encodeSubOptions(sub)
+				if err != nil {
+					return nil, err
+				}
+				opts = append(opts, dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, data))
+			}
+
+			return withVendorInfo(s, opts)
+		},
+	},
+}
+
+// vendorCondition returns a condition that matches devices that send
+// a class identifier containing name or use a MAC address with one of
+// the OUIs of the vendor. The OUIs are well known prefixes of the vendor
+// but by no means complete
+func vendorCondition(name string, ouis ...string) string {
+	quoted := make([]string, len(ouis))
+	for i, oui := range ouis {
+		quoted[i] = "'" + oui + "'"
+	}
+
+	return fmt.Sprintf("[>class-identifier] =~ '(?i)%s' || oui in (%s)", name, strings.Join(quoted, ", "))
+}
+
+// serverNameAndBootfile returns the TFTP server name (66) and
+// bootfile name (67) options
+func serverNameAndBootfile(s *settings) []dhcpv4.Option {
+	var opts []dhcpv4.Option
+	if len(s.servers) > 0 {
+		opts = append(opts, dhcpv4.OptTFTPServerName(s.servers[0]))
+	}
+	if s.config != "" {
+		opts = append(opts, dhcpv4.OptBootFileName(s.config))
+	}
+	return opts
+}
+
+// tftpServerAddress returns option 150 holding all servers that are
+// IPv4 addresses
+func tftpServerAddress(s *settings) []dhcpv4.Option {
+	var data []byte
+	for _, srv := range s.servers {
+		if ip := net.ParseIP(srv).To4(); ip != nil {
+			data = append(data, ip...)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return []dhcpv4.Option{dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(optionTFTPServerAddress), data)}
+}
+
+// withVendorInfo appends the V-I vendor specific information option (125)
+// as defined in RFC 3925 to opts
+func withVendorInfo(s *settings, opts []dhcpv4.Option) ([]dhcpv4.Option, error) {
+	if len(s.vendorInfo) == 0 {
+		return opts, nil
+	}
+
+	var data []byte
+	for _, vi := range s.vendorInfo {
+		payload, err := encodeSubOptions(vi.sub)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) > 255 {
+			return nil, fmt.Errorf("vendor information for enterprise %d exceeds 255 bytes", vi.enterprise)
+		}
+		data = binary.BigEndian.AppendUint32(data, vi.enterprise)
+		data = append(data, byte(len(payload)))
+		data = append(data, payload...)
+	}
+
+	return append(opts, dhcpv4.OptGeneric(dhcpv4.OptionVendorIdentifyingVendorSpecific, data)), nil
+}
+
+func encodeSubOptions(sub []subOption) ([]byte, error) {
+	var data []byte
+	for _, o := range sub {
+		if len(o.value) > 255 {
+			return nil, fmt.Errorf("value of sub-option %d exceeds 255 bytes", o.code)
+		}
+		data = append(data, o.code, byte(len(o.value)))
+		data = append(data, o.value...)
+	}
+	return data, nil
+}
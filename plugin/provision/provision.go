@@ -0,0 +1,122 @@
+package provision
+
+import (
+	"context"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+type (
+	// profile is a provisioning profile for network devices. The first
+	// profile that matches a request is used
+	profile struct {
+		*matcher.Matcher
+
+		name         string
+		vendor       *vendor
+		servers      []string
+		config       string
+		image        string
+		transferMode string
+		vendorInfo   []vendorInfoTemplate
+	}
+
+	// vendorInfoTemplate is a templated sub-option of the V-I vendor
+	// specific information option
+	vendorInfoTemplate struct {
+		enterprise uint32
+		code       uint8
+		value      string
+	}
+
+	// provisionPlugin configures zero-touch provisioning options for
+	// network devices. It implements plugin.Handler
+	provisionPlugin struct {
+		next     plugin.Handler
+		profiles []*profile
+		l        log.Logger
+	}
+)
+
+// Name returns "provision" and implements plugin.Handler
+func (p *provisionPlugin) Name() string {
+	return "provision"
+}
+
+// ServeDHCP adds the provisioning options of the first matching profile
+// and implements plugin.Handler
+func (p *provisionPlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	if dhcpserver.Discover(req) || dhcpserver.Request(req) || dhcpserver.Inform(req) {
+		l := log.With(ctx, p.l)
+
+		for _, prof := range p.profiles {
+			matched, err := prof.Match(ctx, req)
+			if err != nil {
+				l.Warnf("failed to match provisioning profile %s: %s", prof.name, err.Error())
+				continue
+			}
+
+			if !matched {
+				continue
+			}
+
+			opts, err := prof.options(ctx, req)
+			if err != nil {
+				l.Errorf("failed to build provisioning profile %s: %s", prof.name, err.Error())
+				break
+			}
+
+			for _, o := range opts {
+				res.UpdateOption(o)
+			}
+
+			l.Debugf("applied provisioning profile %s", prof.name)
+			break
+		}
+	}
+
+	return p.next.ServeDHCP(ctx, req, res)
+}
+
+// options renders all templates of the profile for req and returns the
+// resulting DHCP options
+func (prof *profile) options(ctx context.Context, req *dhcpv4.DHCPv4) ([]dhcpv4.Option, error) {
+	rep := replacer.NewReplacer(ctx, req)
+
+	s := &settings{
+		config:       rep.Replace(prof.config),
+		image:        rep.Replace(prof.image),
+		transferMode: prof.transferMode,
+	}
+
+	for _, srv := range prof.servers {
+		if v := rep.Replace(srv); v != "" {
+			s.servers = append(s.servers, v)
+		}
+	}
+
+	for _, vi := range prof.vendorInfo {
+		value := rep.Replace(vi.value)
+
+		var entry *vendorInfo
+		for i := range s.vendorInfo {
+			if s.vendorInfo[i].enterprise == vi.enterprise {
+				entry = &s.vendorInfo[i]
+				break
+			}
+		}
+		if entry == nil {
+			s.vendorInfo = append(s.vendorInfo, vendorInfo{enterprise: vi.enterprise})
+			entry = &s.vendorInfo[len(s.vendorInfo)-1]
+		}
+
+		entry.sub = append(entry.sub, subOption{vi.code, []byte(value)})
+	}
+
+	return prof.vendor.build(s)
+}
@@ -0,0 +1,155 @@
+package provision
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvisionSetup(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	provision cisco {
+		server 10.0.0.1 10.0.0.2
+		config {hwaddr}.cfg
+	}
+	provision juniper oui == '00:05:85' {
+		image jinstall.tgz
+		transfer-mode http
+		vendor-info 2636 1 foo
+	}
+	provision generic
+	`)
+	plg, err := makeProvisionPlugin(c)
+	require.NoError(t, err)
+	require.Len(t, plg.profiles, 3)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, plg.profiles[0].servers)
+	assert.Equal(t, "{hwaddr}.cfg", plg.profiles[0].config)
+	assert.Equal(t, "jinstall.tgz", plg.profiles[1].image)
+	assert.Equal(t, "http", plg.profiles[1].transferMode)
+	assert.Equal(t, []vendorInfoTemplate{{2636, 1, "foo"}}, plg.profiles[1].vendorInfo)
+	assert.True(t, plg.profiles[2].EmptyCondition())
+
+	for _, input := range []string{
+		"provision",
+		"provision unknown",
+		"provision cisco ==",
+		"provision cisco {\nimage foo\n}",
+		"provision arista {\ntransfer-mode http\n}",
+		"provision juniper {\ntransfer-mode smtp\n}",
+		"provision generic {\nvendor-info foo 1 bar\n}",
+		"provision generic {\nserver\n}",
+		"provision generic {\nunknown foo\n}",
+	} {
+		c = test.CreateTestBed(t, input)
+		_, err = makeProvisionPlugin(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestProvisionServeDHCP(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	provision cisco {
+		server 10.0.0.1 tftp.example.com 10.0.0.2
+		config http://cfg/{hwaddr}.cfg
+	}
+	provision juniper {
+		server 10.0.0.3
+		image junos.tgz
+		config {oui}.conf
+		transfer-mode http
+	}
+	provision generic {
+		server tftp.example.com
+		config default.cfg
+		vendor-info 9 1 a
+		vendor-info 9 2 bc
+	}
+	`)
+	plg, err := makeProvisionPlugin(c)
+	require.NoError(t, err)
+	plg.next = test.NoOpHandler
+
+	serve := func(class string) *dhcpv4.DHCPv4 {
+		req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+		if class != "" {
+			req.UpdateOption(dhcpv4.OptClassIdentifier(class))
+		}
+		res, _ := dhcpv4.NewReplyFromRequest(req)
+		require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+		return res
+	}
+
+	res := serve("ciscopnp")
+	assert.Equal(t, "10.0.0.1", res.TFTPServerName())
+	assert.Equal(t, "http://cfg/aa:bb:cc:dd:ee:ff.cfg", res.BootFileNameOption())
+	assert.Equal(t, []byte{10, 0, 0, 1, 10, 0, 0, 2}, res.GetOneOption(dhcpv4.GenericOptionCode(optionTFTPServerAddress)))
+
+	res = serve("Juniper-ex4300")
+	assert.Equal(t, "10.0.0.3", res.TFTPServerName())
+	assert.Equal(t, []byte{10, 0, 0, 3}, res.GetOneOption(dhcpv4.GenericOptionCode(optionTFTPServerAddress)))
+	assert.Equal(t, []byte{
+		0, 9, 'j', 'u', 'n', 'o', 's', '.', 't', 'g', 'z',
+		1, 13, 'a', 'a', ':', 'b', 'b', ':', 'c', 'c', '.', 'c', 'o', 'n', 'f',
+		3, 4, 'h', 't', 't', 'p',
+	}, res.GetOneOption(dhcpv4.OptionVendorSpecificInformation))
+	assert.Empty(t, res.BootFileNameOption())
+
+	res = serve("")
+	assert.Equal(t, "tftp.example.com", res.TFTPServerName())
+	assert.Equal(t, "default.cfg", res.BootFileNameOption())
+	assert.Nil(t, res.GetOneOption(dhcpv4.GenericOptionCode(optionTFTPServerAddress)))
+	assert.Equal(t, []byte{0, 0, 0, 9, 7, 1, 1, 'a', 2, 2, 'b', 'c'}, res.GetOneOption(dhcpv4.OptionVendorIdentifyingVendorSpecific))
+}
+
+func TestProvisionDefaultConditions(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	provision cisco {
+		config cisco.cfg
+	}
+	provision arista {
+		config arista.cfg
+	}
+	provision juniper {
+		config juniper.conf
+	}
+	provision generic [hwaddr] =~ '^aa:bb:cc:' {
+		config lab.cfg
+	}
+	`)
+	plg, err := makeProvisionPlugin(c)
+	require.NoError(t, err)
+	plg.next = test.NoOpHandler
+
+	cases := []struct {
+		HwAddr net.HardwareAddr
+		Class  string
+		Config string
+	}{
+		{net.HardwareAddr{0x00, 0x00, 0x0c, 0x01, 0x02, 0x03}, "", "cisco.cfg"},
+		{net.HardwareAddr{0x28, 0x99, 0x3a, 0x01, 0x02, 0x03}, "", "arista.cfg"},
+		{net.HardwareAddr{0x00, 0x05, 0x85, 0x01, 0x02, 0x03}, "", "juniper.conf"},
+		{net.HardwareAddr{0xaa, 0xbb, 0xcc, 0x01, 0x02, 0x03}, "Arista;DCS-7050", "arista.cfg"},
+		{net.HardwareAddr{0xaa, 0xbb, 0xcc, 0x01, 0x02, 0x03}, "", "lab.cfg"},
+		{net.HardwareAddr{0xaa, 0xbb, 0xcd, 0x01, 0x02, 0x03}, "", ""},
+	}
+
+	for _, tc := range cases {
+		req, _ := dhcpv4.NewDiscovery(tc.HwAddr)
+		if tc.Class != "" {
+			req.UpdateOption(dhcpv4.OptClassIdentifier(tc.Class))
+		}
+		res, _ := dhcpv4.NewReplyFromRequest(req)
+		require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+
+		if tc.Config == "juniper.conf" {
+			assert.Contains(t, string(res.GetOneOption(dhcpv4.OptionVendorSpecificInformation)), tc.Config, tc.HwAddr.String())
+			continue
+		}
+		assert.Equal(t, tc.Config, res.BootFileNameOption(), tc.HwAddr.String())
+	}
+}
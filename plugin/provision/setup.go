@@ -0,0 +1,133 @@
+package provision
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+func init() {
+	caddy.RegisterPlugin("provision", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupProvision,
+	})
+}
+
+func setupProvision(c *caddy.Controller) error {
+	plg, err := makeProvisionPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	return nil
+}
+
+func makeProvisionPlugin(c *caddy.Controller) (*provisionPlugin, error) {
+	plg := &provisionPlugin{}
+	plg.l = log.GetLogger(c, plg)
+
+	for c.Next() {
+		if !c.NextArg() {
+			return nil, c.ArgErr()
+		}
+
+		name := strings.ToLower(c.Val())
+		v, ok := vendors[name]
+		if !ok {
+			return nil, c.Errf("unknown provisioning profile %q", c.Val())
+		}
+
+		cond := strings.Join(c.RemainingArgs(), " ")
+		if cond == "" {
+			cond = v.condition
+		}
+
+		m, err := matcher.SetupMatcherString(cond)
+		if err != nil {
+			return nil, c.Errf("invalid condition for provisioning profile %s: %s", name, err.Error())
+		}
+
+		prof := &profile{
+			Matcher: m,
+			name:    name,
+			vendor:  v,
+		}
+
+		for c.NextBlock() {
+			key := c.Val()
+			args := c.RemainingArgs()
+
+			switch key {
+			case "server":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				prof.servers = args
+
+			case "config":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				prof.config = args[0]
+
+			case "image":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				if !v.image {
+					return nil, c.Errf("provisioning profile %s does not support image", name)
+				}
+				prof.image = args[0]
+
+			case "transfer-mode":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				if !v.transferMode {
+					return nil, c.Errf("provisioning profile %s does not support transfer-mode", name)
+				}
+				switch args[0] {
+				case "tftp", "ftp", "http", "https":
+				default:
+					return nil, c.SyntaxErr("one of tftp, ftp, http or https")
+				}
+				prof.transferMode = args[0]
+
+			case "vendor-info":
+				if len(args) != 3 {
+					return nil, c.ArgErr()
+				}
+				enterprise, err := strconv.ParseUint(args[0], 0, 32)
+				if err != nil {
+					return nil, c.SyntaxErr("enterprise number")
+				}
+				code, err := strconv.ParseUint(args[1], 0, 8)
+				if err != nil {
+					return nil, c.SyntaxErr("sub-option code")
+				}
+				prof.vendorInfo = append(prof.vendorInfo, vendorInfoTemplate{
+					enterprise: uint32(enterprise),
+					code:       uint8(code),
+					value:      args[2],
+				})
+
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+
+		plg.profiles = append(plg.profiles, prof)
+	}
+
+	return plg, nil
+}
@@ -0,0 +1,327 @@
+package ranges
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/iprange"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+)
+
+// Pool is a set of IP ranges that are allocated using the same strategy.
+// It keeps an in-memory index of free addresses that is synchronized with
+// the lease database when the pool is used for the first time and whenever
+// it seems to be exhausted. Addresses that turn out to be used when
+// reserving them are removed from the index.
+//
+// If Affinity is set, addresses of leases that expired less than Affinity
+// ago are held back for the previous client and only handed out to other
+// clients if there's no other free address left.
+//
+// If Classes or Matcher are set, only clients that are members of one of
+// the classes and match the condition are allocated addresses from the pool
+type Pool struct {
+	// Ranges holds the IP ranges of the pool
+	Ranges iprange.IPRanges
+
+	// Strategy is the allocation strategy of the pool
+	Strategy string
+
+	// Affinity is the time an expired lease stays bound to the
+	// previous client
+	Affinity time.Duration
+
+	// Classes restricts the pool to members of client classes
+	Classes class.Set
+
+	// Matcher restricts the pool to matching clients. If nil, any
+	// client may use the pool
+	Matcher *matcher.Matcher
+
+	l      sync.Mutex
+	alloc  allocator
+	synced bool
+
+	// held holds the index of addresses that are kept for their
+	// previous client
+	held map[int]hold
+}
+
+// hold is an address that is kept for its previous client until
+// the affinity ends
+type hold struct {
+	until  time.Time
+	client string
+}
+
+// clientKey returns the key used to compare cli with the previous
+// client of held addresses
+func clientKey(cli lease.Client) string {
+	if len(cli.HwAddr) > 0 {
+		return cli.HwAddr.String()
+	}
+	return cli.ID
+}
+
+// NewPool returns a new pool for the ranges using strategy
+func NewPool(ranges iprange.IPRanges, strategy string) *Pool {
+	p := &Pool{
+		Ranges:   ranges,
+		Strategy: strategy,
+		held:     make(map[int]hold),
+	}
+	p.alloc = newAllocator(strategy, p.size())
+
+	return p
+}
+
+// ipAt returns the IP address at idx
+func (p *Pool) ipAt(idx int) net.IP {
+	for _, r := range p.Ranges {
+		if idx < r.Len() {
+			return r.ByIdx(idx)
+		}
+		idx -= r.Len()
+	}
+
+	return nil
+}
+
+// indexOf returns the index of ip or -1 if ip is not part of the pool
+func (p *Pool) indexOf(ip net.IP) int {
+	offset := 0
+	for _, r := range p.Ranges {
+		if r.Contains(ip) {
+			start, _ := iprange.IP2Int(r.Start)
+			x, _ := iprange.IP2Int(ip)
+			return offset + int(x-start)
+		}
+		offset += r.Len()
+	}
+
+	return -1
+}
+
+// Match returns true if the client that sent req may use the pool
+func (p *Pool) Match(ctx context.Context, req *dhcpv4.DHCPv4) (bool, error) {
+	if !p.Classes.Match(ctx) {
+		return false, nil
+	}
+
+	if p.Matcher == nil {
+		return true, nil
+	}
+
+	return p.Matcher.Match(ctx, req)
+}
+
+// Contains returns true if ip is part of the pool
+func (p *Pool) Contains(ip net.IP) bool {
+	return p.indexOf(ip) >= 0
+}
+
+// markUsed removes ip from the index of free addresses
+func (p *Pool) markUsed(ip net.IP) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if idx := p.indexOf(ip); idx >= 0 {
+		p.alloc.take(idx)
+		delete(p.held, idx)
+	}
+}
+
+// markFree adds ip to the index of free addresses
+func (p *Pool) markFree(ip net.IP) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if idx := p.indexOf(ip); idx >= 0 {
+		p.alloc.release(idx)
+		delete(p.held, idx)
+	}
+}
+
+// sync updates the index of free addresses from the lease database.
+// The caller must hold p.l
+func (p *Pool) sync(ctx context.Context, db lease.Database) error {
+	used := make(map[int]struct{})
+	held := make(map[int]hold)
+	now := time.Now()
+
+	leases, err := db.Leases(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range leases {
+		idx := p.indexOf(l.Address)
+		if idx < 0 {
+			continue
+		}
+
+		if !l.ExpiredAt(now) {
+			used[idx] = struct{}{}
+			continue
+		}
+
+		if until := l.Expires.Add(p.Affinity); until.After(now) {
+			held[idx] = hold{until: until, client: clientKey(l.Client)}
+		}
+	}
+
+	reserved, err := db.ReservedAddresses(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reserved {
+		if r.Expired(now) {
+			continue
+		}
+		if idx := p.indexOf(r.IP); idx >= 0 {
+			used[idx] = struct{}{}
+		}
+	}
+
+	n := p.size()
+	for idx := 0; idx < n; idx++ {
+		_, isUsed := used[idx]
+		_, isHeld := held[idx]
+
+		if isUsed || isHeld {
+			p.alloc.take(idx)
+		} else {
+			p.alloc.release(idx)
+		}
+	}
+
+	for idx := range used {
+		delete(held, idx)
+	}
+
+	p.held = held
+	p.synced = true
+	return nil
+}
+
+// size returns the number of addresses in the pool
+func (p *Pool) size() int {
+	n := 0
+	for _, r := range p.Ranges {
+		n += r.Len()
+	}
+	return n
+}
+
+// next selects the next free address for cli. If the index is not yet
+// synchronized or exhausted it is synchronized with db first
+func (p *Pool) next(ctx context.Context, db lease.Database, cli lease.Client, resynced *bool) (int, error) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if !p.synced {
+		if err := p.sync(ctx, db); err != nil {
+			return -1, err
+		}
+		*resynced = true
+	}
+
+	idx := p.alloc.next(cli.HwAddr)
+	if idx < 0 && !*resynced {
+		// addresses may have been released or expired since
+		// the last synchronization
+		if err := p.sync(ctx, db); err != nil {
+			return -1, err
+		}
+		*resynced = true
+
+		idx = p.alloc.next(cli.HwAddr)
+	}
+
+	if idx < 0 {
+		idx = p.nextHeld()
+	}
+
+	return idx, nil
+}
+
+// isHeld returns true if ip is held back for a client other than cli
+// and the pool still has free addresses to offer instead. If the index
+// is not yet synchronized it is synchronized with db first
+func (p *Pool) isHeld(ctx context.Context, db lease.Database, ip net.IP, cli lease.Client) (bool, error) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if !p.synced {
+		if err := p.sync(ctx, db); err != nil {
+			return false, err
+		}
+	}
+
+	h, ok := p.held[p.indexOf(ip)]
+	if !ok || h.client == clientKey(cli) || !h.until.After(time.Now()) {
+		return false, nil
+	}
+
+	return p.alloc.free() > 0, nil
+}
+
+// nextHeld removes the address with the earliest end of affinity
+// from the set of held addresses and returns it. -1 is returned
+// if no address is held. The caller must hold p.l
+func (p *Pool) nextHeld() int {
+	idx := -1
+	var until time.Time
+
+	for i, h := range p.held {
+		if idx < 0 || h.until.Before(until) {
+			idx, until = i, h.until
+		}
+	}
+
+	if idx >= 0 {
+		delete(p.held, idx)
+	}
+
+	return idx
+}
+
+// Allocate selects a free address of the pool and reserves it for cli. nil
+// is returned if the pool is exhausted
+func (p *Pool) Allocate(ctx context.Context, db lease.Database, cli lease.Client) (net.IP, error) {
+	resynced := false
+
+	for {
+		idx, err := p.next(ctx, db, cli, &resynced)
+		if err != nil || idx < 0 {
+			return nil, err
+		}
+
+		ip := p.ipAt(idx)
+
+		err = db.Reserve(ctx, ip, cli)
+		if err == nil {
+			return ip, nil
+		}
+
+		if err == lease.ErrAddressReserved || err == lease.ErrAddressStatic {
+			// the address is used by a different client. It's
+			// already removed from the index so try the next one
+			continue
+		}
+
+		// we don't know anything about the address so make it
+		// available again
+		p.l.Lock()
+		p.alloc.release(idx)
+		p.l.Unlock()
+
+		return nil, err
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"net"
 	"time"
 
-	"github.com/caddyserver/caddy"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/lease"
@@ -14,12 +13,9 @@ import (
 	"github.com/nextdhcp/nextdhcp/plugin"
 )
 
-func init() {
-	caddy.RegisterPlugin("range", caddy.Plugin{
-		ServerType: "dhcpv4",
-		Action:     setupRange,
-	})
-}
+// declineHoldTime is the duration an address declined by a client
+// is not handed out again
+const declineHoldTime = 10 * time.Minute
 
 // RangePlugin assigned IP address from preconfigured ranges
 type RangePlugin struct {
@@ -29,6 +25,14 @@ type RangePlugin struct {
 	// Ranges holds all IP ranges that can be used by the plugin
 	Ranges iprange.IPRanges
 
+	// Excluded holds addresses that are part of a configured range
+	// but must never be leased
+	Excluded iprange.IPRanges
+
+	// Pools holds the pools addresses are allocated from. Pools
+	// are tried in order
+	Pools []*Pool
+
 	// Network defines the network that is served by the plugin
 	// setupRange copies this from the dhcpserver.Config
 	Network net.IPNet
@@ -37,8 +41,10 @@ type RangePlugin struct {
 	L log.Logger
 }
 
-func (p *RangePlugin) findUnboundAddr(ctx context.Context, mac net.HardwareAddr, requested net.IP, db lease.Database) net.IP {
+func (p *RangePlugin) findUnboundAddr(ctx context.Context, req *dhcpv4.DHCPv4, requested net.IP, db lease.Database) net.IP {
 	l := log.With(ctx, p.L)
+	mac := req.ClientHWAddr
+	pools := p.matchingPools(ctx, req)
 
 	cli := lease.Client{
 		HwAddr: mac,
@@ -56,29 +62,63 @@ func (p *RangePlugin) findUnboundAddr(ctx context.Context, mac net.HardwareAddr,
 			return nil
 		}
 
-		err := db.Reserve(ctx, requested, cli)
-		if err == nil {
-			l.Debugf("%s requested previous IP address %s", mac, requested)
-			return requested
+		pool := poolFor(pools, requested)
+		if pool == nil {
+			l.Infof("%s requested %s which is part of a pool it is not permitted to use", mac, requested)
+			return nil
+		}
+
+		held, err := pool.isHeld(ctx, db, requested, cli)
+		if err != nil {
+			l.Warnf("%s: failed to check the affinity of %s: %s", mac, requested, err.Error())
+		}
+
+		if held {
+			l.Infof("%s requested %s which is held back for its previous client", mac, requested)
+		} else {
+			err := db.Reserve(ctx, requested, cli)
+			if err == nil {
+				l.Debugf("%s requested previous IP address %s", mac, requested)
+				p.markUsed(requested)
+				return requested
+			}
+
+			if err == lease.ErrAddressStatic {
+				l.Infof("%s requested %s which is statically assigned to a different client", mac, requested)
+			} else {
+				l.Warnf("%s requested previous IP address %s but we failed to reserve it: %s", mac, requested, err.Error())
+			}
 		}
-		l.Warnf("%s requested previous IP address %s but we failed to reserve it: %s", mac, requested, err.Error())
 
 		// TODO(ppacher): should we check for context errors here?
 	}
 
-	for _, r := range p.Ranges {
-		for idx := 0; idx < r.Len(); idx++ {
-			ip := r.ByIdx(idx)
+	// clients that already have an address leased or reserved
+	// get the very same address
+	ip, _, _, err := db.FindByClient(ctx, cli)
+	if err != nil {
+		l.Warnf("%s: failed to search for existing lease: %s", mac, err.Error())
+	}
+	if ip != nil && poolFor(pools, ip) != nil {
+		if err := db.Reserve(ctx, ip, cli); err == nil {
+			l.Debugf("%s: using existing address %s", mac, ip)
+			p.markUsed(ip)
+			return ip
+		}
+	}
 
-			if err := db.Reserve(ctx, ip, cli); err != nil {
-				// failed to reserve the IP address
-				if err == context.DeadlineExceeded || err == context.Canceled {
-					return nil
-				}
+	for _, pool := range pools {
+		ip, err := pool.Allocate(ctx, db, cli)
+		if err != nil {
+			l.Warnf("%s: failed to allocate address from %s: %s", mac, pool.Ranges.String(), err.Error())
 
-				continue
+			if err == context.DeadlineExceeded || err == context.Canceled {
+				return nil
 			}
+			continue
+		}
 
+		if ip != nil {
 			// we successfully reserved the IP address for the client
 			return ip
 		}
@@ -88,8 +128,52 @@ func (p *RangePlugin) findUnboundAddr(ctx context.Context, mac net.HardwareAddr,
 	return nil
 }
 
+// matchingPools returns all pools the client that sent req may use
+func (p *RangePlugin) matchingPools(ctx context.Context, req *dhcpv4.DHCPv4) []*Pool {
+	pools := make([]*Pool, 0, len(p.Pools))
+
+	for _, pool := range p.Pools {
+		matched, err := pool.Match(ctx, req)
+		if err != nil {
+			log.With(ctx, p.L).Warnf("failed to match condition for %s: %s", pool.Ranges.String(), err.Error())
+			continue
+		}
+
+		if matched {
+			pools = append(pools, pool)
+		}
+	}
+
+	return pools
+}
+
+// poolFor returns the pool ip belongs to or nil
+func poolFor(pools []*Pool, ip net.IP) *Pool {
+	for _, pool := range pools {
+		if pool.Contains(ip) {
+			return pool
+		}
+	}
+
+	return nil
+}
+
+// markUsed removes ip from the index of free addresses
+func (p *RangePlugin) markUsed(ip net.IP) {
+	for _, pool := range p.Pools {
+		pool.markUsed(ip)
+	}
+}
+
+// markFree adds ip to the index of free addresses
+func (p *RangePlugin) markFree(ip net.IP) {
+	for _, pool := range p.Pools {
+		pool.markFree(ip)
+	}
+}
+
 func (p *RangePlugin) findAndPrepareResponse(ctx context.Context, req, res *dhcpv4.DHCPv4, requested net.IP, db lease.Database) bool {
-	ip := p.findUnboundAddr(ctx, req.ClientHWAddr, requested, db)
+	ip := p.findUnboundAddr(ctx, req, requested, db)
 	if ip != nil {
 		log.With(ctx, p.L).Debugf("found unbound address for %s: %s", req.ClientHWAddr, ip)
 		res.YourIPAddr = ip
@@ -108,7 +192,7 @@ func (p *RangePlugin) findAndPrepareResponse(ctx context.Context, req, res *dhcp
 func (p *RangePlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
 	l := log.With(ctx, p.L)
 	db := lease.GetDatabase(ctx)
-	cli := lease.Client{HwAddr: req.ClientHWAddr}
+	cli := lease.Client{HwAddr: req.ClientHWAddr, Hostname: req.HostName()}
 
 	if dhcpserver.Discover(req) {
 		if p.findAndPrepareResponse(ctx, req, res, req.RequestedIPAddress(), db) {
@@ -159,6 +243,11 @@ func (p *RangePlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) er
 				return p.Next.ServeDHCP(ctx, req, res)
 			}
 
+			if poolFor(p.matchingPools(ctx, req), ip) == nil {
+				l.Infof("Ignoring lease request for %s: %s is not permitted to use the pool", ip, req.ClientHWAddr)
+				return p.Next.ServeDHCP(ctx, req, res)
+			}
+
 			// use the leaseTime already set to the response packet
 			// else we fallback to time.Hour
 			// TODO(ppacher): we should make the default lease time configurable
@@ -169,6 +258,7 @@ func (p *RangePlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) er
 			leaseTime, err := db.Lease(ctx, ip, cli, activeLeaseTime, renewLeaseTime)
 
 			if err == nil {
+				p.markUsed(ip)
 				l.Infof("%s (%s): lease %s for %s (activeLeaseTime: %s)", req.ClientHWAddr, state, ip, leaseTime, activeLeaseTime)
 				if leaseTime == time.Hour {
 					res.UpdateOption(dhcpv4.OptIPAddressLeaseTime(leaseTime))
@@ -194,9 +284,25 @@ func (p *RangePlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) er
 		if err := db.Release(ctx, req.ClientIPAddr); err != nil {
 			return err
 		}
+		p.markFree(req.ClientIPAddr)
 
 		// No response should be sent for DHCPRELEASE messages
 		return dhcpserver.ErrNoResponse
+	} else
+
+	// If a client declines an address of our range it is most likely
+	// used by a different host so we hold it back for some time
+	if dhcpserver.Decline(req) && p.Ranges.Contains(req.RequestedIPAddress()) {
+		ip := req.RequestedIPAddress()
+		if err := db.Decline(ctx, ip, cli, declineHoldTime); err != nil {
+			l.Warnf("%s declined %s but we failed to hold it back: %s", req.ClientHWAddr, ip, err.Error())
+		} else {
+			l.Warnf("%s declined %s, holding it back for %s", req.ClientHWAddr, ip, declineHoldTime)
+			p.markUsed(ip)
+		}
+
+		// No response should be sent for DHCPDECLINE messages
+		return dhcpserver.ErrNoResponse
 	}
 
 	return p.Next.ServeDHCP(ctx, req, res)
@@ -236,50 +342,6 @@ func (p *RangePlugin) Name() string {
 	return "range"
 }
 
-func setupRange(c *caddy.Controller) error {
-	cfg := dhcpserver.GetConfig(c)
-	plg := &RangePlugin{
-		Network: cfg.Network,
-	}
-	plg.L = log.GetLogger(c, plg)
-
-	for c.Next() {
-		if !c.NextArg() {
-			return c.ArgErr()
-		}
-
-		startIP := net.ParseIP(c.Val())
-		if startIP == nil {
-			return c.SyntaxErr("IPv4 address")
-		}
-
-		if !c.NextArg() {
-			return c.ArgErr()
-		}
-
-		endIP := net.ParseIP(c.Val())
-		if endIP == nil {
-			return c.SyntaxErr("IPv4 address")
-		}
-
-		r := &iprange.IPRange{
-			Start: startIP,
-			End:   endIP,
-		}
-
-		plg.Ranges = iprange.Merge(append(plg.Ranges, r))
-	}
-
-	plg.L.Debugf("serving %d IP ranges: %v", len(plg.Ranges), plg.Ranges)
-
-	cfg.AddPlugin(func(next plugin.Handler) plugin.Handler {
-		plg.Next = next
-		return plg
-	})
-
-	return nil
-}
-
 func ipIsUnset(ip net.IP) bool {
 	return ip == nil || ip.IsUnspecified()
 }
@@ -0,0 +1,310 @@
+package ranges
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/caddyfile"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hwaddr(i byte) net.HardwareAddr {
+	return net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, i}
+}
+
+func discover(mac net.HardwareAddr) *dhcpv4.DHCPv4 {
+	req, _ := dhcpv4.New(dhcpv4.WithHwAddr(mac), dhcpv4.WithMessageType(dhcpv4.MessageTypeDiscover))
+	return req
+}
+
+func TestRangeSetup(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	range 10.0.0.10 10.0.0.20
+	range 10.0.0.100 10.0.0.200 {
+		strategy least-recently-used
+		affinity 1h
+	}
+	`)
+	plg, err := makeRangePlugin(c)
+	require.NoError(t, err)
+	require.Len(t, plg.Pools, 2)
+	assert.Equal(t, StrategySequential, plg.Pools[0].Strategy)
+	assert.Equal(t, StrategyLRU, plg.Pools[1].Strategy)
+	assert.Equal(t, time.Duration(0), plg.Pools[0].Affinity)
+	assert.Equal(t, time.Hour, plg.Pools[1].Affinity)
+	assert.Len(t, plg.Ranges, 2)
+
+	for _, input := range []string{
+		"range",
+		"range 10.0.0.1",
+		"range 10.0.0.10 10.0.0.1",
+		"range 10.0.0.1 10.0.0.10 {\nstrategy\n}",
+		"range 10.0.0.1 10.0.0.10 {\nstrategy best\n}",
+		"range 10.0.0.1 10.0.0.10 {\nstrategy random hash\n}",
+		"range 10.0.0.1 10.0.0.10 {\nunknown\n}",
+		"range 10.0.0.1 10.0.0.10 {\naffinity\n}",
+		"range 10.0.0.1 10.0.0.10 {\naffinity forever\n}",
+		"range 10.0.0.1 10.0.0.10 {\nexclude\n}",
+		"range 10.0.0.1 10.0.0.10 {\nexclude foo\n}",
+		"range 10.0.0.1 10.0.0.10 {\nexclude 10.0.0.2 10.0.0.3 10.0.0.4\n}",
+		"range 10.0.0.1 10.0.0.10 {\nexclude 10.0.0.3 10.0.0.2\n}",
+		"range 10.0.0.1 10.0.0.10 {\nexclude 10.0.0.5 10.0.0.11\n}",
+		"range 10.0.0.1 10.0.0.10 {\nexclude 10.0.1.1\n}",
+		"range 10.0.0.1 10.0.0.10 {\nexclude 10.0.0.1 10.0.0.10\n}",
+	} {
+		c = test.CreateTestBed(t, input)
+		_, err = makeRangePlugin(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestNestedRanges(t *testing.T) {
+	c := test.CreateTestBed(t, "range 127.0.0.10 127.0.0.20")
+
+	// nested blocks are set up before the range of the server block
+	_, err := dhcpserver.SetupNested(c, map[string][]caddyfile.Token{
+		"range": {{Text: "range"}, {Text: "127.0.0.100"}, {Text: "127.0.0.150"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, setupRange(c))
+
+	cfg := dhcpserver.GetConfig(c)
+	assert.Equal(t, "127.0.0.10-127.0.0.20, 127.0.0.100-127.0.0.150", cfg.Ranges.String())
+	assert.True(t, cfg.Ranges.Contains(net.IP{127, 0, 0, 120}))
+}
+
+func TestRangeExclude(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	c := test.CreateTestBed(t, `
+	range 10.0.0.1 10.0.0.10 {
+		exclude 10.0.0.1
+		exclude 10.0.0.3 10.0.0.9
+	}
+	`)
+	plg, err := makeRangePlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.ErrorHandler
+
+	assert.Equal(t, "10.0.0.2-10.0.0.2, 10.0.0.10-10.0.0.10", plg.Ranges.String())
+	assert.Equal(t, "10.0.0.1-10.0.0.1, 10.0.0.3-10.0.0.9", plg.Excluded.String())
+
+	// excluded addresses are treated like addresses outside of the range
+	assert.Nil(t, plg.findUnboundAddr(ctx, discover(hwaddr(1)), net.IP{10, 0, 0, 5}, db))
+
+	ip := plg.findUnboundAddr(ctx, discover(hwaddr(1)), nil, db)
+	assert.Equal(t, "10.0.0.2", ip.String())
+
+	ip = plg.findUnboundAddr(ctx, discover(hwaddr(2)), nil, db)
+	assert.Equal(t, "10.0.0.10", ip.String())
+
+	assert.Nil(t, plg.findUnboundAddr(ctx, discover(hwaddr(3)), nil, db))
+}
+
+func TestRangeAllocation(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	c := test.CreateTestBed(t, "range 10.0.0.1 10.0.0.3\nrange 10.0.0.10 10.0.0.11 {\nstrategy random\n}")
+	plg, err := makeRangePlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.ErrorHandler
+
+	// an address used by a client that is unknown to the index
+	require.NoError(t, db.Reserve(ctx, net.IP{10, 0, 0, 1}, lease.Client{HwAddr: hwaddr(100)}))
+	// a static reservation
+	require.NoError(t, db.ReserveStatic(ctx, net.IP{10, 0, 0, 2}, lease.Client{ID: "static"}))
+
+	ip := plg.findUnboundAddr(ctx, discover(hwaddr(1)), nil, db)
+	assert.Equal(t, "10.0.0.3", ip.String())
+
+	// the same client gets the same address again
+	ip = plg.findUnboundAddr(ctx, discover(hwaddr(1)), nil, db)
+	assert.Equal(t, "10.0.0.3", ip.String())
+
+	// the first pool is exhausted
+	ip = plg.findUnboundAddr(ctx, discover(hwaddr(2)), nil, db)
+	assert.True(t, plg.Pools[1].Contains(ip), ip.String())
+	ip = plg.findUnboundAddr(ctx, discover(hwaddr(3)), nil, db)
+	assert.True(t, plg.Pools[1].Contains(ip), ip.String())
+	assert.Nil(t, plg.findUnboundAddr(ctx, discover(hwaddr(4)), nil, db))
+
+	// released addresses are available again
+	release, _ := dhcpv4.New(dhcpv4.WithHwAddr(hwaddr(1)), dhcpv4.WithMessageType(dhcpv4.MessageTypeRelease), dhcpv4.WithClientIP(net.IP{10, 0, 0, 3}))
+	res, _ := dhcpv4.NewReplyFromRequest(release)
+	assert.Equal(t, dhcpserver.ErrNoResponse, plg.ServeDHCP(lease.WithDatabase(ctx, db), release, res))
+
+	ip = plg.findUnboundAddr(ctx, discover(hwaddr(4)), nil, db)
+	assert.Equal(t, "10.0.0.3", ip.String())
+}
+
+func TestPoolResync(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	c := test.CreateTestBed(t, "range 10.0.0.1 10.0.0.2")
+	plg, err := makeRangePlugin(c)
+	require.NoError(t, err)
+	pool := plg.Pools[0]
+
+	_, err = db.Lease(ctx, net.IP{10, 0, 0, 1}, lease.Client{HwAddr: hwaddr(1)}, time.Hour, false)
+	require.NoError(t, err)
+	_, err = db.Lease(ctx, net.IP{10, 0, 0, 2}, lease.Client{HwAddr: hwaddr(2)}, time.Hour, false)
+	require.NoError(t, err)
+
+	ip, err := pool.Allocate(ctx, db, lease.Client{HwAddr: hwaddr(3)})
+	assert.NoError(t, err)
+	assert.Nil(t, ip)
+
+	// addresses released without the pool knowing are found
+	// once the pool is exhausted
+	require.NoError(t, db.Release(ctx, net.IP{10, 0, 0, 2}))
+
+	ip, err = pool.Allocate(ctx, db, lease.Client{HwAddr: hwaddr(3)})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", ip.String())
+}
+
+func TestPoolAffinity(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	c := test.CreateTestBed(t, "range 10.0.0.1 10.0.0.3 {\naffinity 1h\n}")
+	plg, err := makeRangePlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.ErrorHandler
+
+	// leases that expired within the affinity window
+	for i := byte(1); i <= 2; i++ {
+		_, err = db.Lease(ctx, net.IP{10, 0, 0, i}, lease.Client{HwAddr: hwaddr(i)}, time.Nanosecond, false)
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Millisecond)
+
+	// allocate simulates a DISCOVER followed by a REQUEST
+	allocate := func(i byte) net.IP {
+		ip := plg.findUnboundAddr(ctx, discover(hwaddr(i)), nil, db)
+		if ip != nil {
+			_, err := db.Lease(ctx, ip, lease.Client{HwAddr: hwaddr(i)}, time.Hour, false)
+			require.NoError(t, err)
+		}
+		return ip
+	}
+
+	// held addresses are not handed out to other clients requesting
+	// them as long as there are free addresses
+	assert.Equal(t, "10.0.0.3", plg.findUnboundAddr(ctx, discover(hwaddr(10)), net.IP{10, 0, 0, 1}, db).String())
+	require.NoError(t, db.DeleteReservation(ctx, net.IP{10, 0, 0, 3}, nil))
+	plg.markFree(net.IP{10, 0, 0, 3})
+
+	// the free address is used first
+	assert.Equal(t, "10.0.0.3", allocate(10).String())
+
+	// the previous client gets its address back
+	assert.Equal(t, "10.0.0.2", allocate(2).String())
+
+	// addresses within the affinity window are used once the pool
+	// runs short
+	assert.Equal(t, "10.0.0.1", allocate(11).String())
+	assert.Nil(t, allocate(12))
+}
+
+func TestAffinityGracePeriod(t *testing.T) {
+	db := storage.NewDatabase(memory.New())
+	db.GracePeriod = time.Hour
+
+	setup := func(input string) error {
+		c := test.CreateTestBed(t, input)
+		dhcpserver.GetConfig(c).Database = db
+		_, err := makeRangePlugin(c)
+		return err
+	}
+
+	// the reaper is disabled
+	assert.NoError(t, setup("range 10.0.0.1 10.0.0.3 {\naffinity 2h\n}"))
+
+	db.ReapInterval = time.Minute
+	assert.NoError(t, setup("range 10.0.0.1 10.0.0.3 {\naffinity 1h\n}"))
+	assert.Error(t, setup("range 10.0.0.1 10.0.0.3 {\naffinity 2h\n}"))
+}
+
+func TestRangeCondition(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	c := test.CreateTestBed(t, `
+	range 10.0.0.1 10.0.0.1 {
+		if {>class-identifier} == 'Polycom'
+	}
+	range 10.0.0.10 10.0.0.10
+	`)
+	plg, err := makeRangePlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.ErrorHandler
+	require.NotNil(t, plg.Pools[0].Matcher)
+	require.Nil(t, plg.Pools[1].Matcher)
+
+	phone := discover(hwaddr(1))
+	phone.UpdateOption(dhcpv4.OptClassIdentifier("Polycom"))
+
+	// other clients never get an address from the restricted pool
+	// even if they request it
+	assert.Nil(t, plg.findUnboundAddr(ctx, discover(hwaddr(2)), net.IP{10, 0, 0, 1}, db))
+	ip := plg.findUnboundAddr(ctx, discover(hwaddr(2)), nil, db)
+	assert.Equal(t, "10.0.0.10", ip.String())
+
+	ip = plg.findUnboundAddr(ctx, phone, nil, db)
+	assert.Equal(t, "10.0.0.1", ip.String())
+
+	// once the restricted pool is exhausted matching clients fall
+	// through to the next pool
+	require.NoError(t, db.Release(ctx, net.IP{10, 0, 0, 10}))
+	plg.markFree(net.IP{10, 0, 0, 10})
+	phone2 := discover(hwaddr(3))
+	phone2.UpdateOption(dhcpv4.OptClassIdentifier("Polycom"))
+	ip = plg.findUnboundAddr(ctx, phone2, nil, db)
+	assert.Equal(t, "10.0.0.10", ip.String())
+
+	// requests for addresses of a pool the client may not use
+	// are passed to the next handler
+	req, _ := dhcpv4.New(dhcpv4.WithHwAddr(hwaddr(4)), dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest), dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.IP{10, 0, 0, 1})))
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	assert.Equal(t, test.ErrorHandler.ServeDHCP(ctx, req, res), plg.ServeDHCP(lease.WithDatabase(ctx, db), req, res))
+}
+
+func TestRangeClass(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	c := test.CreateTestBed(t, `
+	range 10.0.0.1 10.0.0.1 {
+		class voip
+	}
+	range 10.0.0.10 10.0.0.10
+	`)
+	dhcpserver.GetConfig(c).Classes = []string{"voip"}
+	plg, err := makeRangePlugin(c)
+	require.NoError(t, err)
+	assert.Equal(t, class.Set{"voip"}, plg.Pools[0].Classes)
+
+	ip := plg.findUnboundAddr(ctx, discover(hwaddr(1)), nil, db)
+	assert.Equal(t, "10.0.0.10", ip.String())
+
+	ip = plg.findUnboundAddr(class.WithClasses(ctx, []string{"voip"}), discover(hwaddr(2)), nil, db)
+	assert.Equal(t, "10.0.0.1", ip.String())
+
+	c = test.CreateTestBed(t, "range 10.0.0.1 10.0.0.1 {\nclass voip\n}")
+	_, err = makeRangePlugin(c)
+	assert.Error(t, err)
+}
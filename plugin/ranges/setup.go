@@ -0,0 +1,193 @@
+package ranges
+
+import (
+	"net"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/lease/iprange"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+func init() {
+	caddy.RegisterPlugin("range", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupRange,
+	})
+}
+
+func setupRange(c *caddy.Controller) error {
+	plg, err := makeRangePlugin(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := dhcpserver.GetConfig(c)
+	cfg.AddRanges(plg.Ranges, plg.Excluded)
+
+	cfg.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.Next = next
+		return plg
+	})
+
+	return nil
+}
+
+func makeRangePlugin(c *caddy.Controller) (*RangePlugin, error) {
+	cfg := dhcpserver.GetConfig(c)
+	plg := &RangePlugin{
+		Network: cfg.Network,
+	}
+	plg.L = log.GetLogger(c, plg)
+
+	for c.Next() {
+		if !c.NextArg() {
+			return nil, c.ArgErr()
+		}
+
+		startIP := net.ParseIP(c.Val())
+		if startIP == nil {
+			return nil, c.SyntaxErr("IPv4 address")
+		}
+
+		if !c.NextArg() {
+			return nil, c.ArgErr()
+		}
+
+		endIP := net.ParseIP(c.Val())
+		if endIP == nil {
+			return nil, c.SyntaxErr("IPv4 address")
+		}
+
+		r := &iprange.IPRange{
+			Start: startIP,
+			End:   endIP,
+		}
+
+		if r.Len() < 1 {
+			return nil, c.Errf("invalid range %s", r)
+		}
+
+		strategy := StrategySequential
+		ranges := iprange.IPRanges{r}
+		var affinity time.Duration
+		var classes class.Set
+
+		m, err := matcher.SetupMatcher(c)
+		if err != nil {
+			return nil, c.Errf("invalid condition for range %s: %s", r, err.Error())
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "strategy":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if !isStrategy(c.Val()) {
+					return nil, c.SyntaxErr("one of sequential, random, hash or least-recently-used")
+				}
+				strategy = c.Val()
+
+			case "affinity":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := duration.Parse(c.Val())
+				if err != nil || d < 0 {
+					return nil, c.SyntaxErr("duration")
+				}
+				affinity = d
+
+			case "class":
+				classes, err = class.ParseSet(c, cfg.Classes)
+				if err != nil {
+					return nil, err
+				}
+
+			case "if", "if_op":
+				// already parsed by matcher.SetupMatcher
+				c.RemainingArgs()
+
+			case "exclude":
+				excl, err := parseExclude(c, r)
+				if err != nil {
+					return nil, err
+				}
+				ranges = iprange.DeleteFrom(excl, ranges)
+				plg.Excluded = append(plg.Excluded, excl)
+
+			default:
+				return nil, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+
+		if len(ranges) == 0 {
+			return nil, c.Errf("range %s does not contain any address that is not excluded", r)
+		}
+
+		// the reaper must not remove expired leases that are
+		// still bound to their previous client
+		if db, ok := cfg.LeaseDatabase().(*storage.Database); ok && db.ReapInterval > 0 && db.GracePeriod < affinity {
+			return nil, c.Errf("affinity %s exceeds the grace period %s of the database", affinity, db.GracePeriod)
+		}
+
+		pool := NewPool(ranges, strategy)
+		pool.Affinity = affinity
+		pool.Classes = classes
+		if !m.EmptyCondition() {
+			pool.Matcher = m
+		}
+
+		plg.Pools = append(plg.Pools, pool)
+		plg.Ranges = iprange.Merge(append(plg.Ranges, ranges...))
+	}
+
+	plg.L.Debugf("serving %d IP ranges: %v", len(plg.Ranges), plg.Ranges)
+
+	return plg, nil
+}
+
+// parseExclude parses the arguments of an exclude directive. The excluded
+// addresses must be part of r
+func parseExclude(c *caddy.Controller, r *iprange.IPRange) (*iprange.IPRange, error) {
+	args := c.RemainingArgs()
+	if len(args) < 1 || len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+
+	excl := &iprange.IPRange{}
+
+	excl.Start = net.ParseIP(args[0]).To4()
+	if excl.Start == nil {
+		return nil, c.SyntaxErr("IPv4 address")
+	}
+
+	excl.End = excl.Start
+	if len(args) == 2 {
+		excl.End = net.ParseIP(args[1]).To4()
+		if excl.End == nil {
+			return nil, c.SyntaxErr("IPv4 address")
+		}
+	}
+
+	if excl.Len() < 1 {
+		return nil, c.Errf("invalid exclusion %s", excl)
+	}
+
+	if !r.Contains(excl.Start) || !r.Contains(excl.End) {
+		return nil, c.Errf("exclusion %s is not part of range %s", excl, r)
+	}
+
+	return excl, nil
+}
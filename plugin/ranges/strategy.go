@@ -0,0 +1,284 @@
+package ranges
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net"
+)
+
+// Supported address allocation strategies
+const (
+	StrategySequential = "sequential"
+	StrategyRandom     = "random"
+	StrategyHash       = "hash"
+	StrategyLRU        = "least-recently-used"
+)
+
+// allocator is an in-memory index of free addresses of a pool. Addresses
+// are identified by their index inside the pool. All operations run in
+// (amortized) constant time. take and release are idempotent
+type allocator interface {
+	// next selects a free address for the client, marks it as used
+	// and returns its index. -1 is returned if no address is free
+	next(hwaddr net.HardwareAddr) int
+
+	// take marks the address at idx as used
+	take(idx int)
+
+	// release marks the address at idx as free
+	release(idx int)
+
+	// isFree returns true if the address at idx is free
+	isFree(idx int) bool
+
+	// free returns the number of free addresses
+	free() int
+}
+
+// newAllocator returns a new allocator for the given strategy and
+// n addresses. All addresses are free
+func newAllocator(strategy string, n int) allocator {
+	switch strategy {
+	case StrategyRandom:
+		return &randomAllocator{denseSet: newDenseSet(n)}
+	case StrategyHash:
+		return &hashAllocator{denseSet: newDenseSet(n)}
+	case StrategyLRU:
+		return newLRUAllocator(n)
+	}
+
+	return newSequentialAllocator(n)
+}
+
+func isStrategy(s string) bool {
+	switch s {
+	case StrategySequential, StrategyRandom, StrategyHash, StrategyLRU:
+		return true
+	}
+	return false
+}
+
+// sequentialAllocator always selects the lowest free address
+type sequentialAllocator struct {
+	used  []bool
+	count int
+
+	// low is the lowest address that may be free
+	low int
+}
+
+func newSequentialAllocator(n int) *sequentialAllocator {
+	return &sequentialAllocator{
+		used:  make([]bool, n),
+		count: n,
+	}
+}
+
+func (a *sequentialAllocator) next(_ net.HardwareAddr) int {
+	for a.low < len(a.used) && a.used[a.low] {
+		a.low++
+	}
+
+	if a.low == len(a.used) {
+		return -1
+	}
+
+	idx := a.low
+	a.take(idx)
+	return idx
+}
+
+func (a *sequentialAllocator) take(idx int) {
+	if !a.used[idx] {
+		a.used[idx] = true
+		a.count--
+	}
+}
+
+func (a *sequentialAllocator) release(idx int) {
+	if a.used[idx] {
+		a.used[idx] = false
+		a.count++
+	}
+
+	if idx < a.low {
+		a.low = idx
+	}
+}
+
+func (a *sequentialAllocator) isFree(idx int) bool { return !a.used[idx] }
+
+func (a *sequentialAllocator) free() int { return a.count }
+
+// denseSet is a set of free addresses that supports selecting the
+// n-th free address in constant time
+type denseSet struct {
+	// members holds all free addresses in no particular order
+	members []int32
+
+	// pos holds the position of each address in members or
+	// -1 if the address is used
+	pos []int32
+}
+
+func newDenseSet(n int) denseSet {
+	s := denseSet{
+		members: make([]int32, n),
+		pos:     make([]int32, n),
+	}
+
+	for i := 0; i < n; i++ {
+		s.members[i] = int32(i)
+		s.pos[i] = int32(i)
+	}
+
+	return s
+}
+
+func (s *denseSet) take(idx int) {
+	p := s.pos[idx]
+	if p < 0 {
+		return
+	}
+
+	// move the last member to the position of idx
+	last := s.members[len(s.members)-1]
+	s.members[p] = last
+	s.pos[last] = p
+	s.members = s.members[:len(s.members)-1]
+	s.pos[idx] = -1
+}
+
+func (s *denseSet) release(idx int) {
+	if s.pos[idx] >= 0 {
+		return
+	}
+
+	s.pos[idx] = int32(len(s.members))
+	s.members = append(s.members, int32(idx))
+}
+
+func (s *denseSet) isFree(idx int) bool { return s.pos[idx] >= 0 }
+
+func (s *denseSet) free() int { return len(s.members) }
+
+// randomAllocator selects a random free address
+type randomAllocator struct {
+	denseSet
+}
+
+func (a *randomAllocator) next(_ net.HardwareAddr) int {
+	if len(a.members) == 0 {
+		return -1
+	}
+
+	idx := int(a.members[rand.Intn(len(a.members))])
+	a.take(idx)
+	return idx
+}
+
+// hashAllocator selects the address by hashing the hardware address
+// of the client. If that address is already used, the hash is used
+// to select one of the free addresses instead
+type hashAllocator struct {
+	denseSet
+}
+
+func (a *hashAllocator) next(hwaddr net.HardwareAddr) int {
+	if len(a.members) == 0 {
+		return -1
+	}
+
+	h := fnv.New32a()
+	h.Write(hwaddr)
+	sum := int(h.Sum32())
+
+	idx := sum % len(a.pos)
+	if !a.isFree(idx) {
+		idx = int(a.members[sum%len(a.members)])
+	}
+
+	a.take(idx)
+	return idx
+}
+
+// lruAllocator selects the address that has been released the longest
+// time ago. Free addresses are kept in a doubly linked list ordered by
+// the time they have been released. head is the oldest and tail the
+// most recently released address
+type lruAllocator struct {
+	older, newer []int32
+	inList       []bool
+	head, tail   int32
+	count        int
+}
+
+func newLRUAllocator(n int) *lruAllocator {
+	a := &lruAllocator{
+		older:  make([]int32, n),
+		newer:  make([]int32, n),
+		inList: make([]bool, n),
+		head:   -1,
+		tail:   -1,
+	}
+
+	for i := 0; i < n; i++ {
+		a.release(i)
+	}
+
+	return a
+}
+
+func (a *lruAllocator) next(_ net.HardwareAddr) int {
+	if a.head < 0 {
+		return -1
+	}
+
+	idx := int(a.head)
+	a.take(idx)
+	return idx
+}
+
+func (a *lruAllocator) take(idx int) {
+	if !a.inList[idx] {
+		return
+	}
+
+	older, newer := a.older[idx], a.newer[idx]
+	if older >= 0 {
+		a.newer[older] = newer
+	} else {
+		a.head = newer
+	}
+
+	if newer >= 0 {
+		a.older[newer] = older
+	} else {
+		a.tail = older
+	}
+
+	a.inList[idx] = false
+	a.count--
+}
+
+func (a *lruAllocator) release(idx int) {
+	if a.inList[idx] {
+		return
+	}
+
+	a.older[idx] = a.tail
+	a.newer[idx] = -1
+	if a.tail >= 0 {
+		a.newer[a.tail] = int32(idx)
+	} else {
+		a.head = int32(idx)
+	}
+	a.tail = int32(idx)
+
+	a.inList[idx] = true
+	a.count++
+}
+
+func (a *lruAllocator) isFree(idx int) bool { return a.inList[idx] }
+
+func (a *lruAllocator) free() int { return a.count }
@@ -0,0 +1,80 @@
+package ranges
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllocators(t *testing.T) {
+	for _, strategy := range []string{StrategySequential, StrategyRandom, StrategyHash, StrategyLRU} {
+		a := newAllocator(strategy, 10)
+		assert.Equal(t, 10, a.free(), strategy)
+
+		seen := make(map[int]bool)
+		for i := 0; i < 10; i++ {
+			idx := a.next(net.HardwareAddr{0, 0, 0, 0, 0, byte(i)})
+			assert.True(t, idx >= 0 && idx < 10, strategy)
+			assert.False(t, seen[idx], strategy)
+			assert.False(t, a.isFree(idx), strategy)
+			seen[idx] = true
+		}
+
+		assert.Equal(t, 0, a.free(), strategy)
+		assert.Equal(t, -1, a.next(nil), strategy)
+
+		a.release(3)
+		a.release(3)
+		assert.Equal(t, 1, a.free(), strategy)
+		assert.True(t, a.isFree(3), strategy)
+		assert.Equal(t, 3, a.next(nil), strategy)
+
+		a.release(5)
+		a.take(5)
+		a.take(5)
+		assert.Equal(t, 0, a.free(), strategy)
+	}
+}
+
+func TestSequentialAllocator(t *testing.T) {
+	a := newAllocator(StrategySequential, 5)
+	a.take(0)
+	assert.Equal(t, 1, a.next(nil))
+	assert.Equal(t, 2, a.next(nil))
+
+	a.release(0)
+	assert.Equal(t, 0, a.next(nil))
+	assert.Equal(t, 3, a.next(nil))
+}
+
+func TestHashAllocator(t *testing.T) {
+	hwaddr := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	a := newAllocator(StrategyHash, 100)
+	idx := a.next(hwaddr)
+
+	// the same client gets the same address
+	a = newAllocator(StrategyHash, 100)
+	assert.Equal(t, idx, a.next(hwaddr))
+
+	// even if it has been released in the meantime
+	a.release(idx)
+	assert.Equal(t, idx, a.next(hwaddr))
+}
+
+func TestLRUAllocator(t *testing.T) {
+	a := newAllocator(StrategyLRU, 4)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, i, a.next(nil))
+	}
+
+	a.release(2)
+	a.release(0)
+	a.release(3)
+	a.take(0)
+
+	assert.Equal(t, 2, a.next(nil))
+	assert.Equal(t, 3, a.next(nil))
+	assert.Equal(t, -1, a.next(nil))
+}
@@ -0,0 +1,663 @@
+package static
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/option"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
+)
+
+// Supported formats for static assignment files
+const (
+	FormatEthers  = "ethers"
+	FormatDnsmasq = "dnsmasq"
+	FormatCSV     = "csv"
+	FormatJSON    = "json"
+)
+
+// defaultInterval is the default interval at which static assignment
+// files are checked for changes
+const defaultInterval = 5 * time.Second
+
+type (
+	// entry is a single static IP address assignment. key
+	// identifies the client, see makeKey
+	entry struct {
+		key  string
+		ip   net.IP
+		host *Host
+
+		// primary is set for entries that share the IP address of
+		// another entry, like all MAC addresses of a dnsmasq
+		// dhcp-host line. It holds the key of the first entry
+		primary string
+	}
+
+	// fileSource loads static assignments from a file
+	fileSource struct {
+		path     string
+		format   string
+		interval time.Duration
+		l        log.Logger
+
+		modTime time.Time
+		size    int64
+		entries []entry
+	}
+
+	// jsonEntry is the format of a static assignment in JSON files
+	jsonEntry struct {
+		MAC       string              `json:"mac"`
+		ClientID  string              `json:"client-id"`
+		DUID      string              `json:"duid"`
+		CircuitID string              `json:"circuit-id"`
+		RemoteID  string              `json:"remote-id"`
+		IP        string              `json:"ip"`
+		Hostname  string              `json:"hostname"`
+		Lease     string              `json:"lease"`
+		Options   map[string][]string `json:"options"`
+	}
+)
+
+// detectFormat returns the file format based on the name of path
+func detectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".csv":
+		return FormatCSV
+	case ".conf":
+		return FormatDnsmasq
+	}
+
+	return FormatEthers
+}
+
+// changed checks if the file has been modified since it has been
+// loaded the last time
+func (f *fileSource) changed() (bool, error) {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	return !stat.ModTime().Equal(f.modTime) || stat.Size() != f.size, nil
+}
+
+// load reads and parses the file. The entries of f are only updated
+// if the file could be parsed successfully
+func (f *fileSource) load() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	entries, skipped, err := parseEntries(file, f.format)
+	if err != nil {
+		return fmt.Errorf("%s: %s", f.path, err.Error())
+	}
+
+	if f.l != nil {
+		for _, msg := range skipped {
+			f.l.Warnf("%s: %s", f.path, msg)
+		}
+	}
+
+	f.entries = entries
+	f.modTime = stat.ModTime()
+	f.size = stat.Size()
+
+	return nil
+}
+
+// parseEntries parses static assignments in the given format. Lines
+// that are valid in the format but cannot be used as static assignments
+// are skipped and reported as messages
+func parseEntries(r io.Reader, format string) ([]entry, []string, error) {
+	switch format {
+	case FormatEthers:
+		return parseEthers(r)
+	case FormatDnsmasq:
+		return parseDnsmasq(r)
+	case FormatCSV:
+		entries, err := parseCSV(r)
+		return entries, nil, err
+	case FormatJSON:
+		entries, err := parseJSON(r)
+		return entries, nil, err
+	}
+
+	return nil, nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// lookupIP resolves the hostnames of ethers files
+var lookupIP = net.LookupIP
+
+// parseEthers parses static assignments in the format of /etc/ethers.
+// Hostnames are resolved to their IPv4 address and used as the hostname
+// of the client. Lines with hostnames that cannot be resolved are skipped
+//
+//	# comment
+//	aa:bb:cc:dd:ee:ff 10.0.0.10
+//	aa:bb:cc:dd:ee:00 printer
+func parseEthers(r io.Reader) ([]entry, []string, error) {
+	var (
+		entries []entry
+		skipped []string
+	)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("line %d: expected MAC address and IP address or hostname", line)
+		}
+
+		ip, hostname := fields[1], ""
+		if net.ParseIP(ip) == nil {
+			hostname = fields[1]
+
+			addr, err := resolveIPv4(hostname)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("line %d: skipping %s: %s", line, hostname, err.Error()))
+				continue
+			}
+			ip = addr.String()
+		}
+
+		e, err := newEntry(KeyHWAddr, fields[0], ip)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+
+		e.host = newHost(hostname, 0)
+		entries = append(entries, e)
+	}
+
+	return entries, skipped, scanner.Err()
+}
+
+// resolveIPv4 returns the first IPv4 address of hostname
+func resolveIPv4(hostname string) (net.IP, error) {
+	addrs, err := lookupIP(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		if ip := addr.To4(); ip != nil {
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no IPv4 address for %s", hostname)
+}
+
+var dnsmasqLeaseTime = regexp.MustCompile(`^(infinite|[0-9]+[smhdw]?)$`)
+
+// parseDnsmasq parses dnsmasq dhcp-host lines. Both, the configuration file
+// syntax (dhcp-host=...) and the dhcp-hostsfile syntax are supported. Other
+// configuration directives are ignored. Clients are identified by their MAC
+// addresses, their client identifier (id:) or their hostname, in that order.
+// Lines with multiple MAC addresses assign the same IP address to all of
+// them. Lines without an IPv4 address are skipped
+//
+//	dhcp-host=aa:bb:cc:dd:ee:ff,10.0.0.10,printer,7d
+//	aa:bb:cc:dd:ee:ff,set:office,10.0.0.11,infinite
+//	aa:bb:cc:dd:ee:01,aa:bb:cc:dd:ee:02,10.0.0.12,laptop
+//	id:01:aa:bb:cc:dd:ee:03,10.0.0.13
+func parseDnsmasq(r io.Reader) ([]entry, []string, error) {
+	var (
+		entries []entry
+		skipped []string
+	)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+
+		if idx := strings.Index(text, "="); idx >= 0 {
+			if strings.TrimSpace(text[:idx]) != "dhcp-host" {
+				continue
+			}
+			text = text[idx+1:]
+		}
+
+		var (
+			macs          []string
+			clientID, ip  string
+			hostname      string
+			leaseTime     time.Duration
+			ignored, ipv6 bool
+		)
+
+		for _, field := range strings.Split(text, ",") {
+			field = strings.TrimSpace(field)
+
+			switch {
+			case field == "" || strings.HasPrefix(field, "set:") || strings.HasPrefix(field, "tag:") || field == "id:*":
+				continue
+			case field == "ignore":
+				ignored = true
+			case strings.HasPrefix(field, "id:"):
+				clientID = strings.TrimPrefix(field, "id:")
+			case isMAC(field):
+				macs = append(macs, field)
+			case strings.HasPrefix(field, "["):
+				ipv6 = true
+			case net.ParseIP(field) != nil:
+				ip = field
+			case dnsmasqLeaseTime.MatchString(field):
+				if field == "infinite" {
+					leaseTime = InfiniteLease
+					continue
+				}
+				d, err := parseDnsmasqLeaseTime(field)
+				if err != nil {
+					return nil, nil, fmt.Errorf("line %d: %s", line, err.Error())
+				}
+				leaseTime = d
+			default:
+				hostname = field
+			}
+		}
+
+		switch {
+		case ignored:
+			skipped = append(skipped, fmt.Sprintf("line %d: ignoring clients is not supported, skipping", line))
+			continue
+		case ip == "":
+			if !ipv6 {
+				skipped = append(skipped, fmt.Sprintf("line %d: no IPv4 address, skipping", line))
+			}
+			continue
+		}
+
+		typ, ids := KeyHWAddr, macs
+		switch {
+		case len(macs) > 0:
+		case clientID != "":
+			typ, ids = KeyClientID, []string{clientID}
+		case hostname != "":
+			typ, ids = KeyHostname, []string{hostname}
+		default:
+			skipped = append(skipped, fmt.Sprintf("line %d: no client identifier, skipping", line))
+			continue
+		}
+
+		host := newHost(hostname, leaseTime)
+
+		var group []entry
+		for _, id := range ids {
+			e, err := newEntry(typ, id, ip)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %s", line, err.Error())
+			}
+
+			if len(group) > 0 {
+				e.primary = group[0].key
+			}
+			e.host = host
+			group = append(group, e)
+		}
+
+		entries = append(entries, group...)
+	}
+
+	return entries, skipped, scanner.Err()
+}
+
+// parseDnsmasqLeaseTime parses a dnsmasq lease time. Plain numbers
+// are seconds
+func parseDnsmasqLeaseTime(s string) (time.Duration, error) {
+	if strings.Trim(s, "0123456789") == "" {
+		s += "s"
+	}
+
+	return duration.Parse(s)
+}
+
+// parseCSV parses static assignments from a CSV file. The columns are
+// mac, ip, hostname and lease where hostname and lease are optional. A
+// header row is skipped
+//
+//	mac,ip,hostname,lease
+//	aa:bb:cc:dd:ee:ff,10.0.0.10,printer,7d
+func parseCSV(r io.Reader) ([]entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for idx, record := range records {
+		if idx == 0 && len(record) > 0 && !isMAC(record[0]) {
+			// header row
+			continue
+		}
+
+		if len(record) < 2 || len(record) > 4 {
+			return nil, fmt.Errorf("record %d: expected 2 to 4 columns", idx+1)
+		}
+
+		e, err := newEntry(KeyHWAddr, record[0], record[1])
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", idx+1, err.Error())
+		}
+
+		var (
+			hostname  string
+			leaseTime time.Duration
+		)
+		if len(record) > 2 {
+			hostname = strings.TrimSpace(record[2])
+		}
+		if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+			leaseTime, err = duration.Parse(strings.TrimSpace(record[3]))
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %s", idx+1, err.Error())
+			}
+		}
+
+		e.host = newHost(hostname, leaseTime)
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// parseJSON parses static assignments from a JSON array. Clients are identified
+// by exactly one of mac, client-id, duid, circuit-id or remote-id
+//
+//	[
+//	  {"mac": "aa:bb:cc:dd:ee:ff", "ip": "10.0.0.10", "hostname": "printer",
+//	   "lease": "7d", "options": {"router": ["10.0.0.1"]}},
+//	  {"circuit-id": "eth0/1", "ip": "10.0.0.11"}
+//	]
+func parseJSON(r io.Reader) ([]entry, error) {
+	var list []jsonEntry
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0, len(list))
+	for idx, j := range list {
+		typ, id, err := j.identifier()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", idx, err.Error())
+		}
+
+		e, err := newEntry(typ, id, j.IP)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", idx, err.Error())
+		}
+
+		var leaseTime time.Duration
+		if j.Lease != "" {
+			leaseTime, err = duration.Parse(j.Lease)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %s", idx, err.Error())
+			}
+		}
+
+		e.host = newHost(j.Hostname, leaseTime)
+		if e.host == nil && len(j.Options) > 0 {
+			e.host = &Host{Options: make(map[dhcpv4.OptionCode]dhcpv4.OptionValue)}
+		}
+
+		for name, values := range j.Options {
+			code, value, err := option.Parse(name, values)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: option %s: %s", idx, name, err.Error())
+			}
+			e.host.Options[code] = value
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// identifier returns the type and value of the client identifier
+func (j jsonEntry) identifier() (string, string, error) {
+	var typ, id string
+
+	for _, k := range []struct {
+		typ   string
+		value string
+	}{
+		{KeyHWAddr, j.MAC},
+		{KeyClientID, j.ClientID},
+		{KeyDUID, j.DUID},
+		{KeyCircuitID, j.CircuitID},
+		{KeyRemoteID, j.RemoteID},
+	} {
+		if k.value == "" {
+			continue
+		}
+		if typ != "" {
+			return "", "", fmt.Errorf("only one of mac, client-id, duid, circuit-id or remote-id allowed")
+		}
+		typ, id = k.typ, k.value
+	}
+
+	if typ == "" {
+		return "", "", fmt.Errorf("one of mac, client-id, duid, circuit-id or remote-id required")
+	}
+
+	return typ, id, nil
+}
+
+// newEntry returns a new static assignment and validates the client
+// identifier and ip
+func newEntry(typ, id, ip string) (entry, error) {
+	key, err := makeKey(typ, id)
+	if err != nil {
+		return entry{}, err
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.To4() == nil {
+		return entry{}, fmt.Errorf("invalid IPv4 address %q", ip)
+	}
+
+	return entry{
+		key: key,
+		ip:  addr,
+	}, nil
+}
+
+// newHost returns a new Host for the given hostname and lease time or
+// nil if both are unset
+func newHost(hostname string, leaseTime time.Duration) *Host {
+	if hostname == "" && leaseTime == 0 {
+		return nil
+	}
+
+	h := &Host{
+		Hostname:  hostname,
+		LeaseTime: leaseTime,
+		Options:   make(map[dhcpv4.OptionCode]dhcpv4.OptionValue),
+	}
+
+	if hostname != "" {
+		h.Options[dhcpv4.OptionHostName] = dhcpv4.String(hostname)
+	}
+
+	return h
+}
+
+func isMAC(s string) bool {
+	_, err := net.ParseMAC(s)
+	return err == nil
+}
+
+func stripComment(s string) string {
+	if idx := strings.Index(s, "#"); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
+
+// build merges the static assignments from the Dhcpfile with the ones
+// loaded from files. Client identifiers and IP addresses must be unique
+// across all sources. Client identifiers of different types that identify
+// the same client (like a client-id that contains a MAC address) are
+// rejected as well because only one of them would ever be used
+func (s *Plugin) build() (map[string]net.IP, map[string]*Host, error) {
+	addr := make(map[string]net.IP)
+	ips := make(map[string]string)
+	hosts := make(map[string]*Host)
+
+	all := append([]entry{}, s.inline...)
+	for _, f := range s.files {
+		all = append(all, f.entries...)
+	}
+
+	for _, e := range all {
+		if existing, ok := addr[e.key]; ok {
+			return nil, nil, fmt.Errorf("static IP address %s has already been configured for client %s", existing.String(), e.key)
+		}
+
+		if client, ok := ips[e.ip.String()]; ok && client != e.primary {
+			return nil, nil, fmt.Errorf("IP %s already used for client %s", e.ip, client)
+		}
+
+		addr[e.key] = e.ip
+		if e.primary == "" {
+			ips[e.ip.String()] = e.key
+		}
+		if e.host != nil {
+			hosts[e.key] = e.host
+		}
+	}
+
+	for key := range addr {
+		if other := conflictingKey(key); other != "" {
+			if _, ok := addr[other]; ok {
+				return nil, nil, fmt.Errorf("static assignment for %s conflicts with static assignment for %s", key, other)
+			}
+		}
+	}
+
+	return addr, hosts, nil
+}
+
+// reload reloads f if it has been changed and replaces the static
+// assignments of s. If the file cannot be loaded the current
+// assignments are kept
+func (s *Plugin) reload(f *fileSource) error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	changed, err := f.changed()
+	if err != nil || !changed {
+		return err
+	}
+
+	entries := f.entries
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	addr, hosts, err := s.build()
+	if err != nil {
+		// keep the previous entries so the next change of any
+		// file is validated against the active assignments
+		f.entries = entries
+		return fmt.Errorf("%s: %s", f.path, err.Error())
+	}
+
+	s.rw.Lock()
+	previous := s.Addresses
+	s.Addresses = addr
+	s.Hosts = hosts
+	s.rw.Unlock()
+
+	s.L.Infof("reloaded %d static assignments from %s", len(f.entries), f.path)
+
+	s.checkRanges(addr)
+	s.syncReservations(context.Background(), previous, addr, hosts)
+
+	return nil
+}
+
+// startWatching starts watching all static assignment files for changes
+func (s *Plugin) startWatching() {
+	if len(s.files) == 0 {
+		return
+	}
+
+	s.stop = make(chan struct{})
+
+	for _, f := range s.files {
+		s.wg.Add(1)
+		go func(f *fileSource) {
+			defer s.wg.Done()
+
+			ticker := time.NewTicker(f.interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					if err := s.reload(f); err != nil {
+						s.L.Errorf("failed to reload static assignments: %s", err.Error())
+					}
+				case <-s.stop:
+					return
+				}
+			}
+		}(f)
+	}
+}
+
+// stopWatching stops watching static assignment files and waits for
+// all watchers to return
+func (s *Plugin) stopWatching() {
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	s.wg.Wait()
+	s.stop = nil
+}
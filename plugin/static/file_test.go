@@ -0,0 +1,261 @@
+package static
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEntries(t *testing.T) {
+	cases := []struct {
+		format   string
+		input    string
+		mac      string
+		ip       string
+		hostname string
+		lease    time.Duration
+	}{
+		{FormatEthers, "# comment\n\n00:AA:BB:CC:DD:EE 10.0.0.1 # printer\n", "00:aa:bb:cc:dd:ee", "10.0.0.1", "", 0},
+		{FormatDnsmasq, "domain=lan\ndhcp-host=00:aa:bb:cc:dd:ee,set:office,10.0.0.1,printer,7d\n", "00:aa:bb:cc:dd:ee", "10.0.0.1", "printer", 7 * 24 * time.Hour},
+		{FormatDnsmasq, "00:aa:bb:cc:dd:ee,10.0.0.1,3600\n", "00:aa:bb:cc:dd:ee", "10.0.0.1", "", time.Hour},
+		{FormatDnsmasq, "00:aa:bb:cc:dd:ee,10.0.0.1,infinite\n", "00:aa:bb:cc:dd:ee", "10.0.0.1", "", InfiniteLease},
+		{FormatDnsmasq, "dhcp-host=id:01:00:aa:bb:cc:dd:ee,10.0.0.1\n", "client-id:0100aabbccddee", "10.0.0.1", "", 0},
+		{FormatDnsmasq, "dhcp-host=Printer,10.0.0.1\n", "hostname:printer", "10.0.0.1", "Printer", 0},
+		{FormatCSV, "mac,ip,hostname,lease\n00:aa:bb:cc:dd:ee,10.0.0.1,printer,1h\n", "00:aa:bb:cc:dd:ee", "10.0.0.1", "printer", time.Hour},
+		{FormatCSV, "00:aa:bb:cc:dd:ee,10.0.0.1\n", "00:aa:bb:cc:dd:ee", "10.0.0.1", "", 0},
+		{FormatJSON, `[{"mac": "00:aa:bb:cc:dd:ee", "ip": "10.0.0.1", "hostname": "printer", "lease": "1d"}]`, "00:aa:bb:cc:dd:ee", "10.0.0.1", "printer", 24 * time.Hour},
+	}
+
+	for _, c := range cases {
+		entries, _, err := parseEntries(strings.NewReader(c.input), c.format)
+		require.NoError(t, err, c.input)
+		require.Len(t, entries, 1, c.input)
+
+		e := entries[0]
+		assert.Equal(t, c.mac, e.key, c.input)
+		assert.Equal(t, c.ip, e.ip.String(), c.input)
+
+		if c.hostname == "" && c.lease == 0 {
+			assert.Nil(t, e.host, c.input)
+			continue
+		}
+
+		if assert.NotNil(t, e.host, c.input) {
+			assert.Equal(t, c.hostname, e.host.Hostname, c.input)
+			assert.Equal(t, c.lease, e.host.LeaseTime, c.input)
+		}
+	}
+
+	entries, _, err := parseEntries(strings.NewReader(`[{"mac": "00:aa:bb:cc:dd:ee", "ip": "10.0.0.1", "options": {"router": ["10.0.0.2"]}}]`), FormatJSON)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NotNil(t, entries[0].host)
+	assert.Equal(t, []byte{10, 0, 0, 2}, entries[0].host.Options[dhcpv4.OptionRouter].ToBytes())
+
+	for _, c := range []struct {
+		format string
+		input  string
+	}{
+		{FormatEthers, "00:aa:bb:cc:dd:ee"},
+		{FormatEthers, "00:aa:bb:cc:dd:ee 10.0.0.1 foo"},
+		{FormatEthers, "00:aa:bb:cc:dd 10.0.0.1"},
+		{FormatEthers, "00:aa:bb:cc:dd:ee ::1"},
+		{FormatDnsmasq, "dhcp-host=00:aa:bb:cc:dd:ee,::1"},
+		{FormatCSV, "00:aa:bb:cc:dd:ee"},
+		{FormatCSV, "00:aa:bb:cc:dd:ee,10.0.0.1,printer,foo"},
+		{FormatJSON, `{"mac": "00:aa:bb:cc:dd:ee"}`},
+		{FormatJSON, `[{"mac": "00:aa:bb:cc:dd:ee", "ip": "10.0.0.1", "options": {"router": ["foo"]}}]`},
+		{"yaml", ""},
+	} {
+		_, _, err := parseEntries(strings.NewReader(c.input), c.format)
+		assert.Error(t, err, c.input)
+	}
+}
+
+func TestParseDnsmasq(t *testing.T) {
+	input := strings.Join([]string{
+		"dhcp-host=00:aa:bb:cc:dd:01,00:aa:bb:cc:dd:02,10.0.0.1,laptop",
+		"dhcp-host=00:aa:bb:cc:dd:03,ignore",
+		"dhcp-host=00:aa:bb:cc:dd:04,printer",
+		"dhcp-host=00:aa:bb:cc:dd:05,[::5]",
+		"dhcp-host=set:office,7d",
+		"dhcp-host=00:aa:bb:cc:dd:06,10.0.0.6",
+	}, "\n")
+
+	entries, skipped, err := parseEntries(strings.NewReader(input), FormatDnsmasq)
+	require.NoError(t, err)
+	assert.Len(t, skipped, 3)
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, "00:aa:bb:cc:dd:01", entries[0].key)
+	assert.Equal(t, "", entries[0].primary)
+	assert.Equal(t, "00:aa:bb:cc:dd:02", entries[1].key)
+	assert.Equal(t, "00:aa:bb:cc:dd:01", entries[1].primary)
+	assert.Equal(t, "10.0.0.1", entries[1].ip.String())
+	assert.Equal(t, "laptop", entries[1].host.Hostname)
+	assert.Equal(t, "00:aa:bb:cc:dd:06", entries[2].key)
+
+	// infinite leases are sent as 0xffffffff
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff}, dhcpv4.OptIPAddressLeaseTime(InfiniteLease).Value.ToBytes())
+
+	// both MAC addresses get the same IP address
+	plg := &Plugin{inline: entries}
+	addr, _, err := plg.build()
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", addr["00:aa:bb:cc:dd:02"].String())
+
+	// but other lines must still use different addresses
+	plg.inline = append(plg.inline, entry{key: "00:aa:bb:cc:dd:07", ip: net.IP{10, 0, 0, 1}})
+	_, _, err = plg.build()
+	assert.Error(t, err)
+}
+
+func TestParseEthers(t *testing.T) {
+	defer func(f func(string) ([]net.IP, error)) { lookupIP = f }(lookupIP)
+	lookupIP = func(host string) ([]net.IP, error) {
+		if host == "printer" {
+			return []net.IP{net.ParseIP("fe80::1"), {10, 0, 0, 2}}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	input := "00:aa:bb:cc:dd:01 10.0.0.1\n00:aa:bb:cc:dd:02 printer\n00:aa:bb:cc:dd:03 unknown\n"
+
+	entries, skipped, err := parseEntries(strings.NewReader(input), FormatEthers)
+	require.NoError(t, err)
+	assert.Len(t, skipped, 1)
+
+	require.Len(t, entries, 2)
+	assert.Nil(t, entries[0].host)
+	assert.Equal(t, "10.0.0.2", entries[1].ip.String())
+	if assert.NotNil(t, entries[1].host) {
+		assert.Equal(t, "printer", entries[1].host.Hostname)
+	}
+}
+
+func TestStaticPluginFileSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ethers := filepath.Join(dir, "ethers")
+	require.NoError(t, ioutil.WriteFile(ethers, []byte("00:aa:bb:cc:dd:ee 10.0.0.1\n"), 0644))
+
+	hosts := filepath.Join(dir, "hosts.txt")
+	require.NoError(t, ioutil.WriteFile(hosts, []byte("00:aa:bb:cc:dd:ff,10.0.0.2,printer\n"), 0644))
+
+	c := caddy.NewTestController("dhcpv4", `
+	static 00:aa:bb:cc:dd:00 10.0.0.10
+	static file `+ethers+`
+	static file `+hosts+` dnsmasq {
+		interval 1m
+	}
+	`)
+	plg, err := makeStaticPlugin(c)
+	require.NoError(t, err)
+	require.Len(t, plg.files, 2)
+	assert.Equal(t, FormatEthers, plg.files[0].format)
+	assert.Equal(t, defaultInterval, plg.files[0].interval)
+	assert.Equal(t, FormatDnsmasq, plg.files[1].format)
+	assert.Equal(t, time.Minute, plg.files[1].interval)
+	assert.Len(t, plg.Addresses, 3)
+	assert.Equal(t, "printer", plg.Hosts["00:aa:bb:cc:dd:ff"].Hostname)
+
+	for _, input := range []string{
+		"static file",
+		"static file " + filepath.Join(dir, "missing"),
+		"static file " + ethers + " yaml",
+		"static file " + ethers + " {\ninterval foo\n}",
+		"static file " + ethers + " {\nunknown\n}",
+		// duplicate MAC address
+		"static 00:aa:bb:cc:dd:ee 10.0.0.10\nstatic file " + ethers,
+		// duplicate IP address
+		"static 00:aa:bb:cc:dd:00 10.0.0.1\nstatic file " + ethers,
+	} {
+		c = caddy.NewTestController("dhcpv4", input)
+		_, err = makeStaticPlugin(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestStaticPluginReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "static.csv")
+	require.NoError(t, ioutil.WriteFile(path, []byte("00:aa:bb:cc:dd:ee,10.0.0.1\n"), 0644))
+
+	c := caddy.NewTestController("dhcpv4", "static 00:aa:bb:cc:dd:00 10.0.0.10\nstatic file "+path)
+	plg, err := makeStaticPlugin(c)
+	require.NoError(t, err)
+	plg.Config = &dhcpserver.Config{}
+	plg.Next = test.ErrorHandler
+
+	serve := func(hw net.HardwareAddr) (net.IP, error) {
+		req, _ := dhcpv4.NewDiscovery(hw)
+		res, _ := dhcpv4.NewReplyFromRequest(req)
+		err := plg.ServeDHCP(context.Background(), req, res)
+		return res.YourIPAddr, err
+	}
+
+	ip, err := serve(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", ip.String())
+
+	// unchanged files are not reloaded
+	assert.NoError(t, plg.reload(plg.files[0]))
+
+	// a broken file keeps the current assignments
+	write := func(content string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		// make sure the modification is detected on file systems
+		// with a coarse timestamp resolution
+		mtime := time.Now().Add(time.Duration(len(content)) * time.Second)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+
+	write("00:aa:bb:cc:dd:ee,10.0.0.1,printer,foo\n")
+	assert.Error(t, plg.reload(plg.files[0]))
+	ip, err = serve(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", ip.String())
+
+	// conflicts with inline assignments keep the current assignments
+	write("00:aa:bb:cc:dd:ee,10.0.0.10\n")
+	assert.Error(t, plg.reload(plg.files[0]))
+	ip, err = serve(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", ip.String())
+
+	write("mac,ip\n00:aa:bb:cc:dd:ff,10.0.0.2\n")
+	plg.startWatching()
+	defer plg.stopWatching()
+
+	// the watcher is only started with the default interval so reload
+	// manually and make sure it does not race with the watcher
+	assert.NoError(t, plg.reload(plg.files[0]))
+
+	_, err = serve(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee})
+	assert.Error(t, err)
+
+	ip, err = serve(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xff})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", ip.String())
+
+	ip, err = serve(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0x00})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.10", ip.String())
+}
@@ -0,0 +1,168 @@
+package static
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// Supported identifiers for static assignments
+const (
+	KeyHWAddr    = "hwaddr"
+	KeyClientID  = "client-id"
+	KeyDUID      = "duid"
+	KeyCircuitID = "circuit-id"
+	KeyRemoteID  = "remote-id"
+	KeyHostname  = "hostname"
+)
+
+// keyPrecedence lists all identifiers in the order they are tried
+// when looking up the static assignment for a request. Identifiers
+// chosen by the client itself are more specific than the relay port
+// the client is connected to. The hostname is the least trustworthy
+// identifier
+var keyPrecedence = []string{
+	KeyClientID,
+	KeyDUID,
+	KeyHWAddr,
+	KeyCircuitID,
+	KeyRemoteID,
+	KeyHostname,
+}
+
+// isKeyType returns true if s is a supported identifier
+func isKeyType(s string) bool {
+	for _, k := range keyPrecedence {
+		if k == s {
+			return true
+		}
+	}
+	return false
+}
+
+// makeKey returns the key used in Plugin.Addresses and Plugin.Hosts for
+// the identifier value of the given type. Keys of hardware addresses are
+// the MAC address itself, all other keys are prefixed with their type
+func makeKey(typ, value string) (string, error) {
+	switch typ {
+	case KeyHWAddr:
+		hw, err := net.ParseMAC(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid MAC address %q", value)
+		}
+		return hw.String(), nil
+
+	case KeyClientID, KeyCircuitID, KeyRemoteID:
+		if value == "" {
+			return "", fmt.Errorf("empty %s", typ)
+		}
+		return bytesKey(typ, parseIdentifier(value)), nil
+
+	case KeyDUID:
+		b, err := hex.DecodeString(strings.Replace(value, ":", "", -1))
+		if err != nil || len(b) == 0 {
+			return "", fmt.Errorf("invalid DUID %q", value)
+		}
+		return bytesKey(typ, b), nil
+
+	case KeyHostname:
+		if value == "" {
+			return "", fmt.Errorf("empty %s", typ)
+		}
+		return typ + ":" + strings.ToLower(value), nil
+	}
+
+	return "", fmt.Errorf("unsupported identifier %q", typ)
+}
+
+// requestKeys returns all keys for req in the order of keyPrecedence
+func requestKeys(req *dhcpv4.DHCPv4) []string {
+	var keys []string
+
+	if cid := req.Options.Get(dhcpv4.OptionClientIdentifier); len(cid) > 0 {
+		keys = append(keys, bytesKey(KeyClientID, cid))
+
+		// RFC 4361 client identifiers are made of the type 255, a
+		// four byte IAID and the DUID of the client
+		if cid[0] == 255 && len(cid) > 5 {
+			keys = append(keys, bytesKey(KeyDUID, cid[5:]))
+		}
+	}
+
+	if len(req.ClientHWAddr) > 0 {
+		keys = append(keys, req.ClientHWAddr.String())
+	}
+
+	if relay := req.RelayAgentInfo(); relay != nil {
+		if id := relay.Get(dhcpv4.AgentCircuitIDSubOption); len(id) > 0 {
+			keys = append(keys, bytesKey(KeyCircuitID, id))
+		}
+		if id := relay.Get(dhcpv4.AgentRemoteIDSubOption); len(id) > 0 {
+			keys = append(keys, bytesKey(KeyRemoteID, id))
+		}
+	}
+
+	if name := req.HostName(); name != "" {
+		keys = append(keys, KeyHostname+":"+strings.ToLower(name))
+	}
+
+	return keys
+}
+
+// conflictingKey returns the key of the other identifier type that
+// identifies the same client as key, if any. A client identifier of
+// type 1 contains the MAC address of the client and RFC 4361 client
+// identifiers contain the DUID of the client
+func conflictingKey(key string) string {
+	if !strings.HasPrefix(key, KeyClientID+":") {
+		return ""
+	}
+
+	cid, err := hex.DecodeString(strings.TrimPrefix(key, KeyClientID+":"))
+	if err != nil || len(cid) == 0 {
+		return ""
+	}
+
+	switch {
+	case cid[0] == 1 && len(cid) == 7:
+		return net.HardwareAddr(cid[1:]).String()
+	case cid[0] == 255 && len(cid) > 5:
+		return bytesKey(KeyDUID, cid[5:])
+	}
+
+	return ""
+}
+
+func bytesKey(typ string, b []byte) string {
+	return typ + ":" + hex.EncodeToString(b)
+}
+
+// parseIdentifier parses a colon separated list of hex bytes (like
+// "01:aa:bb"). Any other value is used as a string
+func parseIdentifier(s string) []byte {
+	if !strings.Contains(s, ":") {
+		return []byte(s)
+	}
+
+	var b []byte
+	for _, part := range strings.Split(s, ":") {
+		if len(part) == 0 || len(part) > 2 {
+			return []byte(s)
+		}
+
+		if len(part) == 1 {
+			part = "0" + part
+		}
+
+		v, err := hex.DecodeString(part)
+		if err != nil {
+			return []byte(s)
+		}
+		b = append(b, v...)
+	}
+
+	return b
+}
@@ -0,0 +1,133 @@
+package static
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeKey(t *testing.T) {
+	cases := []struct {
+		typ   string
+		value string
+		key   string
+	}{
+		{KeyHWAddr, "00:AA:BB:CC:DD:EE", "00:aa:bb:cc:dd:ee"},
+		{KeyClientID, "01:00:aa:bb:cc:dd:ee", "client-id:0100aabbccddee"},
+		{KeyClientID, "1:a", "client-id:010a"},
+		{KeyClientID, "printer", "client-id:7072696e746572"},
+		{KeyDUID, "00:01:00:01:aa:bb", "duid:00010001aabb"},
+		{KeyDUID, "00010001aabb", "duid:00010001aabb"},
+		{KeyCircuitID, "eth0/1", "circuit-id:657468302f31"},
+		{KeyRemoteID, "sw1:port", "remote-id:7377313a706f7274"},
+		{KeyHostname, "Printer", "hostname:printer"},
+	}
+
+	for _, c := range cases {
+		key, err := makeKey(c.typ, c.value)
+		require.NoError(t, err, c.value)
+		assert.Equal(t, c.key, key, c.value)
+	}
+
+	for _, c := range [][2]string{
+		{KeyHWAddr, "foo"},
+		{KeyDUID, "xyz"},
+		{KeyClientID, ""},
+		{KeyHostname, ""},
+		{"unknown", "foo"},
+	} {
+		_, err := makeKey(c[0], c[1])
+		assert.Error(t, err, c)
+	}
+}
+
+func TestStaticPluginKeySetup(t *testing.T) {
+	c := caddy.NewTestController("dhcpv4", `
+	static 00:aa:bb:cc:dd:ee 10.0.0.1
+	static hwaddr 00:aa:bb:cc:dd:ff 10.0.0.2
+	static client-id 01:00:aa:bb:cc:dd:00 10.0.0.3
+	static duid 00:01:00:01:aa:bb 10.0.0.4
+	static circuit-id eth0/1 10.0.0.5
+	static remote-id sw1 10.0.0.6
+	static hostname printer 10.0.0.7 {
+		lease 1h
+	}
+	`)
+	plg, err := makeStaticPlugin(c)
+	require.NoError(t, err)
+	assert.Len(t, plg.Addresses, 7)
+	assert.Equal(t, "10.0.0.5", plg.Addresses["circuit-id:657468302f31"].String())
+	assert.NotNil(t, plg.Hosts["hostname:printer"])
+
+	for _, input := range []string{
+		"static client-id",
+		"static client-id 10.0.0.1",
+		"static duid foo 10.0.0.1",
+		// the same client-id configured twice
+		"static client-id foo 10.0.0.1\nstatic client-id foo 10.0.0.2",
+		// client-id of type 1 contains the MAC address
+		"static 00:aa:bb:cc:dd:ee 10.0.0.1\nstatic client-id 01:00:aa:bb:cc:dd:ee 10.0.0.2",
+		// RFC 4361 client-id contains the DUID
+		"static duid 00:01:00:01:aa:bb 10.0.0.1\nstatic client-id ff:00:00:00:01:00:01:00:01:aa:bb 10.0.0.2",
+	} {
+		c = caddy.NewTestController("dhcpv4", input)
+		_, err = makeStaticPlugin(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestStaticPluginKeyPrecedence(t *testing.T) {
+	c := caddy.NewTestController("dhcpv4", `
+	static 00:aa:bb:cc:dd:ee 10.0.0.1
+	static client-id foo 10.0.0.2
+	static duid 00:01:aa:bb 10.0.0.3
+	static circuit-id eth0/1 10.0.0.4
+	static remote-id sw1 10.0.0.5
+	static hostname printer 10.0.0.6
+	`)
+	plg, err := makeStaticPlugin(c)
+	require.NoError(t, err)
+	plg.Config = &dhcpserver.Config{}
+	plg.Next = test.ErrorHandler
+
+	hwaddr := net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	other := net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xff}
+	relay := dhcpv4.OptRelayAgentInfo(
+		dhcpv4.OptGeneric(dhcpv4.AgentCircuitIDSubOption, []byte("eth0/1")),
+		dhcpv4.OptGeneric(dhcpv4.AgentRemoteIDSubOption, []byte("sw1")),
+	)
+
+	cases := []struct {
+		hwaddr net.HardwareAddr
+		opts   []dhcpv4.Option
+		ip     string
+	}{
+		{hwaddr, []dhcpv4.Option{dhcpv4.OptClientIdentifier([]byte("foo")), relay}, "10.0.0.2"},
+		{other, []dhcpv4.Option{dhcpv4.OptClientIdentifier([]byte{0xff, 0, 0, 0, 1, 0, 1, 0xaa, 0xbb})}, "10.0.0.3"},
+		{hwaddr, []dhcpv4.Option{dhcpv4.OptClientIdentifier([]byte("bar")), relay}, "10.0.0.1"},
+		{other, []dhcpv4.Option{relay, dhcpv4.OptHostName("printer")}, "10.0.0.4"},
+		{other, []dhcpv4.Option{dhcpv4.OptRelayAgentInfo(dhcpv4.OptGeneric(dhcpv4.AgentRemoteIDSubOption, []byte("sw1")))}, "10.0.0.5"},
+		{other, []dhcpv4.Option{dhcpv4.OptHostName("PRINTER")}, "10.0.0.6"},
+	}
+
+	for idx, c := range cases {
+		req, _ := dhcpv4.NewDiscovery(c.hwaddr)
+		for _, o := range c.opts {
+			req.UpdateOption(o)
+		}
+		res, _ := dhcpv4.NewReplyFromRequest(req)
+		require.NoError(t, plg.ServeDHCP(context.Background(), req, res), idx)
+		assert.Equal(t, c.ip, res.YourIPAddr.String(), idx)
+	}
+
+	req, _ := dhcpv4.NewDiscovery(other)
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	assert.Error(t, plg.ServeDHCP(context.Background(), req, res))
+}
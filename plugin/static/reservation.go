@@ -0,0 +1,112 @@
+package static
+
+import (
+	"context"
+	"net"
+
+	"github.com/nextdhcp/nextdhcp/core/lease"
+)
+
+// client returns the lease database client for the static assignment
+// identified by key. Only assignments by MAC address have a hardware
+// address, all others are stored using their key as the client ID
+func client(key string, host *Host) lease.Client {
+	cli := lease.Client{
+		ID: key,
+	}
+
+	if hw, err := net.ParseMAC(key); err == nil {
+		cli.HwAddr = hw
+	}
+
+	if host != nil {
+		cli.Hostname = host.Hostname
+	}
+
+	return cli
+}
+
+// storedReservations returns all static reservations that are stored in
+// the lease database. They may be left over from a previous configuration
+func (s *Plugin) storedReservations(ctx context.Context) map[string]net.IP {
+	reserved := make(map[string]net.IP)
+
+	db := s.Config.LeaseDatabase()
+	if db == nil {
+		return reserved
+	}
+
+	list, err := db.ReservedAddresses(ctx)
+	if err != nil {
+		s.L.Warnf("failed to load static reservations: %s", err.Error())
+		return reserved
+	}
+
+	for _, r := range list {
+		if r.Expires == nil {
+			reserved[r.ID] = r.IP
+		}
+	}
+
+	return reserved
+}
+
+// syncReservations stores all static assignments as non-expiring
+// reservations in the lease database and deletes the reservations of
+// assignments that are no longer configured. If multiple clients share
+// an IP address it is reserved for one of them
+func (s *Plugin) syncReservations(ctx context.Context, previous, current map[string]net.IP, hosts map[string]*Host) {
+	db := s.Config.LeaseDatabase()
+	if db == nil {
+		return
+	}
+
+	owners := reservationOwners(current)
+
+	for ip, key := range reservationOwners(previous) {
+		if owners[ip] == key {
+			continue
+		}
+
+		cli := client(key, nil)
+		if err := db.DeleteReservation(ctx, net.ParseIP(ip), &cli); err != nil {
+			s.L.Warnf("failed to delete static reservation of %s for %s: %s", ip, key, err.Error())
+		}
+	}
+
+	for ip, key := range owners {
+		if err := db.ReserveStatic(ctx, net.ParseIP(ip), client(key, hosts[key])); err != nil {
+			s.L.Errorf("failed to store static reservation of %s for %s: %s", ip, key, err.Error())
+		}
+	}
+}
+
+// reservationOwners returns the key of the client each IP address is
+// reserved for. If multiple clients share an IP address the smallest
+// key is used so the reservation does not change between reloads
+func reservationOwners(addresses map[string]net.IP) map[string]string {
+	owners := make(map[string]string, len(addresses))
+
+	for key, ip := range addresses {
+		if owner, ok := owners[ip.String()]; !ok || key < owner {
+			owners[ip.String()] = key
+		}
+	}
+
+	return owners
+}
+
+// checkRanges warns about static IP addresses that are part of the
+// ranges used for dynamic assignments. Those addresses are never
+// offered to other clients
+func (s *Plugin) checkRanges(addresses map[string]net.IP) {
+	if len(s.Config.Ranges) == 0 {
+		return
+	}
+
+	for key, ip := range addresses {
+		if s.Config.Ranges.Contains(ip) {
+			s.L.Warnf("static IP %s for %s is part of the dynamic range %s", ip, key, s.Config.Ranges.String())
+		}
+	}
+}
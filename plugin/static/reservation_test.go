@@ -0,0 +1,129 @@
+package static
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/caddyserver/caddy/caddyfile"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage"
+	"github.com/nextdhcp/nextdhcp/core/lease/storage/drivers/memory"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticReservations(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewDatabase(memory.New())
+
+	hwaddr := net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	other := net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xff}
+
+	// the client had a dynamic lease before and another client leased
+	// the static IP address
+	_, err := db.Lease(ctx, net.IP{10, 0, 0, 100}, lease.Client{HwAddr: hwaddr}, time.Hour, false)
+	require.NoError(t, err)
+	_, err = db.Lease(ctx, net.IP{10, 0, 0, 1}, lease.Client{HwAddr: other}, time.Hour, false)
+	require.NoError(t, err)
+
+	// left over from a previous configuration
+	require.NoError(t, db.ReserveStatic(ctx, net.IP{10, 0, 0, 9}, lease.Client{ID: "hostname:old"}))
+
+	c := caddy.NewTestController("dhcpv4", `
+	static 00:aa:bb:cc:dd:ee 10.0.0.1 {
+		hostname printer
+	}
+	static circuit-id eth0/1 10.0.0.2
+	`)
+	plg, err := makeStaticPlugin(c)
+	require.NoError(t, err)
+	plg.Config = &dhcpserver.Config{Database: db}
+
+	plg.syncReservations(ctx, plg.storedReservations(ctx), plg.Addresses, plg.Hosts)
+
+	leases, err := db.Leases(ctx)
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	for _, l := range leases {
+		assert.Equal(t, lease.Never.Unix(), l.Expires.Unix())
+	}
+
+	reserved, err := db.ReservedAddresses(ctx)
+	require.NoError(t, err)
+	require.Len(t, reserved, 2)
+
+	r := reserved.FindID("00:aa:bb:cc:dd:ee")
+	require.NotNil(t, r)
+	assert.Equal(t, "10.0.0.1", r.IP.String())
+	assert.Nil(t, r.Expires)
+
+	r = reserved.FindID("circuit-id:657468302f31")
+	require.NotNil(t, r)
+	assert.Equal(t, "10.0.0.2", r.IP.String())
+
+	// static reservations are neither available for other clients
+	// nor released
+	assert.Equal(t, lease.ErrAddressStatic, db.Reserve(ctx, net.IP{10, 0, 0, 1}, lease.Client{HwAddr: other}))
+	_, err = db.Lease(ctx, net.IP{10, 0, 0, 2}, lease.Client{HwAddr: other}, time.Hour, false)
+	assert.Equal(t, lease.ErrAddressStatic, err)
+	assert.NoError(t, db.Release(ctx, net.IP{10, 0, 0, 1}))
+
+	// removed assignments are deleted
+	current := map[string]net.IP{"00:aa:bb:cc:dd:ee": {10, 0, 0, 3}}
+	plg.syncReservations(ctx, plg.Addresses, current, nil)
+
+	reserved, err = db.ReservedAddresses(ctx)
+	require.NoError(t, err)
+	require.Len(t, reserved, 1)
+	assert.Equal(t, "10.0.0.3", reserved[0].IP.String())
+	assert.NoError(t, db.Reserve(ctx, net.IP{10, 0, 0, 1}, lease.Client{HwAddr: other}))
+
+	// clients sharing an IP address reserve it only once
+	shared := map[string]net.IP{"00:aa:bb:cc:dd:ee": {10, 0, 0, 3}, "00:aa:bb:cc:dd:ef": {10, 0, 0, 3}}
+	for i := 0; i < 3; i++ {
+		plg.syncReservations(ctx, current, shared, nil)
+		current = shared
+	}
+
+	reserved, err = db.ReservedAddresses(ctx)
+	require.NoError(t, err)
+
+	var static []string
+	for _, r := range reserved {
+		if r.Expires == nil {
+			static = append(static, r.ID)
+		}
+	}
+	assert.Equal(t, []string{"00:aa:bb:cc:dd:ee"}, static)
+}
+
+func TestNestedStaticReservations(t *testing.T) {
+	ctx := context.Background()
+
+	// the nested block is set up before the default database of the
+	// server block is opened
+	c := test.CreateTestBed(t, "")
+	nested, err := dhcpserver.SetupNested(c, map[string][]caddyfile.Token{
+		"static": {{Text: "static"}, {Text: "00:aa:bb:cc:dd:ee"}, {Text: "10.0.0.5"}},
+	})
+	require.NoError(t, err)
+
+	plg, ok := nested(test.NoOpHandler).(*Plugin)
+	require.True(t, ok)
+
+	db := storage.NewDatabase(memory.New())
+	dhcpserver.GetConfig(c).Database = db
+
+	plg.syncReservations(ctx, plg.storedReservations(ctx), plg.Addresses, plg.Hosts)
+
+	reserved, err := db.ReservedAddresses(ctx)
+	require.NoError(t, err)
+	require.Len(t, reserved, 1)
+	assert.Equal(t, "10.0.0.5", reserved[0].IP.String())
+	assert.Nil(t, reserved[0].Expires)
+}
@@ -1,12 +1,16 @@
 package static
 
 import (
-	"fmt"
+	"context"
 	"net"
 
 	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
 	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/option"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
 	"github.com/nextdhcp/nextdhcp/plugin"
 )
 
@@ -28,21 +32,61 @@ func setupStatic(c *caddy.Controller) error {
 
 		return plg
 	})
+
+	// the lease database is opened after all plugins have been
+	// set up so static reservations can only be stored on startup
+	c.OnStartup(func() error {
+		ctx := context.Background()
+		addresses, hosts := plg.snapshot()
+
+		plg.checkRanges(addresses)
+		plg.syncReservations(ctx, plg.storedReservations(ctx), addresses, hosts)
+
+		plg.startWatching()
+		return nil
+	})
+
+	if len(plg.files) > 0 {
+		c.OnShutdown(func() error {
+			plg.stopWatching()
+			return nil
+		})
+	}
+
 	return nil
 }
 
 func makeStaticPlugin(c *caddy.Controller) (*Plugin, error) {
-	addr := make(map[string]net.IP)
-	ips := make(map[string]struct{})
+	plg := &Plugin{
+		Config: dhcpserver.GetConfig(c),
+	}
+	plg.L = log.GetLogger(c, plg)
 
 	for c.Next() {
 		if !c.NextArg() {
 			return nil, c.ArgErr()
 		}
 
-		key := c.Val()
-		if _, err := net.ParseMAC(key); err != nil {
-			return nil, c.ArgErr()
+		if c.Val() == "file" {
+			f, err := parseFileSource(c, plg.L)
+			if err != nil {
+				return nil, err
+			}
+			plg.files = append(plg.files, f)
+			continue
+		}
+
+		typ := KeyHWAddr
+		if isKeyType(c.Val()) {
+			typ = c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+
+		key, err := makeKey(typ, c.Val())
+		if err != nil {
+			return nil, c.Err(err.Error())
 		}
 
 		if !c.NextArg() {
@@ -53,24 +97,157 @@ func makeStaticPlugin(c *caddy.Controller) (*Plugin, error) {
 			return nil, c.ArgErr()
 		}
 
-		if e, ok := addr[key]; ok {
-			return nil, fmt.Errorf("static IP address %s has already been configured for client %s", e.String(), key)
+		var classes []string
+		if plg.Config != nil {
+			classes = plg.Config.Classes
 		}
 
-		if _, ok := ips[ip.String()]; ok {
-			return nil, fmt.Errorf("IP %s already used for client %s", ip, key)
+		host, err := parseHost(c, classes)
+		if err != nil {
+			return nil, err
 		}
 
-		addr[key] = ip
-		ips[ip.String()] = struct{}{}
+		plg.inline = append(plg.inline, entry{
+			key:  key,
+			ip:   ip,
+			host: host,
+		})
 	}
 
-	plg := &Plugin{
-		Addresses: addr,
-		Config:    dhcpserver.GetConfig(c),
+	addr, hosts, err := plg.build()
+	if err != nil {
+		return nil, err
 	}
-
-	plg.L = log.GetLogger(c, plg)
+	plg.Addresses = addr
+	plg.Hosts = hosts
 
 	return plg, nil
 }
+
+// parseFileSource parses a static assignment file and loads it
+//
+//	static file PATH [FORMAT] {
+//	    interval DURATION
+//	}
+func parseFileSource(c *caddy.Controller, l log.Logger) (*fileSource, error) {
+	args := c.RemainingArgs()
+	if len(args) < 1 || len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+
+	f := &fileSource{
+		path:     args[0],
+		format:   detectFormat(args[0]),
+		interval: defaultInterval,
+		l:        l,
+	}
+
+	if len(args) == 2 {
+		switch args[1] {
+		case FormatEthers, FormatDnsmasq, FormatCSV, FormatJSON:
+			f.format = args[1]
+		default:
+			return nil, c.SyntaxErr("one of ethers, dnsmasq, csv or json")
+		}
+	}
+
+	for c.NextBlock() {
+		switch c.Val() {
+		case "interval":
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			d, err := duration.Parse(c.Val())
+			if err != nil || d <= 0 {
+				return nil, c.SyntaxErr("duration")
+			}
+			f.interval = d
+
+		default:
+			return nil, c.ArgErr()
+		}
+
+		if c.NextArg() {
+			return nil, c.ArgErr()
+		}
+	}
+
+	if err := f.load(); err != nil {
+		return nil, c.Errf("failed to load static assignments: %s", err.Error())
+	}
+
+	return f, nil
+}
+
+// parseHost parses the optional configuration block of a static
+// assignment. It returns nil if there's no block. classes holds
+// the names of all client classes defined for the server block
+func parseHost(c *caddy.Controller, classes []string) (*Host, error) {
+	var host *Host
+
+	for c.NextBlock() {
+		if host == nil {
+			host = &Host{
+				Options: make(map[dhcpv4.OptionCode]dhcpv4.OptionValue),
+			}
+		}
+
+		switch c.Val() {
+		case "hostname":
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			host.Hostname = c.Val()
+			host.Options[dhcpv4.OptionHostName] = dhcpv4.String(host.Hostname)
+
+		case "lease":
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			d, err := duration.Parse(c.Val())
+			if err != nil || d <= 0 {
+				return nil, c.SyntaxErr("duration")
+			}
+			host.LeaseTime = d
+
+		case "bootfile":
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			host.Options[dhcpv4.OptionBootfileName] = dhcpv4.String(c.Val())
+
+		case "option":
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			name := c.Val()
+			values := c.RemainingArgs()
+			if len(values) == 0 {
+				return nil, c.ArgErr()
+			}
+			code, value, err := option.Parse(name, values)
+			if err != nil {
+				return nil, c.Errf("invalid option %s: %s", name, err.Error())
+			}
+			host.Options[code] = value
+			continue
+
+		case "class":
+			s, err := class.ParseSet(c, classes)
+			if err != nil {
+				return nil, err
+			}
+			host.Classes = s
+			continue
+
+		default:
+			return nil, c.ArgErr()
+		}
+
+		if c.NextArg() {
+			return nil, c.ArgErr()
+		}
+	}
+
+	return host, nil
+}
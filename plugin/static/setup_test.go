@@ -1,12 +1,15 @@
 package static
 
 import (
+	"context"
 	"net"
 	"testing"
-
-	_ "github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"time"
 
 	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +48,69 @@ func TestStaticPluginSetup(t *testing.T) {
 	_, err = makeStaticPlugin(c)
 	assert.Error(t, err)
 }
+
+func TestStaticPluginHostSetup(t *testing.T) {
+	cfg := `
+	static 00:aa:bb:cc:dd:ee 10.0.0.1 {
+		hostname printer
+		lease 7d
+		option router 10.0.0.2
+		option 0xfe 0xaabb
+		bootfile pxelinux.0
+	}
+	static 00:bb:cc:dd:ee:ff 10.0.0.2
+	`
+	c := caddy.NewTestController("dhcpv4", cfg)
+	static, err := makeStaticPlugin(c)
+	assert.NoError(t, err)
+	assert.Len(t, static.Addresses, 2)
+	assert.Len(t, static.Hosts, 1)
+
+	host := static.Hosts["00:aa:bb:cc:dd:ee"]
+	if assert.NotNil(t, host) {
+		assert.Equal(t, "printer", host.Hostname)
+		assert.Equal(t, 7*24*time.Hour, host.LeaseTime)
+		assert.Equal(t, []byte("printer"), host.Options[dhcpv4.OptionHostName].ToBytes())
+		assert.Equal(t, []byte{10, 0, 0, 2}, host.Options[dhcpv4.OptionRouter].ToBytes())
+		assert.Equal(t, []byte{0xaa, 0xbb}, host.Options[dhcpv4.GenericOptionCode(0xfe)].ToBytes())
+		assert.Equal(t, []byte("pxelinux.0"), host.Options[dhcpv4.OptionBootfileName].ToBytes())
+	}
+
+	for _, cfg := range []string{
+		"static 00:aa:bb:cc:dd:ee 10.0.0.1 {\nlease foo\n}",
+		"static 00:aa:bb:cc:dd:ee 10.0.0.1 {\nhostname\n}",
+		"static 00:aa:bb:cc:dd:ee 10.0.0.1 {\nhostname a b\n}",
+		"static 00:aa:bb:cc:dd:ee 10.0.0.1 {\noption router\n}",
+		"static 00:aa:bb:cc:dd:ee 10.0.0.1 {\noption router foo\n}",
+		"static 00:aa:bb:cc:dd:ee 10.0.0.1 {\nunknown foo\n}",
+	} {
+		c = caddy.NewTestController("dhcpv4", cfg)
+		_, err = makeStaticPlugin(c)
+		assert.Error(t, err, cfg)
+	}
+}
+
+func TestStaticPluginHostOptions(t *testing.T) {
+	c := caddy.NewTestController("dhcpv4", "static 00:aa:bb:cc:dd:ee 10.0.0.1 {\nhostname printer\nlease 1h\noption router 10.0.0.2\n}")
+	static, err := makeStaticPlugin(c)
+	assert.NoError(t, err)
+	static.Config = &dhcpserver.Config{}
+	static.Next = test.ErrorHandler
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}, dhcpv4.WithRequestedOptions(dhcpv4.OptionRouter))
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	// subnet level options should be overwritten
+	res.UpdateOption(dhcpv4.OptRouter(net.IP{10, 0, 0, 254}))
+
+	assert.NoError(t, static.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "10.0.0.1", res.YourIPAddr.String())
+	assert.Equal(t, time.Hour, res.IPAddressLeaseTime(0))
+	assert.Equal(t, []net.IP{{10, 0, 0, 2}}, res.Router())
+	// hostname has not been requested
+	assert.Empty(t, res.HostName())
+
+	// other clients must not be affected
+	req, _ = dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xff}, dhcpv4.WithRequestedOptions(dhcpv4.OptionRouter))
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	assert.Error(t, static.ServeDHCP(context.Background(), req, res))
+}
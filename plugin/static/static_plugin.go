@@ -2,21 +2,66 @@ package static
 
 import (
 	"context"
+	"math"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
 	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
 	"github.com/nextdhcp/nextdhcp/core/log"
 	"github.com/nextdhcp/nextdhcp/plugin"
 )
 
+// InfiniteLease is the LeaseTime of hosts whose lease never expires
+const InfiniteLease = time.Duration(math.MaxUint32) * time.Second
+
+// Host holds client specific configuration for a static
+// IP address assignment
+type Host struct {
+	// Hostname is the hostname assigned to the client. It's
+	// also part of Options
+	Hostname string
+
+	// LeaseTime is the lease time for the client. If zero,
+	// the lease time configured for the subnet is used
+	LeaseTime time.Duration
+
+	// Options holds DHCP options for the client. They override
+	// options configured for the subnet
+	Options map[dhcpv4.OptionCode]dhcpv4.OptionValue
+
+	// Classes restricts the assignment to members of client
+	// classes. If empty, the assignment is used for any client
+	Classes class.Set
+}
+
 // Plugin allows assignment of static IP addresses to clients
-// based on the MAC address. It implements plugin.Handler
+// based on the MAC address, client identifier, DUID, relay agent
+// information or hostname. It implements plugin.Handler
 type Plugin struct {
-	Config    *dhcpserver.Config
-	Next      plugin.Handler
+	Config *dhcpserver.Config
+	Next   plugin.Handler
+	L      log.Logger
+
+	// Addresses and Hosts are replaced as a whole when static
+	// assignment files are reloaded. Access them using snapshot
 	Addresses map[string]net.IP
-	L         log.Logger
+	Hosts     map[string]*Host
+
+	rw sync.RWMutex
+
+	// inline holds the assignments from the Dhcpfile and files
+	// the external files they are merged with
+	inline []entry
+	files  []*fileSource
+
+	reloadLock sync.Mutex
+	stop       chan struct{}
+	wg         sync.WaitGroup
 }
 
 // Name returns "static" and implements plugin.Handler
@@ -24,11 +69,25 @@ func (s *Plugin) Name() string {
 	return "static"
 }
 
-// ServeDHCP serves a DHCP request and implements plugin.Handler. If the requesting MAC
-// address of the client is configured a static IP lease will be sent
+// ServeDHCP serves a DHCP request and implements plugin.Handler. If the requesting
+// client is configured a static IP lease will be sent
 func (s *Plugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
-	static, hasStatic := s.Addresses[req.ClientHWAddr.String()]
-	if (dhcpserver.Discover(req) || dhcpserver.Request(req)) && hasStatic {
+	addresses, hosts := s.snapshot()
+
+	key, static, hasStatic := lookup(addresses, req)
+	if !hasStatic {
+		return s.Next.ServeDHCP(ctx, req, res)
+	}
+
+	l := log.With(ctx, s.L)
+
+	if host := hosts[key]; host != nil && !host.Classes.Match(ctx) {
+		l.Debugf("%s: ignoring static IP %s, client is not a member of %v", req.ClientHWAddr, static, host.Classes)
+		return s.Next.ServeDHCP(ctx, req, res)
+	}
+
+	switch {
+	case dhcpserver.Discover(req) || dhcpserver.Request(req):
 		// Make sure to deny a DHCPREQUEST for a different IP address
 		// for DHCPDISCOVER we can safely ignore the RequestedIPAddress field by RFC
 		if dhcpserver.Request(req) {
@@ -47,17 +106,88 @@ func (s *Plugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
 			res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
 		}
 
-		// TODO(ppacher): should we allow configuration of leaseTime or client specific options here?
 		res.YourIPAddr = static
 
 		// TODO(ppacher): we may remove this and make setting the subnet mask a default action of dhcpserver.Server
 		if req.IsOptionRequested(dhcpv4.OptionSubnetMask) {
-			req.UpdateOption(dhcpv4.OptSubnetMask(s.Config.Network.Mask))
+			res.UpdateOption(dhcpv4.OptSubnetMask(s.Config.Network.Mask))
 		}
 
+		applyHost(hosts[key], req, res)
+
 		s.L.Infof("%s: serving static IP %s (%s)", req.ClientHWAddr, res.YourIPAddr, req.MessageType())
 		return nil
+
+	case dhcpserver.Release(req) && req.ClientIPAddr.Equal(static):
+		// static assignments are never released so there's nothing
+		// to do. No response should be sent for DHCPRELEASE messages
+		l.Debugf("%s: ignoring release of static IP %s", req.ClientHWAddr, static)
+		return dhcpserver.ErrNoResponse
+
+	case dhcpserver.Decline(req) && req.RequestedIPAddress().Equal(static):
+		// the client detected that its static IP address is
+		// already used by a different host
+		l.Errorf("%s: static IP %s declined by %s, the address is already in use by a different host", req.ClientHWAddr, static, key)
+
+		events.EmitLeaseEvent(events.EventAddressConflict, &lease.Lease{
+			Client:  client(key, hosts[key]),
+			Address: static,
+			Expires: lease.Never,
+		})
+
+		return dhcpserver.ErrNoResponse
+
+	case dhcpserver.Inform(req) && req.ClientIPAddr.Equal(static):
+		// the client already has its IP address configured and
+		// only asks for options. A DHCPACK for DHCPINFORM must
+		// not contain a lease time (RFC 2131)
+		applyHost(hosts[key], req, res)
+		res.Options.Del(dhcpv4.OptionIPAddressLeaseTime)
+		res.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeAck))
+
+		s.L.Infof("%s: serving options for static IP %s (%s)", req.ClientHWAddr, static, req.MessageType())
+		return nil
 	}
 
 	return s.Next.ServeDHCP(ctx, req, res)
 }
+
+// lookup returns the key and the static IP address for req. If the client
+// matches multiple static assignments the first one in the order of
+// keyPrecedence is used
+func lookup(addresses map[string]net.IP, req *dhcpv4.DHCPv4) (string, net.IP, bool) {
+	for _, key := range requestKeys(req) {
+		if ip, ok := addresses[key]; ok {
+			return key, ip, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// snapshot returns the current static assignments. The returned maps must
+// not be modified
+func (s *Plugin) snapshot() (map[string]net.IP, map[string]*Host) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	return s.Addresses, s.Hosts
+}
+
+// applyHost adds the lease time and client specific options of the requesting
+// client. Options are only added if requested by the client
+func applyHost(host *Host, req, res *dhcpv4.DHCPv4) {
+	if host == nil {
+		return
+	}
+
+	if host.LeaseTime > 0 {
+		res.UpdateOption(dhcpv4.OptIPAddressLeaseTime(host.LeaseTime))
+	}
+
+	for code, value := range host.Options {
+		if req.IsOptionRequested(code) {
+			res.UpdateOption(dhcpv4.OptGeneric(code, value.ToBytes()))
+		}
+	}
+}
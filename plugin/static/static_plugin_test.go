@@ -0,0 +1,107 @@
+package static
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticPluginReleaseDeclineInform(t *testing.T) {
+	var conflicts []*lease.Lease
+	events.RegisterLeaseEventHook("static-test-conflict", events.EventAddressConflict, func(_ caddy.EventName, l *lease.Lease) error {
+		conflicts = append(conflicts, l)
+		return nil
+	})
+
+	c := caddy.NewTestController("dhcpv4", "static 00:aa:bb:cc:dd:ee 10.0.0.1 {\nhostname printer\nlease 1h\noption router 10.0.0.2\n}")
+	plg, err := makeStaticPlugin(c)
+	require.NoError(t, err)
+	plg.Config = &dhcpserver.Config{}
+
+	nextCalled := false
+	plg.Next = test.HandlerFunc(func(_ context.Context, req, res *dhcpv4.DHCPv4) error {
+		nextCalled = true
+		return nil
+	})
+
+	hwaddr := net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	serve := func(typ dhcpv4.MessageType, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, error) {
+		nextCalled = false
+		modifiers = append([]dhcpv4.Modifier{
+			dhcpv4.WithHwAddr(hwaddr),
+			dhcpv4.WithMessageType(typ),
+		}, modifiers...)
+
+		req, err := dhcpv4.New(modifiers...)
+		require.NoError(t, err)
+		res, _ := dhcpv4.NewReplyFromRequest(req)
+		return res, plg.ServeDHCP(context.Background(), req, res)
+	}
+
+	// DHCPRELEASE is silently ignored
+	_, err = serve(dhcpv4.MessageTypeRelease, dhcpv4.WithClientIP(net.IP{10, 0, 0, 1}))
+	assert.Equal(t, dhcpserver.ErrNoResponse, err)
+	assert.False(t, nextCalled)
+
+	// DHCPRELEASE for a different IP address is passed on
+	_, err = serve(dhcpv4.MessageTypeRelease, dhcpv4.WithClientIP(net.IP{10, 0, 0, 100}))
+	assert.NoError(t, err)
+	assert.True(t, nextCalled)
+
+	// DHCPDECLINE emits a conflict
+	_, err = serve(dhcpv4.MessageTypeDecline, dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(net.IP{10, 0, 0, 1})))
+	assert.Equal(t, dhcpserver.ErrNoResponse, err)
+	assert.False(t, nextCalled)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "10.0.0.1", conflicts[0].Address.String())
+	assert.Equal(t, "printer", conflicts[0].Hostname)
+	assert.Equal(t, hwaddr.String(), conflicts[0].HwAddr.String())
+
+	// DHCPINFORM gets the host options but no lease time
+	res, err := serve(dhcpv4.MessageTypeInform,
+		dhcpv4.WithClientIP(net.IP{10, 0, 0, 1}),
+		dhcpv4.WithRequestedOptions(dhcpv4.OptionRouter, dhcpv4.OptionHostName),
+	)
+	assert.NoError(t, err)
+	assert.False(t, nextCalled)
+	assert.Equal(t, dhcpv4.MessageTypeAck, res.MessageType())
+	assert.Equal(t, []net.IP{{10, 0, 0, 2}}, res.Router())
+	assert.Equal(t, "printer", res.HostName())
+	assert.Equal(t, time.Duration(0), res.IPAddressLeaseTime(0))
+	assert.True(t, res.YourIPAddr.IsUnspecified())
+}
+
+func TestStaticPluginClasses(t *testing.T) {
+	c := test.CreateTestBed(t, "static hostname printer 10.0.0.1 {\nclass trusted\n}")
+	dhcpserver.GetConfig(c).Classes = []string{"trusted"}
+	plg, err := makeStaticPlugin(c)
+	require.NoError(t, err)
+	plg.Next = test.ErrorHandler
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee})
+	req.UpdateOption(dhcpv4.OptHostName("printer"))
+
+	// the assignment is ignored for clients that are not members of the class
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+	assert.Error(t, plg.ServeDHCP(context.Background(), req, res))
+
+	ctx := class.WithClasses(context.Background(), []string{"trusted"})
+	res, _ = dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, plg.ServeDHCP(ctx, req, res))
+	assert.Equal(t, "10.0.0.1", res.YourIPAddr.String())
+
+	c = test.CreateTestBed(t, "static hostname printer 10.0.0.1 {\nclass unknown\n}")
+	_, err = makeStaticPlugin(c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,456 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextdhcp/nextdhcp/core/log"
+)
+
+// TFTP opcodes as defined in RFC 1350 and RFC 2347
+const (
+	opRRQ   uint16 = 1
+	opWRQ   uint16 = 2
+	opDATA  uint16 = 3
+	opACK   uint16 = 4
+	opERROR uint16 = 5
+	opOACK  uint16 = 6
+)
+
+// TFTP error codes as defined in RFC 1350 and RFC 2347
+const (
+	errNotDefined      uint16 = 0
+	errFileNotFound    uint16 = 1
+	errAccessViolation uint16 = 2
+	errIllegalOp       uint16 = 4
+	errUnknownTID      uint16 = 5
+	errOptionRefused   uint16 = 8
+)
+
+const (
+	// defaultBlockSize is the block size defined by RFC 1350
+	defaultBlockSize = 512
+
+	// minBlockSize and maxBlockSize are the limits for the
+	// blksize option as defined in RFC 2348
+	minBlockSize = 8
+	maxBlockSize = 65464
+
+	// defaultTimeout is the retransmission timeout used if the client
+	// did not negotiate one using the timeout option (RFC 2349)
+	defaultTimeout = 3 * time.Second
+
+	// defaultRetries is the number of times a packet is retransmitted
+	// before a transfer is aborted
+	defaultRetries = 5
+)
+
+// Server is a read-only TFTP server that serves files from
+// a root directory. It supports the blksize (RFC 2348) as well as
+// the timeout and tsize (RFC 2349) options
+type Server struct {
+	// Root is the directory to serve files from
+	Root string
+
+	// Timeout is the retransmission timeout for DATA packets.
+	// Defaults to 3 seconds
+	Timeout time.Duration
+
+	// Retries is the number of retransmissions before a transfer
+	// is aborted. Defaults to 5
+	Retries int
+
+	// L is the logger to use
+	L log.Logger
+
+	l    sync.Mutex
+	conn net.PacketConn
+	wg   sync.WaitGroup
+}
+
+// ListenAndServe starts listening on addr and serves TFTP
+// read requests in a dedicated goroutine. Use Close to stop
+// the server
+func (s *Server) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	s.conn = conn
+	s.l.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serve(conn)
+	}()
+
+	return nil
+}
+
+// Addr returns the local address the server is listening on or
+// nil if the server has not been started
+func (s *Server) Addr() net.Addr {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.LocalAddr()
+}
+
+// Close stops the server and waits for all pending transfers
+// to finish
+func (s *Server) Close() error {
+	s.l.Lock()
+	conn := s.conn
+	s.conn = nil
+	s.l.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	err := conn.Close()
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) serve(conn net.PacketConn) {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				continue
+			}
+
+			return
+		}
+
+		if n < 2 {
+			continue
+		}
+
+		packet := append([]byte{}, buf[:n]...)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleRequest(conn, packet, addr)
+		}()
+	}
+}
+
+// request is a parsed TFTP read or write request
+type request struct {
+	opcode   uint16
+	filename string
+	mode     string
+	options  map[string]string
+}
+
+func parseRequest(packet []byte) (*request, error) {
+	if len(packet) < 2 {
+		return nil, errors.New("packet too short")
+	}
+
+	req := &request{
+		opcode:  binary.BigEndian.Uint16(packet),
+		options: make(map[string]string),
+	}
+
+	fields := bytes.Split(packet[2:], []byte{0})
+	// a well-formed request is terminated by a zero byte so
+	// the last field must be empty
+	if len(fields) < 3 || len(fields[len(fields)-1]) != 0 {
+		return nil, errors.New("malformed request")
+	}
+	fields = fields[:len(fields)-1]
+
+	req.filename = string(fields[0])
+	req.mode = strings.ToLower(string(fields[1]))
+
+	opts := fields[2:]
+	if len(opts)%2 != 0 {
+		return nil, errors.New("malformed options")
+	}
+
+	for i := 0; i < len(opts); i += 2 {
+		req.options[strings.ToLower(string(opts[i]))] = string(opts[i+1])
+	}
+
+	return req, nil
+}
+
+func (s *Server) handleRequest(conn net.PacketConn, packet []byte, addr net.Addr) {
+	req, err := parseRequest(packet)
+	if err != nil {
+		s.L.Debugf("tftp: dropping invalid request from %s: %s", addr, err)
+		return
+	}
+
+	// Each transfer uses it's own transfer identifier (TID) so we need
+	// a new socket on the same local IP
+	local := conn.LocalAddr().(*net.UDPAddr)
+	tconn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: local.IP})
+	if err != nil {
+		s.L.Errorf("tftp: failed to create transfer socket for %s: %s", addr, err)
+		return
+	}
+	defer tconn.Close()
+
+	switch req.opcode {
+	case opRRQ:
+		s.handleRead(tconn, req, addr)
+	case opWRQ:
+		s.L.Warnf("tftp: denied write request for %q from %s", req.filename, addr)
+		sendError(tconn, addr, errAccessViolation, "server is read-only")
+	default:
+		sendError(tconn, addr, errIllegalOp, "illegal TFTP operation")
+	}
+}
+
+// open opens name inside the server root. Files are opened through
+// os.OpenInRoot so neither ".." nor symbolic links can escape the
+// root directory
+func (s *Server) open(name string) (*os.File, error) {
+	name = filepath.FromSlash(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimPrefix(filepath.Clean(string(filepath.Separator)+name), string(filepath.Separator))
+	if name == "" {
+		name = "."
+	}
+
+	return os.OpenInRoot(s.Root, name)
+}
+
+func (s *Server) handleRead(conn *net.UDPConn, req *request, addr net.Addr) {
+	// netascii transfers are served unmodified. Boot files are binary
+	// anyway and clients hardly ever request netascii mode
+	if req.mode != "octet" && req.mode != "netascii" {
+		sendError(conn, addr, errIllegalOp, fmt.Sprintf("unsupported transfer mode %q", req.mode))
+		return
+	}
+
+	f, err := s.open(req.filename)
+	if err != nil {
+		s.L.Warnf("tftp: %s requested %q: %s", addr, req.filename, err)
+		if os.IsNotExist(err) {
+			sendError(conn, addr, errFileNotFound, "file not found")
+		} else {
+			sendError(conn, addr, errAccessViolation, "access violation")
+		}
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		s.L.Warnf("tftp: %s requested %q which is not a regular file", addr, req.filename)
+		sendError(conn, addr, errFileNotFound, "file not found")
+		return
+	}
+
+	t := &transfer{
+		conn:      conn,
+		peer:      addr,
+		blockSize: defaultBlockSize,
+		timeout:   s.Timeout,
+		retries:   s.Retries,
+	}
+	if t.timeout == 0 {
+		t.timeout = defaultTimeout
+	}
+	if t.retries == 0 {
+		t.retries = defaultRetries
+	}
+
+	oack, err := t.negotiate(req.options, stat.Size())
+	if err != nil {
+		sendError(conn, addr, errOptionRefused, err.Error())
+		return
+	}
+
+	s.L.Infof("tftp: sending %q to %s (%d bytes, blksize %d)", req.filename, addr, stat.Size(), t.blockSize)
+	start := time.Now()
+
+	if len(oack) > 0 {
+		if err := t.sendOptionAck(oack); err != nil {
+			s.L.Warnf("tftp: transfer of %q to %s failed: %s", req.filename, addr, err)
+			return
+		}
+	}
+
+	if err := t.sendFile(f); err != nil {
+		s.L.Warnf("tftp: transfer of %q to %s failed: %s", req.filename, addr, err)
+		return
+	}
+
+	s.L.Infof("tftp: sent %q to %s in %s", req.filename, addr, time.Since(start))
+}
+
+// transfer holds the state of a single read transfer
+type transfer struct {
+	conn      *net.UDPConn
+	peer      net.Addr
+	blockSize int
+	timeout   time.Duration
+	retries   int
+}
+
+// negotiate applies the options requested by the client and returns
+// the option values that should be acknowledged. Unknown options are
+// ignored as required by RFC 2347
+func (t *transfer) negotiate(options map[string]string, size int64) ([][2]string, error) {
+	var oack [][2]string
+
+	if val, ok := options["blksize"]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < minBlockSize {
+			return nil, fmt.Errorf("invalid blksize %q", val)
+		}
+		if n > maxBlockSize {
+			n = maxBlockSize
+		}
+		t.blockSize = n
+		oack = append(oack, [2]string{"blksize", strconv.Itoa(n)})
+	}
+
+	if val, ok := options["timeout"]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > 255 {
+			return nil, fmt.Errorf("invalid timeout %q", val)
+		}
+		t.timeout = time.Duration(n) * time.Second
+		oack = append(oack, [2]string{"timeout", val})
+	}
+
+	if _, ok := options["tsize"]; ok {
+		oack = append(oack, [2]string{"tsize", strconv.FormatInt(size, 10)})
+	}
+
+	return oack, nil
+}
+
+// sendOptionAck sends the OACK packet and waits for the client to
+// acknowledge it with an ACK for block 0
+func (t *transfer) sendOptionAck(oack [][2]string) error {
+	packet := make([]byte, 2, 64)
+	binary.BigEndian.PutUint16(packet, opOACK)
+	for _, o := range oack {
+		packet = append(packet, o[0]...)
+		packet = append(packet, 0)
+		packet = append(packet, o[1]...)
+		packet = append(packet, 0)
+	}
+
+	return t.sendAndWait(packet, 0)
+}
+
+func (t *transfer) sendFile(r io.Reader) error {
+	packet := make([]byte, 4+t.blockSize)
+	binary.BigEndian.PutUint16(packet, opDATA)
+
+	// block numbers wrap around for large files
+	var block uint16 = 1
+	for {
+		n, err := io.ReadFull(r, packet[4:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			sendError(t.conn, t.peer, errNotDefined, "read error")
+			return err
+		}
+
+		binary.BigEndian.PutUint16(packet[2:], block)
+		if err := t.sendAndWait(packet[:4+n], block); err != nil {
+			return err
+		}
+
+		// a DATA packet with less than blockSize bytes terminates
+		// the transfer
+		if n < t.blockSize {
+			return nil
+		}
+
+		block++
+	}
+}
+
+// sendAndWait sends packet and waits for an ACK of block. The packet is
+// retransmitted if no acknowledgement is received within the transfer
+// timeout
+func (t *transfer) sendAndWait(packet []byte, block uint16) error {
+	buf := make([]byte, 516)
+
+	for try := 0; try <= t.retries; try++ {
+		if _, err := t.conn.WriteTo(packet, t.peer); err != nil {
+			return err
+		}
+
+		deadline := time.Now().Add(t.timeout)
+		for {
+			if err := t.conn.SetReadDeadline(deadline); err != nil {
+				return err
+			}
+
+			n, addr, err := t.conn.ReadFrom(buf)
+			if err != nil {
+				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+					break
+				}
+				return err
+			}
+
+			if addr.String() != t.peer.String() {
+				// RFC 1350: packets from unknown TIDs are answered with an error
+				// but must not disturb the current transfer
+				sendError(t.conn, addr, errUnknownTID, "unknown transfer ID")
+				continue
+			}
+
+			if n < 4 {
+				continue
+			}
+
+			switch binary.BigEndian.Uint16(buf) {
+			case opACK:
+				if binary.BigEndian.Uint16(buf[2:]) == block {
+					return nil
+				}
+				// duplicate ACKs for previous blocks are ignored to avoid
+				// the sorcerer's apprentice syndrome
+			case opERROR:
+				msg := string(bytes.TrimRight(buf[4:n], "\x00"))
+				return fmt.Errorf("client aborted transfer: %s", msg)
+			default:
+				sendError(t.conn, t.peer, errIllegalOp, "illegal TFTP operation")
+				return errors.New("unexpected packet from client")
+			}
+		}
+	}
+
+	return fmt.Errorf("timeout waiting for ACK of block %d", block)
+}
+
+func sendError(conn net.PacketConn, addr net.Addr, code uint16, msg string) {
+	packet := make([]byte, 4, 5+len(msg))
+	binary.BigEndian.PutUint16(packet, opERROR)
+	binary.BigEndian.PutUint16(packet[2:], code)
+	packet = append(packet, msg...)
+	packet = append(packet, 0)
+
+	_, _ = conn.WriteTo(packet, addr)
+}
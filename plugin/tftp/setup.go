@@ -0,0 +1,141 @@
+package tftp
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+func init() {
+	caddy.RegisterPlugin("tftp", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupTFTP,
+	})
+}
+
+func setupTFTP(c *caddy.Controller) error {
+	plg, port, err := makeTFTPPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(plg.ip.String(), strconv.Itoa(port))
+
+	start := func() error {
+		if err := plg.srv.ListenAndServe(addr); err != nil {
+			return fmt.Errorf("failed to start TFTP server on %s: %s", addr, err.Error())
+		}
+		plg.srv.L.Infof("serving %s via TFTP on %s", plg.srv.Root, addr)
+		return nil
+	}
+
+	stop := func() error {
+		return plg.srv.Close()
+	}
+
+	// The new instance is started before the old one is shut down
+	// during restarts so we need to release the listener in OnRestart
+	c.OnStartup(start)
+	c.OnRestart(stop)
+	c.OnRestartFailed(start)
+	c.OnFinalShutdown(stop)
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	return nil
+}
+
+func makeTFTPPlugin(c *caddy.Controller) (*tftpPlugin, int, error) {
+	cfg := dhcpserver.GetConfig(c)
+
+	plg := &tftpPlugin{
+		ip:  cfg.IP,
+		srv: &Server{},
+	}
+	plg.srv.L = log.GetLogger(c, plg)
+
+	port := 69
+	seen := false
+
+	for c.Next() {
+		if seen {
+			return nil, 0, c.Err("tftp can only be configured once per subnet")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return nil, 0, c.ArgErr()
+		}
+		if len(args) == 1 {
+			plg.srv.Root = args[0]
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "root":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				plg.srv.Root = c.Val()
+			case "port":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				p, err := strconv.ParseUint(c.Val(), 10, 16)
+				if err != nil {
+					return nil, 0, c.SyntaxErr("port number")
+				}
+				port = int(p)
+			case "timeout":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d <= 0 {
+					return nil, 0, c.SyntaxErr("time.Duration")
+				}
+				plg.srv.Timeout = d
+			case "retries":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 1 {
+					return nil, 0, c.SyntaxErr("positive number")
+				}
+				plg.srv.Retries = n
+			default:
+				return nil, 0, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, 0, c.ArgErr()
+			}
+		}
+	}
+
+	if plg.srv.Root == "" {
+		return nil, 0, c.Err("tftp: root directory required")
+	}
+
+	stat, err := os.Stat(plg.srv.Root)
+	if err != nil {
+		return nil, 0, c.Errf("tftp: %s", err.Error())
+	}
+	if !stat.IsDir() {
+		return nil, 0, c.Errf("tftp: %s is not a directory", plg.srv.Root)
+	}
+
+	return plg, port, nil
+}
@@ -0,0 +1,35 @@
+package tftp
+
+import (
+	"context"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+// tftpPlugin advertises the built-in TFTP server as the next-server
+// to DHCP clients. It implements plugin.Handler
+type tftpPlugin struct {
+	next plugin.Handler
+	ip   net.IP
+	srv  *Server
+}
+
+// Name returns "tftp" and implements plugin.Handler
+func (*tftpPlugin) Name() string {
+	return "tftp"
+}
+
+// ServeDHCP sets the next-server address to the IP of the TFTP server and
+// implements plugin.Handler. An explicitly configured next-server directive
+// still takes precedence as it is executed later in the chain
+func (p *tftpPlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	res.ServerIPAddr = p.ip
+
+	if req.IsOptionRequested(dhcpv4.OptionTFTPServerName) && res.GetOneOption(dhcpv4.OptionTFTPServerName) == nil {
+		res.UpdateOption(dhcpv4.OptTFTPServerName(p.ip.String()))
+	}
+
+	return p.next.ServeDHCP(ctx, req, res)
+}
@@ -0,0 +1,201 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFile is a minimal TFTP client used to test the server
+func readFile(t *testing.T, srv net.Addr, name string, opts ...string) ([]byte, map[string]string, error) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	rrq := []byte{0, byte(opRRQ)}
+	for _, f := range append([]string{name, "octet"}, opts...) {
+		rrq = append(rrq, f...)
+		rrq = append(rrq, 0)
+	}
+	_, err = conn.WriteTo(rrq, srv)
+	require.NoError(t, err)
+
+	var (
+		data    []byte
+		oack    = make(map[string]string)
+		buf     = make([]byte, 65536)
+		expect  = uint16(1)
+		blksize = defaultBlockSize
+	)
+
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch binary.BigEndian.Uint16(buf) {
+		case opERROR:
+			return nil, nil, &net.AddrError{Err: string(bytes.TrimRight(buf[4:n], "\x00"))}
+		case opOACK:
+			fields := bytes.Split(buf[2:n-1], []byte{0})
+			for i := 0; i+1 < len(fields); i += 2 {
+				oack[string(fields[i])] = string(fields[i+1])
+			}
+			if v, ok := oack["blksize"]; ok {
+				blksize = 0
+				for _, c := range v {
+					blksize = blksize*10 + int(c-'0')
+				}
+			}
+			_, err = conn.WriteTo([]byte{0, byte(opACK), 0, 0}, peer)
+			require.NoError(t, err)
+		case opDATA:
+			block := binary.BigEndian.Uint16(buf[2:])
+			ack := []byte{0, byte(opACK), 0, 0}
+			binary.BigEndian.PutUint16(ack[2:], block)
+			_, err = conn.WriteTo(ack, peer)
+			require.NoError(t, err)
+
+			if block != expect {
+				continue
+			}
+			expect++
+
+			data = append(data, buf[4:n]...)
+			if n-4 < blksize {
+				return data, oack, nil
+			}
+		}
+	}
+}
+
+func TestTFTPSetup(t *testing.T) {
+	dir := t.TempDir()
+
+	c := test.CreateTestBed(t, "tftp "+dir)
+	plg, port, err := makeTFTPPlugin(c)
+	require.NoError(t, err)
+	assert.Equal(t, dir, plg.srv.Root)
+	assert.Equal(t, 69, port)
+	assert.Equal(t, "127.0.0.1", plg.ip.String())
+
+	c = test.CreateTestBed(t, "tftp {\nroot "+dir+"\nport 6969\ntimeout 1s\nretries 2\n}")
+	plg, port, err = makeTFTPPlugin(c)
+	require.NoError(t, err)
+	assert.Equal(t, dir, plg.srv.Root)
+	assert.Equal(t, 6969, port)
+	assert.Equal(t, time.Second, plg.srv.Timeout)
+	assert.Equal(t, 2, plg.srv.Retries)
+
+	for _, input := range []string{
+		"tftp",
+		"tftp " + filepath.Join(dir, "does-not-exist"),
+		"tftp " + dir + " foo",
+		"tftp " + dir + " {\nport foo\n}",
+		"tftp " + dir + " {\nunknown\n}",
+		"tftp " + dir + "\ntftp " + dir,
+	} {
+		c = test.CreateTestBed(t, input)
+		_, _, err = makeTFTPPlugin(c)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestTFTPServeDHCP(t *testing.T) {
+	plg := &tftpPlugin{
+		next: test.NoOpHandler,
+		ip:   net.IP{10, 0, 0, 1},
+	}
+
+	req, _ := dhcpv4.NewDiscovery(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, dhcpv4.WithRequestedOptions(dhcpv4.OptionTFTPServerName))
+	res, _ := dhcpv4.NewReplyFromRequest(req)
+
+	assert.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Equal(t, "10.0.0.1", res.ServerIPAddr.String())
+	assert.Equal(t, "10.0.0.1", res.TFTPServerName())
+}
+
+func TestTFTPServer(t *testing.T) {
+	dir := t.TempDir()
+
+	small := []byte("#!ipxe\nchain http://boot/menu.ipxe\n")
+	large := make([]byte, 512*3)
+	for i := range large {
+		large[i] = byte(i)
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "boot.ipxe"), small, 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pxelinux"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pxelinux", "kernel"), large, 0o644))
+
+	outside := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "escape")))
+	require.NoError(t, os.Symlink("boot.ipxe", filepath.Join(dir, "default.ipxe")))
+
+	srv := &Server{
+		Root:    dir,
+		Timeout: 500 * time.Millisecond,
+		Retries: 1,
+		L:       log.Log,
+	}
+	require.NoError(t, srv.ListenAndServe("127.0.0.1:0"))
+	defer srv.Close()
+
+	t.Run("plain", func(t *testing.T) {
+		data, oack, err := readFile(t, srv.Addr(), "boot.ipxe")
+		require.NoError(t, err)
+		assert.Equal(t, small, data)
+		assert.Empty(t, oack)
+	})
+
+	t.Run("multiple of block size", func(t *testing.T) {
+		data, _, err := readFile(t, srv.Addr(), "/pxelinux/kernel")
+		require.NoError(t, err)
+		assert.Equal(t, large, data)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		data, oack, err := readFile(t, srv.Addr(), "pxelinux/kernel", "blksize", "1000", "tsize", "0", "unknown", "1")
+		require.NoError(t, err)
+		assert.Equal(t, large, data)
+		assert.Equal(t, map[string]string{"blksize": "1000", "tsize": "1536"}, oack)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, _, err := readFile(t, srv.Addr(), "missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("outside of root", func(t *testing.T) {
+		_, _, err := readFile(t, srv.Addr(), "../../../../etc/passwd")
+		assert.Error(t, err)
+	})
+
+	t.Run("symlinks", func(t *testing.T) {
+		data, _, err := readFile(t, srv.Addr(), "default.ipxe")
+		require.NoError(t, err)
+		assert.Equal(t, small, data)
+
+		_, _, err = readFile(t, srv.Addr(), "escape")
+		assert.Error(t, err)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		_, _, err := readFile(t, srv.Addr(), "pxelinux")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,328 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextdhcp/nextdhcp/core/log"
+)
+
+// maxQueueSize is the maximum number of deliveries kept per webhook.
+// If the queue is full the oldest delivery is dropped
+const maxQueueSize = 10000
+
+type (
+	// delivery is a single webhook request waiting to be sent
+	delivery struct {
+		ID       string      `json:"id"`
+		URL      string      `json:"url"`
+		Header   http.Header `json:"header,omitempty"`
+		Body     string      `json:"body"`
+		Attempts int         `json:"attempts"`
+		Next     time.Time   `json:"next"`
+	}
+
+	// permanentError is returned by a send function if a delivery
+	// must not be retried
+	permanentError struct {
+		err error
+	}
+
+	// queue sends deliveries in the background and retries failed ones
+	// with an exponential backoff. If dir is set all pending deliveries
+	// are stored on disk so they survive restarts
+	queue struct {
+		dir        string
+		retries    int
+		backoff    time.Duration
+		maxBackoff time.Duration
+		send       func(*delivery) error
+		l          log.Logger
+
+		mu      sync.Mutex
+		pending []*delivery
+		seq     uint64
+
+		wake chan struct{}
+		stop chan struct{}
+		done chan struct{}
+	}
+)
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Start loads all deliveries stored on disk and starts sending
+func (q *queue) Start() error {
+	if q.dir != "" {
+		if err := os.MkdirAll(q.dir, 0o700); err != nil {
+			return err
+		}
+
+		if err := q.load(); err != nil {
+			return err
+		}
+	}
+
+	q.wake = make(chan struct{}, 1)
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+
+	go q.run()
+
+	return nil
+}
+
+// Stop stops sending deliveries and waits for the current one to
+// finish. Deliveries that are not stored on disk are lost
+func (q *queue) Stop() {
+	if q.done == nil {
+		return
+	}
+
+	close(q.stop)
+	<-q.done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.dir == "" && len(q.pending) > 0 {
+		q.l.Warnf("dropping %d pending deliveries", len(q.pending))
+	}
+}
+
+// Push adds d to the queue and wakes up the sender
+func (q *queue) Push(d *delivery) {
+	q.mu.Lock()
+	q.seq++
+	d.ID = fmt.Sprintf("%020d-%d", time.Now().UnixNano(), q.seq)
+
+	if len(q.pending) >= maxQueueSize {
+		q.l.Warnf("queue full, dropping delivery to %s", q.pending[0].URL)
+		q.remove(q.pending[0])
+	}
+
+	q.pending = append(q.pending, d)
+	q.persist(d)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of pending deliveries
+func (q *queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+
+	for {
+		wait := q.process()
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-q.stop:
+		case <-q.wake:
+		case <-timeout:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+	}
+}
+
+// process sends all deliveries that are due and returns the time to
+// wait for the next one. It returns a negative duration if the queue
+// is empty
+func (q *queue) process() time.Duration {
+	now := time.Now()
+
+	q.mu.Lock()
+	var due []*delivery
+	for _, d := range q.pending {
+		if !d.Next.After(now) {
+			due = append(due, d)
+		}
+	}
+	q.mu.Unlock()
+
+	for _, d := range due {
+		select {
+		case <-q.stop:
+			return -1
+		default:
+		}
+
+		err := q.send(d)
+
+		q.mu.Lock()
+		switch {
+		case err == nil:
+			q.remove(d)
+
+		case isPermanent(err):
+			q.l.Warnf("failed to deliver to %s: %s", d.URL, err.Error())
+			q.remove(d)
+
+		case d.Attempts >= q.retries:
+			q.l.Warnf("failed to deliver to %s after %d attempts: %s", d.URL, d.Attempts+1, err.Error())
+			q.remove(d)
+
+		default:
+			d.Attempts++
+			d.Next = time.Now().Add(q.delay(d.Attempts))
+			q.l.Debugf("failed to deliver to %s, retrying in %s: %s", d.URL, time.Until(d.Next).Round(time.Millisecond), err.Error())
+			q.persist(d)
+		}
+		q.mu.Unlock()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return -1
+	}
+
+	next := q.pending[0].Next
+	for _, d := range q.pending[1:] {
+		if d.Next.Before(next) {
+			next = d.Next
+		}
+	}
+
+	if wait := time.Until(next); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// delay returns the time to wait before the given attempt
+func (q *queue) delay(attempt int) time.Duration {
+	d := q.backoff
+	for i := 1; i < attempt && d < q.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > q.maxBackoff {
+		return q.maxBackoff
+	}
+	return d
+}
+
+// remove removes d from the queue. q.mu must be held
+func (q *queue) remove(d *delivery) {
+	for i, p := range q.pending {
+		if p == d {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+
+	if q.dir == "" {
+		return
+	}
+
+	if err := os.Remove(q.path(d)); err != nil && !os.IsNotExist(err) {
+		q.l.Warnf("failed to remove delivery %s: %s", d.ID, err.Error())
+	}
+}
+
+// persist writes d to disk. q.mu must be held
+func (q *queue) persist(d *delivery) {
+	if q.dir == "" {
+		return
+	}
+
+	blob, err := json.Marshal(d)
+	if err != nil {
+		q.l.Warnf("failed to encode delivery %s: %s", d.ID, err.Error())
+		return
+	}
+
+	// write to a temporary file first so we never load partial
+	// deliveries
+	tmp := q.path(d) + ".tmp"
+	if err := os.WriteFile(tmp, blob, 0o600); err != nil {
+		q.l.Warnf("failed to store delivery %s: %s", d.ID, err.Error())
+		return
+	}
+
+	if err := os.Rename(tmp, q.path(d)); err != nil {
+		q.l.Warnf("failed to store delivery %s: %s", d.ID, err.Error())
+	}
+}
+
+// load reads all deliveries stored in q.dir
+func (q *queue) load() error {
+	files, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	// file names start with the time the delivery has been created
+	sort.Strings(files)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, file := range files {
+		blob, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		d := new(delivery)
+		if err := json.Unmarshal(blob, d); err != nil || d.ID != strings.TrimSuffix(filepath.Base(file), ".json") {
+			q.l.Warnf("ignoring invalid delivery %s", file)
+			continue
+		}
+
+		q.pending = append(q.pending, d)
+	}
+
+	if len(q.pending) > 0 {
+		q.l.Infof("loaded %d pending deliveries from %s", len(q.pending), q.dir)
+	}
+
+	return nil
+}
+
+func (q *queue) path(d *delivery) string {
+	return filepath.Join(q.dir, d.ID+".json")
+}
+
+func isPermanent(err error) bool {
+	_, ok := err.(*permanentError)
+	return ok
+}
@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/utils/duration"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+const (
+	// defaultTimeout is the default time a single request may take
+	defaultTimeout = 5 * time.Second
+
+	// defaultRetries is the default number of retries for a
+	// failed delivery
+	defaultRetries = 5
+
+	// defaultBackoff is the default time to wait before the first retry
+	defaultBackoff = time.Second
+
+	// defaultMaxBackoff is the default maximum time between two retries
+	defaultMaxBackoff = 5 * time.Minute
+)
+
+// dirsKey is the key of the queue directories used by all webhook
+// directives of a server instance
+type dirsKey struct{}
+
+func init() {
+	caddy.RegisterPlugin("webhook", caddy.Plugin{
+		ServerType: "dhcpv4",
+		Action:     setupWebhook,
+	})
+}
+
+func setupWebhook(c *caddy.Controller) error {
+	plg, err := makeWebhookPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	dhcpserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		plg.next = next
+		return plg
+	})
+
+	var unsubscribe func()
+	c.OnStartup(func() error {
+		for _, h := range plg.hooks {
+			if err := h.queue.Start(); err != nil {
+				return err
+			}
+		}
+
+		unsubscribe = events.Subscribe(plg.handleEvent)
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+
+		for _, h := range plg.hooks {
+			h.queue.Stop()
+		}
+		return nil
+	})
+
+	return nil
+}
+
+func makeWebhookPlugin(c *caddy.Controller) (*webhookPlugin, error) {
+	plg := &webhookPlugin{}
+	plg.l = log.GetLogger(c, plg)
+
+	var classes []string
+	if cfg := dhcpserver.GetConfig(c); cfg != nil {
+		plg.network = cfg.Network
+		classes = cfg.Classes
+	}
+
+	// queue directories must not be shared between webhooks, not
+	// even between those of different subnets
+	dirs, _ := c.Get(dirsKey{}).(map[string]bool)
+	if dirs == nil {
+		dirs = make(map[string]bool)
+		c.Set(dirsKey{}, dirs)
+	}
+
+	for c.Next() {
+		cond, err := matcher.SetupMatcherRemainingArgs(c)
+		if err != nil {
+			return nil, err
+		}
+
+		h := &hook{
+			Matcher: cond,
+			events:  make(map[caddy.EventName]bool),
+			headers: make(http.Header),
+		}
+		q := &queue{
+			retries:    defaultRetries,
+			backoff:    defaultBackoff,
+			maxBackoff: defaultMaxBackoff,
+			send:       h.send,
+			l:          plg.l,
+		}
+		timeout := defaultTimeout
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "url":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				u, err := url.Parse(c.Val())
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return nil, c.Errf("invalid url %q", c.Val())
+				}
+				h.url = u.String()
+
+			case "on":
+				names := c.RemainingArgs()
+				if len(names) == 0 {
+					return nil, c.ArgErr()
+				}
+
+				for _, name := range names {
+					event := caddy.EventName(name)
+					if event != events.EventRequest && !events.IsLeaseEvent(event) {
+						return nil, c.Errf("unknown event %q", name)
+					}
+					h.events[event] = true
+				}
+
+			case "class":
+				h.classes, err = class.ParseSet(c, classes)
+				if err != nil {
+					return nil, err
+				}
+
+			case "header":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				h.headers.Add(args[0], args[1])
+				continue
+
+			case "body":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				h.body = c.Val()
+
+			case "secret":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				h.secret = []byte(c.Val())
+
+			case "timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				d, err := duration.Parse(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid timeout %q: %s", c.Val(), err.Error())
+				}
+				if d <= 0 {
+					return nil, c.Err("timeout must be positive")
+				}
+				timeout = d
+
+			case "retries":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 0 {
+					return nil, c.SyntaxErr("a non-negative number")
+				}
+				q.retries = n
+
+			case "backoff":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+
+				var values []time.Duration
+				for _, arg := range args {
+					d, err := duration.Parse(arg)
+					if err != nil {
+						return nil, c.Errf("invalid backoff %q: %s", arg, err.Error())
+					}
+					if d <= 0 {
+						return nil, c.Err("backoff must be positive")
+					}
+					values = append(values, d)
+				}
+
+				q.backoff = values[0]
+				if len(values) == 2 {
+					q.maxBackoff = values[1]
+				} else if q.backoff > q.maxBackoff {
+					q.maxBackoff = q.backoff
+				}
+				continue
+
+			case "queue":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+				dir, err := filepath.Abs(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid queue directory %q: %s", c.Val(), err.Error())
+				}
+				if dirs[dir] {
+					return nil, c.Errf("queue directory %q is already used", c.Val())
+				}
+				dirs[dir] = true
+				q.dir = dir
+
+			default:
+				return nil, c.ArgErr()
+			}
+
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+
+		if h.url == "" {
+			return nil, c.Err("url expected")
+		}
+
+		if q.maxBackoff < q.backoff {
+			return nil, c.Err("maximum backoff must not be lower than the initial backoff")
+		}
+
+		// notify about requests if no events are selected
+		if len(h.events) == 0 {
+			h.events[events.EventRequest] = true
+		}
+
+		h.client = &http.Client{Timeout: timeout}
+		h.queue = q
+		plg.hooks = append(plg.hooks, h)
+	}
+
+	return plg, nil
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy"
+	"github.com/caddyserver/caddy/caddyfile"
+	"github.com/nextdhcp/nextdhcp/core/dhcpserver"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSetup(t *testing.T) {
+	c := test.CreateTestBed(t, `
+	webhook msgtype == 'REQUEST' {
+		url https://example.com/hooks/dhcp
+		header Authorization "Bearer token"
+		header X-Client {hwaddr}
+		secret s3cr3t
+		timeout 2s
+		retries 3
+		backoff 2s 1m
+		queue /var/lib/nextdhcp/webhook
+	}
+	webhook {
+		url http://localhost:8080
+		on lease-created lease-expired
+		class voip
+		body "\{\"text\": \"{hwaddr} got {yourip}\"\}"
+	}
+	`)
+	dhcpserver.GetConfig(c).Classes = []string{"voip"}
+
+	plg, err := makeWebhookPlugin(c)
+	require.NoError(t, err)
+	require.Len(t, plg.hooks, 2)
+
+	h := plg.hooks[0]
+	assert.Equal(t, "https://example.com/hooks/dhcp", h.url)
+	assert.Equal(t, map[caddy.EventName]bool{events.EventRequest: true}, h.events)
+	assert.Equal(t, http.Header{
+		"Authorization": {"Bearer token"},
+		"X-Client":      {"{hwaddr}"},
+	}, h.headers)
+	assert.Equal(t, []byte("s3cr3t"), h.secret)
+	assert.Equal(t, 2*time.Second, h.client.Timeout)
+	assert.Equal(t, 3, h.queue.retries)
+	assert.Equal(t, 2*time.Second, h.queue.backoff)
+	assert.Equal(t, time.Minute, h.queue.maxBackoff)
+	assert.Equal(t, "/var/lib/nextdhcp/webhook", h.queue.dir)
+	assert.False(t, h.EmptyCondition())
+
+	h = plg.hooks[1]
+	assert.Equal(t, map[caddy.EventName]bool{
+		events.EventLeaseCreated: true,
+		events.EventLeaseExpired: true,
+	}, h.events)
+	assert.Equal(t, `\{"text": "{hwaddr} got {yourip}"\}`, h.body)
+	assert.Equal(t, defaultTimeout, h.client.Timeout)
+	assert.Equal(t, defaultRetries, h.queue.retries)
+	assert.Equal(t, defaultBackoff, h.queue.backoff)
+	assert.Equal(t, defaultMaxBackoff, h.queue.maxBackoff)
+	assert.Empty(t, h.queue.dir)
+	assert.Len(t, h.classes, 1)
+
+	for _, input := range []string{
+		"webhook",
+		"webhook {\nurl\n}",
+		"webhook {\nurl ftp://example.com\n}",
+		"webhook {\nurl example.com\n}",
+		"webhook {\nurl http://example.com\non\n}",
+		"webhook {\nurl http://example.com\non unknown-event\n}",
+		"webhook {\nurl http://example.com\nheader X-Foo\n}",
+		"webhook {\nurl http://example.com\ntimeout 0s\n}",
+		"webhook {\nurl http://example.com\nretries -1\n}",
+		"webhook {\nurl http://example.com\nbackoff\n}",
+		"webhook {\nurl http://example.com\nbackoff 1m 1s\n}",
+		"webhook {\nurl http://example.com\nclass unknown\n}",
+		"webhook {\nurl http://example.com\nunknown\n}",
+		"webhook {\nurl http://example.com\nqueue /tmp/q\n}\nwebhook {\nurl http://example.com\nqueue /tmp/q\n}",
+	} {
+		_, err := makeWebhookPlugin(test.CreateTestBed(t, input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestWebhookSharedQueue(t *testing.T) {
+	c := test.CreateTestBed(t, "webhook {\nurl http://example.com\nqueue /tmp/q\n}")
+	_, err := makeWebhookPlugin(c)
+	require.NoError(t, err)
+
+	// a different subnet of the same instance
+	c.Dispenser = caddyfile.NewDispenser("Testfile", strings.NewReader("webhook {\nurl http://example.org\nqueue /tmp/../tmp/q\n}"))
+	_, err = makeWebhookPlugin(c)
+	assert.Error(t, err)
+
+	c.Dispenser = caddyfile.NewDispenser("Testfile", strings.NewReader("webhook {\nurl http://example.org\nqueue /tmp/q2\n}"))
+	_, err = makeWebhookPlugin(c)
+	assert.NoError(t, err)
+
+	// new instances, for example after a restart, may use the directory again
+	_, err = makeWebhookPlugin(test.CreateTestBed(t, "webhook {\nurl http://example.com\nqueue /tmp/q\n}"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/class"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/core/log"
+	"github.com/nextdhcp/nextdhcp/core/matcher"
+	"github.com/nextdhcp/nextdhcp/core/replacer"
+	"github.com/nextdhcp/nextdhcp/plugin"
+)
+
+const (
+	// signatureHeader holds the HMAC-SHA256 signature of the body
+	// if a secret is configured
+	signatureHeader = "X-NextDHCP-Signature"
+
+	// eventHeader holds the name of the event
+	eventHeader = "X-NextDHCP-Event"
+)
+
+type (
+	// hook posts DHCP requests and lease events to a URL
+	hook struct {
+		*matcher.Matcher
+
+		url     string
+		events  map[caddy.EventName]bool
+		classes class.Set
+		headers http.Header
+		body    string
+		secret  []byte
+		client  *http.Client
+		queue   *queue
+	}
+
+	// webhookPlugin notifies webhooks after the request has been
+	// handled by the rest of the chain. It implements plugin.Handler
+	webhookPlugin struct {
+		next    plugin.Handler
+		hooks   []*hook
+		network net.IPNet
+		l       log.Logger
+	}
+)
+
+// Name returns "webhook" and implements plugin.Handler
+func (w *webhookPlugin) Name() string {
+	return "webhook"
+}
+
+// ServeDHCP queues a notification for all hooks that match the request
+// after the rest of the chain has served it. It implements plugin.Handler
+func (w *webhookPlugin) ServeDHCP(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	if err := w.next.ServeDHCP(ctx, req, res); err != nil {
+		return err
+	}
+
+	l := log.With(ctx, w.l)
+	for _, h := range w.hooks {
+		if !h.events[events.EventRequest] || !h.classes.Match(ctx) {
+			continue
+		}
+
+		matched, err := h.Match(ctx, req)
+		if err != nil {
+			l.Warnf("failed to match condition for %s: %s", h.url, err.Error())
+			continue
+		}
+
+		if matched {
+			h.notify(events.NewRequestReplacer(ctx, req, res))
+		}
+	}
+
+	return nil
+}
+
+// handleEvent queues a notification for all hooks registered for
+// the lease event
+func (w *webhookPlugin) handleEvent(event caddy.EventName, l *lease.Lease) error {
+	// events are emitted for all subnets
+	if w.network.IP != nil && !w.network.Contains(l.Address) {
+		return nil
+	}
+
+	for _, h := range w.hooks {
+		if h.events[event] {
+			h.notify(events.NewReplacer(event, l))
+		}
+	}
+
+	return nil
+}
+
+// notify renders the body and headers of h and adds them to the
+// delivery queue
+func (h *hook) notify(rep replacer.Replacer) {
+	header := make(http.Header, len(h.headers)+1)
+	for key, values := range h.headers {
+		for _, v := range values {
+			header.Add(key, rep.Replace(v))
+		}
+	}
+	header.Set(eventHeader, rep.Get("event"))
+
+	h.queue.Push(&delivery{
+		URL:    h.url,
+		Header: header,
+		Body:   h.payload(rep),
+	})
+}
+
+// payload returns the body to send. If no body template is configured
+// all replacer keys are encoded as a JSON object
+func (h *hook) payload(rep replacer.Replacer) string {
+	if h.body != "" {
+		return rep.Replace(h.body)
+	}
+
+	values := make(map[string]string, len(events.Keys))
+	for _, key := range events.Keys {
+		values[key] = rep.Get(key)
+	}
+
+	// encoding a map of strings cannot fail
+	blob, _ := json.Marshal(values)
+	return string(blob)
+}
+
+// send posts d and returns an error if the webhook did not accept it.
+// Client errors other than timeouts and rate limits are not retried
+func (h *hook) send(d *delivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.URL, strings.NewReader(d.Body))
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	for key, values := range d.Header {
+		req.Header[key] = values
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(h.secret) > 0 {
+		req.Header.Set(signatureHeader, "sha256="+sign(h.secret, d.Body))
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("unexpected status %s", res.Status)
+	if res.StatusCode >= 400 && res.StatusCode < 500 &&
+		res.StatusCode != http.StatusRequestTimeout &&
+		res.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+
+	return err
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body
+func sign(secret []byte, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/nextdhcp/nextdhcp/core/events"
+	"github.com/nextdhcp/nextdhcp/core/lease"
+	"github.com/nextdhcp/nextdhcp/plugin"
+	"github.com/nextdhcp/nextdhcp/plugin/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received is a request received by the test server
+type received struct {
+	header http.Header
+	body   string
+}
+
+// server is a webhook receiver that fails the first n requests
+type server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fail     int
+	status   int
+	requests []received
+}
+
+func newServer(t *testing.T, fail int, status int) *server {
+	s := &server{fail: fail, status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests = append(s.requests, received{r.Header, string(body)})
+		if len(s.requests) <= s.fail {
+			w.WriteHeader(s.status)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *server) received() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]received(nil), s.requests...)
+}
+
+// assign is a handler that assigns 127.0.0.10 to each client
+var assign plugin.HandlerFunc = func(ctx context.Context, req, res *dhcpv4.DHCPv4) error {
+	res.YourIPAddr = net.IP{127, 0, 0, 10}
+	return nil
+}
+
+func newPlugin(t *testing.T, input string) *webhookPlugin {
+	plg, err := makeWebhookPlugin(test.CreateTestBed(t, input))
+	require.NoError(t, err)
+	plg.next = assign
+
+	for _, h := range plg.hooks {
+		require.NoError(t, h.queue.Start())
+		t.Cleanup(h.queue.Stop)
+	}
+
+	return plg
+}
+
+func newMessages(t *testing.T, typ dhcpv4.MessageType) (*dhcpv4.DHCPv4, *dhcpv4.DHCPv4) {
+	req, err := dhcpv4.New(
+		dhcpv4.WithHwAddr(net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}),
+		dhcpv4.WithMessageType(typ),
+		dhcpv4.WithOption(dhcpv4.OptHostName("lab")),
+	)
+	require.NoError(t, err)
+
+	res, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+	return req, res
+}
+
+func TestWebhookRequest(t *testing.T) {
+	srv := newServer(t, 0, 0)
+	plg := newPlugin(t, `
+	webhook msgtype == 'REQUEST' {
+		url `+srv.URL+`
+		header X-Client {hwaddr}
+		secret s3cr3t
+	}`)
+
+	req, res := newMessages(t, dhcpv4.MessageTypeDiscover)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+
+	req, res = newMessages(t, dhcpv4.MessageTypeRequest)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+
+	assert.Eventually(t, func() bool { return len(srv.received()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	r := srv.received()[0]
+
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal([]byte(r.body), &payload))
+	assert.Equal(t, "request", payload["event"])
+	assert.Equal(t, "REQUEST", payload["msgtype"])
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff", payload["hwaddr"])
+	assert.Equal(t, "127.0.0.10", payload["yourip"])
+	assert.Equal(t, "lab", payload["hostname"])
+
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff", r.header.Get("X-Client"))
+	assert.Equal(t, "request", r.header.Get(eventHeader))
+	assert.Equal(t, "sha256="+sign([]byte("s3cr3t"), r.body), r.header.Get(signatureHeader))
+}
+
+func TestWebhookRetry(t *testing.T) {
+	srv := newServer(t, 2, http.StatusServiceUnavailable)
+	plg := newPlugin(t, `
+	webhook {
+		url `+srv.URL+`
+		body "\{\"host\": \"{hostname}\"\}"
+		backoff 10ms 20ms
+	}`)
+
+	req, res := newMessages(t, dhcpv4.MessageTypeDiscover)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+
+	assert.Eventually(t, func() bool { return len(srv.received()) == 3 }, 2*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return plg.hooks[0].queue.Len() == 0 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, `{"host": "lab"}`, srv.received()[2].body)
+
+	// client errors are not retried
+	srv = newServer(t, 1, http.StatusBadRequest)
+	plg = newPlugin(t, `
+	webhook {
+		url `+srv.URL+`
+		backoff 10ms
+	}`)
+
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Eventually(t, func() bool { return plg.hooks[0].queue.Len() == 0 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, srv.received(), 1)
+}
+
+func TestWebhookQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "queue")
+	srv := newServer(t, 1000, http.StatusInternalServerError)
+
+	plg, err := makeWebhookPlugin(test.CreateTestBed(t, `
+	webhook {
+		url `+srv.URL+`
+		backoff 1h
+		queue `+dir+`
+	}`))
+	require.NoError(t, err)
+	plg.next = assign
+
+	q := plg.hooks[0].queue
+	require.NoError(t, q.Start())
+
+	req, res := newMessages(t, dhcpv4.MessageTypeDiscover)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+	assert.Eventually(t, func() bool { return len(srv.received()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	q.Stop()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// the delivery is sent again after a restart
+	srv.mu.Lock()
+	srv.fail = 0
+	srv.mu.Unlock()
+
+	plg, err = makeWebhookPlugin(test.CreateTestBed(t, `
+	webhook {
+		url `+srv.URL+`
+		queue `+dir+`
+	}`))
+	require.NoError(t, err)
+
+	q = plg.hooks[0].queue
+	require.NoError(t, q.Start())
+	defer q.Stop()
+
+	// the retry is scheduled in one hour
+	assert.Equal(t, 1, q.Len())
+	q.mu.Lock()
+	q.pending[0].Next = time.Now()
+	q.mu.Unlock()
+	q.wake <- struct{}{}
+
+	assert.Eventually(t, func() bool { return len(srv.received()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(files[0])
+		return os.IsNotExist(err)
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, srv.received()[0].body, srv.received()[1].body)
+}
+
+func TestWebhookLeaseEvents(t *testing.T) {
+	srv := newServer(t, 0, 0)
+	plg := newPlugin(t, `
+	webhook {
+		url `+srv.URL+`
+		on lease-created lease-expired
+	}`)
+
+	unsubscribe := events.Subscribe(plg.handleEvent)
+	defer unsubscribe()
+
+	l := &lease.Lease{
+		Client:  lease.Client{ID: "aa:bb:cc:dd:ee:ff"},
+		Address: net.IP{127, 0, 0, 10},
+		Expires: time.Now(),
+	}
+
+	// leases of other subnets are ignored
+	other := *l
+	other.Address = net.IP{10, 0, 0, 1}
+	events.EmitLeaseEvent(events.EventLeaseCreated, &other)
+
+	events.EmitLeaseEvent(events.EventLeaseReleased, l)
+	events.EmitLeaseEvent(events.EventLeaseExpired, l)
+
+	// requests are ignored if not selected
+	req, res := newMessages(t, dhcpv4.MessageTypeDiscover)
+	require.NoError(t, plg.ServeDHCP(context.Background(), req, res))
+
+	assert.Eventually(t, func() bool { return len(srv.received()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Len(t, srv.received(), 1)
+
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal([]byte(srv.received()[0].body), &payload))
+	assert.Equal(t, "lease-expired", payload["event"])
+	assert.Equal(t, "127.0.0.10", payload["yourip"])
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff", payload["clientid"])
+}
+
+func TestQueueDelay(t *testing.T) {
+	q := &queue{backoff: time.Second, maxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, q.delay(1))
+	assert.Equal(t, 2*time.Second, q.delay(2))
+	assert.Equal(t, 4*time.Second, q.delay(3))
+	assert.Equal(t, 5*time.Second, q.delay(4))
+	assert.Equal(t, 5*time.Second, q.delay(100))
+}